@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/keys"
+)
+
+// runKeygen generates a dnstt Curve25519 keypair. With no file flags the
+// keys are printed like dnstt-server -gen-key does.
+func runKeygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	privPath := fs.String("privkey-file", "", "Write the private key to this file")
+	pubPath := fs.String("pubkey-file", "", "Write the public key to this file")
+	force := fs.Bool("force", false, "Overwrite existing key files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s keygen [options]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if (*privPath == "") != (*pubPath == "") {
+		fmt.Fprintf(os.Stderr, "Error: -privkey-file and -pubkey-file must be given together\n")
+		os.Exit(1)
+	}
+
+	priv, pub, err := keys.Generate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *privPath == "" {
+		fmt.Printf("privkey %x\n", priv)
+		fmt.Printf("pubkey  %x\n", pub)
+		return
+	}
+
+	if err := keys.WriteFiles(*privPath, *pubPath, priv, pub, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("privkey written to %s\n", *privPath)
+	fmt.Printf("pubkey  written to %s\n", *pubPath)
+	fmt.Printf("pubkey  %x\n", pub)
+}
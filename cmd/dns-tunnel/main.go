@@ -5,6 +5,11 @@
 // Usage:
 //
 //	dns-tunnel -config config.yaml
+//	dns-tunnel server -config server.yaml
+//	dns-tunnel uot-server -listen 127.0.0.1:5555 -forward 127.0.0.1:51820
+//	dns-tunnel keygen -privkey-file server.key -pubkey-file server.pub
+//	dns-tunnel export-profile -config server.yaml -resolvers 1.1.1.1 -o client.yaml
+//	dns-tunnel -config client.yaml -signer SHA256:...   (or a dnstunnel:// URI)
 //
 // The application will:
 // 1. Load configuration from the specified YAML file
@@ -91,17 +96,40 @@ func findConfigFile() string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "server":
+			runServer(os.Args[2:])
+			return
+		case "uot-server":
+			runUOTServer(os.Args[2:])
+			return
+		case "keygen":
+			runKeygen(os.Args[2:])
+			return
+		case "export-profile":
+			runExportProfile(os.Args[2:])
+			return
+		}
+	}
+
 	var (
-		configPath  string
-		showVersion bool
+		configPath    string
+		profileSigner string
+		showVersion   bool
 	)
 
-	flag.StringVar(&configPath, "config", "", "Path to configuration file (optional, auto-detected)")
+	flag.StringVar(&configPath, "config", "", "Path to configuration file, profile bundle or dnstunnel:// URI (optional, auto-detected)")
+	flag.StringVar(&profileSigner, "signer", "", "Signer fingerprint (SHA256:...) a profile bundle or URI must be signed with, as printed by export-profile")
 	flag.BoolVar(&showVersion, "version", false, "Show version information")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "dns-tunnel - Unified DNS Tunnel VPN Client\n\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n")
-		fmt.Fprintf(os.Stderr, "  %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s server [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s uot-server [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s keygen [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s export-profile [options]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nConfig file search order:\n")
@@ -136,7 +164,7 @@ func main() {
 	log.Printf("dns-tunnel version %s starting...", Version)
 
 	// Load configuration
-	cfg, err := config.Load(configPath)
+	cfg, err := config.Load(configPath, profileSigner)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -144,7 +172,10 @@ func main() {
 	log.Printf("Configuration loaded from: %s", configPath)
 
 	// Create and run the application
-	application := app.New(cfg)
+	application, err := app.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create application: %v", err)
+	}
 	if err := application.Run(); err != nil {
 		log.Fatalf("Application error: %v", err)
 	}
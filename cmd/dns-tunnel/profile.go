@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/keys"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/profile"
+)
+
+// runExportProfile writes a signed client profile as a YAML bundle and
+// prints its dnstunnel:// URI and a QR code.
+func runExportProfile(args []string) {
+	fs := flag.NewFlagSet("export-profile", flag.ExitOnError)
+	configPath := fs.String("config", "", "Server configuration file (supplies domain and privkey_file)")
+	privPath := fs.String("privkey-file", "", "Server private key file (overrides -config)")
+	domain := fs.String("domain", "", "Tunnel domain (overrides -config)")
+	resolvers := fs.String("resolvers", "", "Comma-separated seed resolvers")
+	resolverType := fs.String("resolver-type", "", "Preferred resolver type: doh, dot or udp")
+	utls := fs.String("utls", "", "uTLS fingerprint distribution")
+	output := fs.String("o", "", "Write the YAML bundle to this file (default stdout)")
+	showQR := fs.Bool("qr", true, "Print the URI as a terminal QR code")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s export-profile [options]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *configPath != "" {
+		cfg, err := config.LoadServer(*configPath)
+		if err != nil {
+			fatalf("Failed to load configuration: %v", err)
+		}
+		if *privPath == "" {
+			*privPath = cfg.Server.PrivKeyFile
+		}
+		if *domain == "" {
+			*domain = cfg.Server.Domain
+		}
+	}
+	if *privPath == "" || *domain == "" {
+		fatalf("-domain and -privkey-file (or -config) are required")
+	}
+
+	switch *resolverType {
+	case "", "doh", "dot", "udp":
+	default:
+		fatalf("-resolver-type must be 'doh', 'dot', or 'udp'")
+	}
+
+	priv, err := keys.ReadPrivKeyFile(*privPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	pub, err := keys.PubKey(priv)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	p := &profile.Profile{
+		Domain:          *domain,
+		PubKey:          fmt.Sprintf("%x", pub),
+		ResolverType:    *resolverType,
+		UTLSFingerprint: *utls,
+	}
+	for _, r := range strings.Split(*resolvers, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			p.Resolvers = append(p.Resolvers, r)
+		}
+	}
+	if err := p.Sign(priv); err != nil {
+		fatalf("Signing profile: %v", err)
+	}
+
+	bundle, err := p.YAML()
+	if err != nil {
+		fatalf("Encoding profile: %v", err)
+	}
+	uri, err := p.URI()
+	if err != nil {
+		fatalf("Encoding profile: %v", err)
+	}
+
+	// Keep stdout clean for the bundle when no output file is given
+	info := os.Stderr
+	if *output != "" {
+		if err := os.WriteFile(*output, bundle, 0600); err != nil {
+			fatalf("Writing profile: %v", err)
+		}
+		info = os.Stdout
+		fmt.Fprintf(info, "Profile written to %s\n", *output)
+	} else {
+		os.Stdout.Write(bundle)
+	}
+
+	fmt.Fprintf(info, "Signer: %s\n", p.SignerFingerprint())
+	fmt.Fprintf(info, "Share the signer fingerprint separately; clients load the profile with -signer %s\n", p.SignerFingerprint())
+	fmt.Fprintf(info, "URI: %s\n", uri)
+	if *showQR {
+		qr, err := p.QR()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Fprint(info, qr)
+	}
+}
+
+// fatalf prints an error and exits.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/api"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/echo"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/server"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/uot"
+)
+
+// findServerConfigFile searches for a server config file in common
+// locations. It never returns a client config, which would make the
+// server start with the client's defaults.
+func findServerConfigFile() string {
+	searchPaths := []string{
+		filepath.Join("/etc", "dns-tunnel", "server.yaml"),
+	}
+
+	// Search paths relative to executable
+	if exePath, err := os.Executable(); err == nil {
+		exeDir := filepath.Dir(exePath)
+		searchPaths = append(searchPaths,
+			filepath.Join(exeDir, "configs", "server", "dns-tunnel-server.yaml"),
+			filepath.Join(exeDir, "dns-tunnel-server.yaml"),
+		)
+	}
+
+	// Search in current working directory
+	if cwd, err := os.Getwd(); err == nil {
+		searchPaths = append(searchPaths,
+			filepath.Join(cwd, "configs", "server", "dns-tunnel-server.yaml"),
+			filepath.Join(cwd, "dns-tunnel-server.yaml"),
+		)
+	}
+
+	for _, p := range searchPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// runServer runs the server side of the tunnel: dnstt-server under
+// supervision, the probe echo responder, the optional UDP-over-TCP and
+// SOCKS5 UDP relays and the status API.
+func runServer(args []string) {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to server configuration file (optional, auto-detected as /etc/dns-tunnel/server.yaml or dns-tunnel-server.yaml)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s server [options]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *configPath == "" {
+		*configPath = findServerConfigFile()
+		if *configPath == "" {
+			fmt.Fprintf(os.Stderr, "Error: No server config file found\n\n")
+			fs.Usage()
+			os.Exit(1)
+		}
+	}
+
+	log.SetFlags(log.LstdFlags | log.LUTC | log.Lmicroseconds)
+	log.SetPrefix("[dns-tunnel] ")
+
+	log.Printf("dns-tunnel server version %s starting...", Version)
+
+	cfg, err := config.LoadServer(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	log.Printf("Configuration loaded from: %s", *configPath)
+
+	pubKey, err := server.EnsureKeys(&cfg.Server)
+	if err != nil {
+		log.Fatalf("Failed to prepare keypair: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sup := server.New(&cfg.Server, pubKey)
+	var wg sync.WaitGroup
+
+	var status *api.ServerStatus
+	if cfg.Server.API.Enabled {
+		status = api.NewServerStatus(sup)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := status.Start(cfg.Server.API.Port); err != nil {
+				log.Printf("API server stopped: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Server.Echo.Enabled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responder := echo.NewResponder(cfg.Server.Listen, cfg.Server.Echo.DnsttListen, cfg.Server.Domain, pubKey)
+			if err := responder.Run(ctx); err != nil {
+				log.Printf("Echo responder stopped: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Server.HealthEcho != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := echo.NewStreamServer(cfg.Server.HealthEcho).Run(ctx); err != nil {
+				log.Printf("Health echo stopped: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Server.UDPRelay != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := uot.NewRelay(cfg.Server.UDPRelay).Run(ctx); err != nil {
+				log.Printf("UDP relay stopped: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Server.UDPForward != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := uot.NewServer(cfg.Server.Upstream, cfg.Server.UDPForward).Run(ctx); err != nil {
+				log.Printf("UDP-over-TCP relay stopped: %v", err)
+			}
+		}()
+	}
+
+	if err := sup.Run(ctx); err != nil {
+		log.Printf("Supervisor error: %v", err)
+	}
+
+	log.Printf("Shutting down...")
+	if status != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := status.Stop(shutdownCtx); err != nil {
+			log.Printf("Error stopping API server: %v", err)
+		}
+	}
+	stop()
+	wg.Wait()
+	log.Printf("Shutdown complete")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/uot"
+)
+
+// runUOTServer runs the server side of UDP-over-TCP: dnstt-server forwards
+// to -listen and datagrams are relayed to the UDP service at -forward.
+func runUOTServer(args []string) {
+	fs := flag.NewFlagSet("uot-server", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:5555", "TCP address dnstt-server forwards to")
+	forward := fs.String("forward", "127.0.0.1:51820", "UDP address to relay datagrams to (WireGuard)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s uot-server [options]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	log.SetFlags(log.LstdFlags | log.LUTC | log.Lmicroseconds)
+	log.SetPrefix("[dns-tunnel] ")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := uot.NewServer(*listen, *forward).Run(ctx); err != nil {
+		log.Fatalf("UDP-over-TCP server error: %v", err)
+	}
+}
@@ -11,16 +11,36 @@ import (
 	"time"
 
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/health"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/httpproxy"
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/socks"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/tunnel"
 )
 
 // ResolverInfo represents a resolver in JSON responses.
 type ResolverInfo struct {
-	Address   string `json:"address"`
-	Type      string `json:"type"`
-	Status    string `json:"status"`
-	LatencyMs int64  `json:"latency_ms,omitempty"`
-	FailCount int    `json:"fail_count,omitempty"`
+	Address    string `json:"address"`
+	Type       string `json:"type"`
+	ServerName string `json:"server_name,omitempty"`
+	Status     string `json:"status"`
+	LatencyMs  int64  `json:"latency_ms,omitempty"`
+	FailCount  int    `json:"fail_count,omitempty"`
+	Corrupting bool   `json:"corrupting,omitempty"`
+	Origin     string `json:"origin,omitempty"`
+	Source     string `json:"source,omitempty"`
+
+	BlockCount    int       `json:"block_count,omitempty"`
+	CooldownUntil time.Time `json:"cooldown_until,omitzero"`
+
+	Score       float64 `json:"score"`
+	Reliability float64 `json:"reliability"`
+	MaxResponse int     `json:"max_response,omitempty"`
+
+	QPS           float64   `json:"qps,omitempty"`
+	Loss          float64   `json:"loss,omitempty"`
+	Truncation    string    `json:"truncation,omitempty"`
+	TCP           bool      `json:"tcp,omitempty"`
+	BenchmarkedAt time.Time `json:"benchmarked_at,omitzero"`
 }
 
 // ResolversResponse is the response for GET /resolvers.
@@ -28,6 +48,7 @@ type ResolversResponse struct {
 	Resolvers []ResolverInfo `json:"resolvers"`
 	Count     int            `json:"count"`
 	Healthy   int            `json:"healthy"`
+	Strategy  string         `json:"strategy"`
 }
 
 // HealthResponse is the response for GET /health.
@@ -38,27 +59,58 @@ type HealthResponse struct {
 
 // StatsResponse is the response for GET /stats.
 type StatsResponse struct {
-	ResolverCount  int    `json:"resolver_count"`
-	HealthyCount   int    `json:"healthy_count"`
-	DegradedCount  int    `json:"degraded_count"`
-	BlockedCount   int    `json:"blocked_count"`
-	UnknownCount   int    `json:"unknown_count"`
-	PoolExhausted  bool   `json:"pool_exhausted"`
-	MonitorStatus  string `json:"monitor_status"`
-	MonitorHealthy bool   `json:"monitor_healthy"`
+	ResolverCount     int    `json:"resolver_count"`
+	HealthyCount      int    `json:"healthy_count"`
+	DegradedCount     int    `json:"degraded_count"`
+	BlockedCount      int    `json:"blocked_count"`
+	IncompatibleCount int    `json:"incompatible_count"`
+	UnknownCount      int    `json:"unknown_count"`
+	PoolExhausted     bool   `json:"pool_exhausted"`
+	MonitorStatus     string `json:"monitor_status"`
+	MonitorHealthy    bool   `json:"monitor_healthy"`
+	Strategy          string `json:"strategy"`
+}
+
+// PathsResponse is the response for GET /paths.
+type PathsResponse struct {
+	Paths []tunnel.PathInfo `json:"paths"`
+	Count int               `json:"count"`
+}
+
+// UsersResponse is the response for GET /users.
+type UsersResponse struct {
+	Users []socks.UserStats `json:"users"`
+	Count int               `json:"count"`
 }
 
 // Server is the REST API server.
 type Server struct {
 	pool    *resolver.Pool
 	monitor *health.Monitor
+	tunnel  *tunnel.Manager
+	socks   *socks.Server
+	proxy   *httpproxy.Server
 	server  *http.Server
 	mu      sync.RWMutex
 }
 
 // New creates a new API server.
-func New(pool *resolver.Pool, monitor *health.Monitor) *Server {
-	return &Server{pool: pool, monitor: monitor}
+func New(pool *resolver.Pool, monitor *health.Monitor, tunnelMgr *tunnel.Manager) *Server {
+	return &Server{pool: pool, monitor: monitor, tunnel: tunnelMgr}
+}
+
+// SetSOCKS attaches the built-in SOCKS5 server for per-user accounting.
+func (s *Server) SetSOCKS(srv *socks.Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.socks = srv
+}
+
+// SetHTTPProxy attaches the HTTP proxy so /proxy.pac can point at it.
+func (s *Server) SetHTTPProxy(srv *httpproxy.Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxy = srv
 }
 
 // Start starts the API server on the specified port.
@@ -67,6 +119,9 @@ func (s *Server) Start(port int) error {
 	mux.HandleFunc("/resolvers", s.handleResolvers)
 	mux.HandleFunc("/health", s.handleHealth)
 	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/paths", s.handlePaths)
+	mux.HandleFunc("/users", s.handleUsers)
+	mux.HandleFunc("/proxy.pac", s.handlePAC)
 
 	s.mu.Lock()
 	s.server = &http.Server{
@@ -99,20 +154,39 @@ func (s *Server) handleResolvers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resolvers := s.pool.All()
+	now := time.Now()
 	infos := make([]ResolverInfo, 0, len(resolvers))
 	for _, res := range resolvers {
 		infos = append(infos, ResolverInfo{
-			Address:   res.Address,
-			Type:      res.Type,
-			Status:    statusToString(res.Status),
-			LatencyMs: res.Latency.Milliseconds(),
-			FailCount: res.FailCount,
+			Address:    res.Address,
+			Type:       res.Type,
+			ServerName: res.ServerName,
+			Status:     res.Status.String(),
+			LatencyMs:  res.Latency.Milliseconds(),
+			FailCount:  res.FailCount,
+			Corrupting: res.Corrupting,
+			Origin:     res.Origin,
+			Source:     res.Source,
+
+			BlockCount:    res.BlockCount,
+			CooldownUntil: res.CooldownUntil,
+
+			Score:       res.EWMAScore(now),
+			Reliability: res.Reliability,
+			MaxResponse: res.MaxResponse,
+
+			QPS:           res.Capacity.QPS,
+			Loss:          res.Capacity.Loss,
+			Truncation:    res.Capacity.Truncation,
+			TCP:           res.Capacity.TCP,
+			BenchmarkedAt: res.Capacity.MeasuredAt,
 		})
 	}
 	writeJSON(w, ResolversResponse{
 		Resolvers: infos,
 		Count:     s.pool.Count(),
 		Healthy:   s.pool.CountHealthy(),
+		Strategy:  s.pool.StrategyName(),
 	})
 }
 
@@ -137,7 +211,7 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resolvers := s.pool.All()
-	var healthy, degraded, blocked, unknown int
+	var healthy, degraded, blocked, incompatible, unknown int
 	for _, res := range resolvers {
 		switch res.Status {
 		case resolver.StatusHealthy:
@@ -146,6 +220,8 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 			degraded++
 		case resolver.StatusBlocked:
 			blocked++
+		case resolver.StatusIncompatible:
+			incompatible++
 		default:
 			unknown++
 		}
@@ -163,28 +239,60 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	writeJSON(w, StatsResponse{
-		ResolverCount:  len(resolvers),
-		HealthyCount:   healthy,
-		DegradedCount:  degraded,
-		BlockedCount:   blocked,
-		UnknownCount:   unknown,
-		PoolExhausted:  s.pool.IsExhausted(),
-		MonitorStatus:  monitorStatus,
-		MonitorHealthy: monitorHealthy,
+		ResolverCount:     len(resolvers),
+		HealthyCount:      healthy,
+		DegradedCount:     degraded,
+		BlockedCount:      blocked,
+		IncompatibleCount: incompatible,
+		UnknownCount:      unknown,
+		PoolExhausted:     s.pool.IsExhausted(),
+		MonitorStatus:     monitorStatus,
+		MonitorHealthy:    monitorHealthy,
+		Strategy:          s.pool.StrategyName(),
 	})
 }
 
-func statusToString(s resolver.Status) string {
-	switch s {
-	case resolver.StatusHealthy:
-		return "healthy"
-	case resolver.StatusDegraded:
-		return "degraded"
-	case resolver.StatusBlocked:
-		return "blocked"
-	default:
-		return "unknown"
+func (s *Server) handlePaths(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	paths := []tunnel.PathInfo{}
+	if s.tunnel != nil {
+		paths = s.tunnel.Paths()
+	}
+	writeJSON(w, PathsResponse{Paths: paths, Count: len(paths)})
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	srv := s.socks
+	s.mu.RUnlock()
+	users := []socks.UserStats{}
+	if srv != nil {
+		users = srv.Stats().Snapshot()
+	}
+	writeJSON(w, UsersResponse{Users: users, Count: len(users)})
+}
+
+func (s *Server) handlePAC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	proxy := s.proxy
+	s.mu.RUnlock()
+	if proxy == nil {
+		http.Error(w, "HTTP proxy not enabled", http.StatusNotFound)
+		return
 	}
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Write([]byte(proxy.PAC(r.Host)))
 }
 
 func writeJSON(w http.ResponseWriter, data interface{}) {
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/server"
+)
+
+// SessionsResponse is the response for GET /sessions.
+type SessionsResponse struct {
+	Sessions []server.SessionStats `json:"sessions"`
+	Count    int                   `json:"count"`
+	Active   int                   `json:"active"`
+}
+
+// ServerStatus is the REST API for `dns-tunnel server`.
+type ServerStatus struct {
+	supervisor *server.Supervisor
+	server     *http.Server
+	mu         sync.RWMutex
+}
+
+// NewServerStatus creates the status API for a dnstt-server supervisor.
+func NewServerStatus(sup *server.Supervisor) *ServerStatus {
+	return &ServerStatus{supervisor: sup}
+}
+
+// Start starts the status API on the specified port.
+func (s *ServerStatus) Start(port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/sessions", s.handleSessions)
+
+	s.mu.Lock()
+	s.server = &http.Server{
+		Addr:         ":" + strconv.Itoa(port),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	s.mu.Unlock()
+
+	log.Printf("[api] Server status API starting on port %d", port)
+	return s.server.ListenAndServe()
+}
+
+// Stop gracefully stops the status API.
+func (s *ServerStatus) Stop(ctx context.Context) error {
+	s.mu.RLock()
+	srv := s.server
+	s.mu.RUnlock()
+	if srv == nil {
+		return nil
+	}
+	log.Printf("[api] Server status API shutting down")
+	return srv.Shutdown(ctx)
+}
+
+func (s *ServerStatus) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := "healthy"
+	if !s.supervisor.Status().Running {
+		status = "unhealthy"
+	}
+	writeJSON(w, HealthResponse{
+		Status:    status,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *ServerStatus) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.supervisor.Status())
+}
+
+func (s *ServerStatus) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessions := s.supervisor.Sessions()
+	active := 0
+	for _, sess := range sessions {
+		if sess.Active {
+			active++
+		}
+	}
+	writeJSON(w, SessionsResponse{Sessions: sessions, Count: len(sessions), Active: active})
+}
@@ -15,9 +15,13 @@ import (
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/cloudflare"
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/health"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/httpproxy"
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/scanner"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/socks"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/sshproxy"
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/tunnel"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/uot"
 )
 
 // App is the main application orchestrator that coordinates all components.
@@ -29,6 +33,11 @@ type App struct {
 	resolverPool *resolver.Pool
 	cfClient     *cloudflare.Client
 	apiServer    *api.Server
+	socksServer  *socks.Server
+	sshClient    *sshproxy.Client
+	sshSOCKS     *socks.Server
+	httpProxy    *httpproxy.Server
+	uotClient    *uot.Client
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -36,19 +45,76 @@ type App struct {
 }
 
 // New creates a new App instance with all components wired together.
-func New(cfg *config.Config) *App {
-	ctx, cancel := context.WithCancel(context.Background())
-
+func New(cfg *config.Config) (*App, error) {
 	// Create resolver pool
 	pool := resolver.NewPool()
+	pool.SetCooldown(cfg.Pool.CooldownBase, cfg.Pool.CooldownMax)
+	strategy, err := resolver.NewStrategy(cfg.Pool.Strategy)
+	if err != nil {
+		return nil, fmt.Errorf("pool.strategy: %w", err)
+	}
+	pool.SetStrategy(strategy)
+	pool.SetFamily(cfg.Pool.AddressFamily)
 
 	// Create components
 	scannerInst := scanner.New(&cfg.Scanner, pool)
+	if cfg.Scanner.TunnelProbe {
+		scannerInst.SetTunnelDomain(cfg.Tunnel.Domain, cfg.Tunnel.PubKey)
+	}
+	scannerInst.SetFamily(cfg.Pool.AddressFamily)
+	scannerInst.SetFingerprints(cfg.Tunnel.UTLSFingerprint)
 	tunnelMgr := tunnel.New(&cfg.Tunnel, pool)
 	healthMon := health.New(&cfg.Health, tunnelMgr, pool)
+	healthMon.SetProxyAuth(cfg.SOCKS.UpstreamUsername, cfg.SOCKS.UpstreamPassword)
+	healthMon.SetExchanger(scannerInst.Exchange)
 	cfClient := cloudflare.New(&cfg.Cloudflare)
-	apiServer := api.New(pool, healthMon)
+	apiServer := api.New(pool, healthMon, tunnelMgr)
+
+	// Streams reach the internet through SSH when the SSH layer is
+	// enabled, otherwise through a SOCKS5 proxy on the server side
+	var (
+		dialer    socks.Dialer
+		sshClient *sshproxy.Client
+		sshSOCKS  *socks.Server
+	)
+	if cfg.SSH.Enabled {
+		sshClient = sshproxy.New(&cfg.SSH, tunnelMgr)
+		dialer = sshClient
+		if cfg.SSH.SOCKSListen != "" {
+			sshSOCKS = socks.New(&config.SOCKSConfig{
+				Enabled:          true,
+				Listen:           cfg.SSH.SOCKSListen,
+				HandshakeTimeout: cfg.SOCKS.HandshakeTimeout,
+				DialTimeout:      cfg.SSH.ConnectTimeout,
+				UDPRelay:         cfg.SOCKS.UDPRelay,
+			}, sshClient)
+		}
+	} else {
+		dialer = &socks.UpstreamDialer{
+			ProxyAddr: tunnelMgr.LocalAddr,
+			Username:  cfg.SOCKS.UpstreamUsername,
+			Password:  cfg.SOCKS.UpstreamPassword,
+		}
+	}
 
+	var socksServer *socks.Server
+	if cfg.SOCKS.Enabled {
+		socksServer = socks.New(&cfg.SOCKS, dialer)
+		apiServer.SetSOCKS(socksServer)
+	}
+
+	var httpProxy *httpproxy.Server
+	if cfg.HTTPProxy.Enabled {
+		httpProxy = httpproxy.New(&cfg.HTTPProxy, dialer)
+		apiServer.SetHTTPProxy(httpProxy)
+	}
+
+	var uotClient *uot.Client
+	if cfg.UDPOverTCP.Enabled {
+		uotClient = uot.NewClient(cfg.UDPOverTCP.Listen, tunnelMgr.LocalAddr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &App{
 		config:       cfg,
 		scanner:      scannerInst,
@@ -57,9 +123,14 @@ func New(cfg *config.Config) *App {
 		resolverPool: pool,
 		cfClient:     cfClient,
 		apiServer:    apiServer,
+		socksServer:  socksServer,
+		sshClient:    sshClient,
+		sshSOCKS:     sshSOCKS,
+		httpProxy:    httpProxy,
+		uotClient:    uotClient,
 		ctx:          ctx,
 		cancel:       cancel,
-	}
+	}, nil
 }
 
 // Run starts the application and blocks until shutdown.
@@ -67,6 +138,8 @@ func (a *App) Run() error {
 	log.Printf("Starting dns-tunnel application")
 	log.Printf("Domain: %s", a.config.Tunnel.Domain)
 	log.Printf("Local address: %s", a.config.Tunnel.LocalAddr)
+	log.Printf("Tunnel mode: %s", a.tunnelMgr.Mode())
+	log.Printf("Resolver selection: %s", a.resolverPool.StrategyName())
 
 	// Step 1: Start API server if enabled
 	if a.config.API.Enabled {
@@ -79,7 +152,25 @@ func (a *App) Run() error {
 		}()
 	}
 
-	// Step 2: Try to fetch resolvers from TXT record (fallback source)
+	// Step 2: Restore saved pool state from the last run
+	if a.config.Pool.StateFile != "" {
+		n, err := a.resolverPool.Load(a.config.Pool.StateFile, a.config.Pool.StateMaxAge)
+		if err != nil {
+			log.Printf("Failed to restore pool state: %v", err)
+		} else if n > 0 {
+			log.Printf("Restored %d resolvers from %s", n, a.config.Pool.StateFile)
+		}
+	}
+
+	// Step 3: Add seed resolvers from config or profile
+	for _, r := range a.config.Tunnel.Resolvers {
+		a.resolverPool.AddFrom(r, resolver.TypeForAddress(r, a.config.Tunnel.ResolverType), resolver.OriginSeed)
+	}
+	if n := len(a.config.Tunnel.Resolvers); n > 0 {
+		log.Printf("Loaded %d seed resolvers", n)
+	}
+
+	// Step 4: Try to fetch resolvers from TXT record (fallback source)
 	if a.cfClient.IsEnabled() {
 		log.Printf("Attempting to fetch resolvers from Cloudflare TXT record...")
 		resolvers, err := a.cfClient.FetchResolvers(a.ctx)
@@ -87,13 +178,13 @@ func (a *App) Run() error {
 			log.Printf("Failed to fetch resolvers from TXT: %v", err)
 		} else {
 			for _, r := range resolvers {
-				a.resolverPool.Add(r, a.config.Tunnel.ResolverType)
+				a.resolverPool.AddFrom(r, resolver.TypeForAddress(r, a.config.Tunnel.ResolverType), resolver.OriginTXT)
 			}
 			log.Printf("Loaded %d resolvers from TXT record", len(resolvers))
 		}
 	}
 
-	// Step 3: If pool is empty or has few resolvers, run initial scan
+	// Step 5: If pool is empty or has few resolvers, run initial scan
 	if a.config.Scanner.Enabled && a.resolverPool.Count() < a.config.Scanner.MinResolvers {
 		log.Printf("Running initial resolver scan...")
 		working, err := a.scanner.ScanFromSources(a.ctx)
@@ -104,8 +195,8 @@ func (a *App) Run() error {
 		}
 	}
 
-	// Step 4: Connect to first available resolver
-	currentResolver := a.resolverPool.Get()
+	// Step 6: Connect to first available resolver
+	currentResolver := a.resolverPool.Select()
 	if currentResolver == nil {
 		return fmt.Errorf("no resolvers available, cannot start tunnel")
 	}
@@ -114,7 +205,60 @@ func (a *App) Run() error {
 		return fmt.Errorf("failed to connect tunnel: %w", err)
 	}
 
-	// Step 5: Start health monitor in goroutine
+	// Step 7: Start SSH dynamic-forward layer if enabled
+	if a.sshClient != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := a.sshClient.Run(a.ctx); err != nil {
+				log.Printf("SSH client stopped: %v", err)
+			}
+		}()
+	}
+	if a.sshSOCKS != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := a.sshSOCKS.Start(); err != nil {
+				log.Printf("SSH SOCKS5 proxy stopped: %v", err)
+			}
+		}()
+	}
+
+	// Step 8: Start built-in SOCKS5 server if enabled
+	if a.socksServer != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := a.socksServer.Start(); err != nil {
+				log.Printf("SOCKS5 server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Step 9: Start HTTP proxy if enabled
+	if a.httpProxy != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := a.httpProxy.Start(); err != nil {
+				log.Printf("HTTP proxy stopped: %v", err)
+			}
+		}()
+	}
+
+	// Step 10: Start UDP-over-TCP listener if enabled
+	if a.uotClient != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if err := a.uotClient.Run(a.ctx); err != nil {
+				log.Printf("UDP-over-TCP listener stopped: %v", err)
+			}
+		}()
+	}
+
+	// Step 11: Start health monitor in goroutine
 	a.wg.Add(1)
 	go func() {
 		defer a.wg.Done()
@@ -123,7 +267,7 @@ func (a *App) Run() error {
 		}
 	}()
 
-	// Step 6: Start background scanner if interval configured
+	// Step 12: Start background scanner if interval configured
 	if a.config.Scanner.Enabled && a.config.Scanner.BackgroundInterval > 0 {
 		a.wg.Add(1)
 		go func() {
@@ -132,7 +276,25 @@ func (a *App) Run() error {
 		}()
 	}
 
-	// Step 7: Start periodic Cloudflare TXT refresh
+	// Step 13: Re-probe quarantined resolvers once their cooldown expires
+	if a.config.Pool.CooldownBase > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.scanner.StartReprobe(a.ctx, reprobeInterval(a.config.Pool.CooldownBase))
+		}()
+	}
+
+	// Step 14: Benchmark resolver capacity for ranking
+	if a.config.Scanner.BenchmarkInterval > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.scanner.StartBenchmark(a.ctx, a.config.Scanner.BenchmarkInterval)
+		}()
+	}
+
+	// Step 15: Start periodic Cloudflare TXT refresh
 	if a.cfClient.IsEnabled() {
 		a.wg.Add(1)
 		go func() {
@@ -141,14 +303,32 @@ func (a *App) Run() error {
 		}()
 	}
 
-	// Step 8: Start disconnect handler
+	// Step 16: Periodically save pool state
+	if a.config.Pool.StateFile != "" {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.periodicStateSave()
+		}()
+	}
+
+	// Step 17: Watch pubkey file for server key rotation
+	if a.config.Tunnel.PubKeyFile != "" && a.config.Tunnel.PubKeyReloadInterval > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.tunnelMgr.WatchPubKey(a.ctx, a.config.Tunnel.PubKeyReloadInterval)
+		}()
+	}
+
+	// Step 18: Start disconnect handler
 	a.wg.Add(1)
 	go func() {
 		defer a.wg.Done()
 		a.handleDisconnects()
 	}()
 
-	// Step 9: Block until shutdown signal
+	// Step 19: Block until shutdown signal
 	return a.waitForShutdown()
 }
 
@@ -177,10 +357,19 @@ func (a *App) handleDisconnect() {
 		log.Printf("Marked resolver %s as blocked", current.Address)
 	}
 
-	// Step 2: Get next resolver from pool
+	// Step 2: Switch to a warm standby session if one is running
+	if a.tunnelMgr.Failover() {
+		a.healthMon.Reset()
+		if r := a.tunnelMgr.CurrentResolver(); r != nil {
+			log.Printf("Switched to standby resolver %s", r.Address)
+		}
+		return
+	}
+
+	// Step 3: Get next resolver from pool
 	next := a.resolverPool.Next()
 	if next == nil || a.resolverPool.IsExhausted() {
-		// Step 3: Pool exhausted, trigger scan
+		// Step 4: Pool exhausted, trigger scan
 		log.Printf("Resolver pool exhausted, triggering new scan...")
 		if a.config.Scanner.Enabled {
 			working, err := a.scanner.ScanFromSources(a.ctx)
@@ -192,7 +381,7 @@ func (a *App) handleDisconnect() {
 				log.Printf("No working resolvers found")
 				return
 			}
-			next = a.resolverPool.Get()
+			next = a.resolverPool.Select()
 		}
 	}
 
@@ -201,7 +390,7 @@ func (a *App) handleDisconnect() {
 		return
 	}
 
-	// Step 4: Reconnect with new resolver
+	// Step 5: Reconnect with new resolver
 	log.Printf("Attempting reconnection with resolver: %s", next.Address)
 	if err := a.tunnelMgr.Connect(next); err != nil {
 		log.Printf("Reconnection failed: %v", err)
@@ -210,7 +399,7 @@ func (a *App) handleDisconnect() {
 		return
 	}
 
-	// Step 5: Reset health monitor after successful reconnection
+	// Step 6: Reset health monitor after successful reconnection
 	a.healthMon.Reset()
 	log.Printf("Successfully reconnected to %s", next.Address)
 }
@@ -247,13 +436,39 @@ func (a *App) periodicTXTRefresh() {
 				continue
 			}
 			for _, r := range resolvers {
-				a.resolverPool.Add(r, a.config.Tunnel.ResolverType)
+				a.resolverPool.AddFrom(r, resolver.TypeForAddress(r, a.config.Tunnel.ResolverType), resolver.OriginTXT)
 			}
 			log.Printf("TXT refresh: added %d resolvers", len(resolvers))
 		}
 	}
 }
 
+// reprobeInterval returns how often quarantined resolvers are checked
+// for an expired cooldown.
+func reprobeInterval(base time.Duration) time.Duration {
+	if base < 30*time.Second {
+		return base
+	}
+	return 30 * time.Second
+}
+
+// periodicStateSave writes pool state to disk at the configured interval.
+func (a *App) periodicStateSave() {
+	ticker := time.NewTicker(a.config.Pool.SaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.resolverPool.Save(a.config.Pool.StateFile); err != nil {
+				log.Printf("Failed to save pool state: %v", err)
+			}
+		}
+	}
+}
+
 // Shutdown gracefully shuts down all components.
 func (a *App) Shutdown() error {
 	log.Printf("Shutting down dns-tunnel...")
@@ -273,6 +488,27 @@ func (a *App) Shutdown() error {
 		}
 	}
 
+	// Stop SOCKS5 servers
+	if a.socksServer != nil {
+		if err := a.socksServer.Stop(); err != nil {
+			log.Printf("Error stopping SOCKS5 server: %v", err)
+		}
+	}
+	if a.sshSOCKS != nil {
+		if err := a.sshSOCKS.Stop(); err != nil {
+			log.Printf("Error stopping SSH SOCKS5 proxy: %v", err)
+		}
+	}
+
+	// Stop HTTP proxy
+	if a.httpProxy != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := a.httpProxy.Stop(ctx); err != nil {
+			log.Printf("Error stopping HTTP proxy: %v", err)
+		}
+	}
+
 	// Disconnect tunnel
 	if err := a.tunnelMgr.Shutdown(); err != nil {
 		log.Printf("Error shutting down tunnel: %v", err)
@@ -281,6 +517,13 @@ func (a *App) Shutdown() error {
 	// Wait for all goroutines to finish
 	a.wg.Wait()
 
+	// Save final pool state
+	if a.config.Pool.StateFile != "" {
+		if err := a.resolverPool.Save(a.config.Pool.StateFile); err != nil {
+			log.Printf("Failed to save pool state: %v", err)
+		}
+	}
+
 	log.Printf("Shutdown complete")
 	return nil
 }
@@ -4,10 +4,16 @@ package config
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/fingerprint"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/profile"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
 )
 
 // Config represents the unified configuration for dns-tunnel.
@@ -18,6 +24,9 @@ type Config struct {
 	// Scanner configuration
 	Scanner ScannerConfig `yaml:"scanner"`
 
+	// Resolver pool configuration
+	Pool PoolConfig `yaml:"pool"`
+
 	// Health monitoring configuration
 	Health HealthConfig `yaml:"health"`
 
@@ -27,6 +36,21 @@ type Config struct {
 	// API server configuration
 	API APIConfig `yaml:"api"`
 
+	// Built-in SOCKS5 server configuration
+	SOCKS SOCKSConfig `yaml:"socks"`
+
+	// SSH dynamic-forward configuration
+	SSH SSHConfig `yaml:"ssh"`
+
+	// HTTP forward proxy configuration
+	HTTPProxy HTTPProxyConfig `yaml:"http_proxy"`
+
+	// UDP-over-TCP configuration
+	UDPOverTCP UDPOverTCPConfig `yaml:"udp_over_tcp"`
+
+	// Server-side configuration (used by `dns-tunnel server`)
+	Server ServerConfig `yaml:"server"`
+
 	// Logging configuration
 	Log LogConfig `yaml:"log"`
 }
@@ -40,9 +64,170 @@ type APIConfig struct {
 	Port int `yaml:"port"`
 }
 
+// Tunnel modes select how the dnstt client is run.
+const (
+	// TunnelModeSubprocess runs the external dnstt-client executable.
+	TunnelModeSubprocess = "subprocess"
+
+	// TunnelModeEmbedded runs the dnstt client in-process.
+	TunnelModeEmbedded = "embedded"
+)
+
+// Health probes select what a health check does. Probe accepts the
+// handshake, connect, ssh and echo probes; Checks accepts them all.
+const (
+	// HealthProbeHandshake only checks that the local proxy answers a
+	// SOCKS5 greeting; dnstt-client answers even when the tunnel is dead.
+	HealthProbeHandshake = "handshake"
+
+	// HealthProbeConnect sends a SOCKS5 CONNECT to the target through
+	// the proxy dnstt-server forwards to.
+	HealthProbeConnect = "connect"
+
+	// HealthProbeSSH reads the banner of the SSH server dnstt-server
+	// forwards to.
+	HealthProbeSSH = "ssh"
+
+	// HealthProbeEcho sends random bytes to the echo service at the
+	// target through the server-side SOCKS5 proxy and expects them back.
+	HealthProbeEcho = "echo"
+
+	// HealthProbeProcess checks that the tunnel session is running.
+	HealthProbeProcess = "process"
+
+	// HealthProbePort checks that the tunnel's local address accepts
+	// TCP connections.
+	HealthProbePort = "port"
+
+	// HealthProbeHTTP fetches a URL through the server-side SOCKS5 proxy.
+	HealthProbeHTTP = "http"
+
+	// HealthProbeDNS queries the current resolver directly, outside the
+	// tunnel.
+	HealthProbeDNS = "dns"
+
+	// HealthProbeExec runs a command; exit status 0 is healthy.
+	HealthProbeExec = "exec"
+)
+
+// Health policies combine the results of several checks.
+const (
+	// HealthPolicyAll passes when every check passes.
+	HealthPolicyAll = "all"
+
+	// HealthPolicyAny passes when at least one check passes.
+	HealthPolicyAny = "any"
+
+	// HealthPolicyWeighted passes when the passing checks' share of the
+	// total weight reaches PassWeight.
+	HealthPolicyWeighted = "weighted"
+)
+
+// SOCKSConfig contains settings for the built-in SOCKS5 server.
+type SOCKSConfig struct {
+	// Enabled determines if the SOCKS5 server should start
+	Enabled bool `yaml:"enabled"`
+
+	// Listen is the address to accept SOCKS5 clients on (e.g., 0.0.0.0:1080)
+	Listen string `yaml:"listen"`
+
+	// Users enables RFC 1929 username/password auth when non-empty
+	Users []SOCKSUser `yaml:"users"`
+
+	// UpstreamUsername and UpstreamPassword authenticate to the SOCKS5
+	// proxy on the server side of the tunnel (optional)
+	UpstreamUsername string `yaml:"upstream_username"`
+	UpstreamPassword string `yaml:"upstream_password"`
+
+	// HandshakeTimeout limits how long a client may take to authenticate
+	HandshakeTimeout time.Duration `yaml:"handshake_timeout"`
+
+	// DialTimeout limits how long a CONNECT through the tunnel may take
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+
+	// UDPRelay is the address of the server's UDP relay (server.udp_relay)
+	// as reached through the tunnel; UDP ASSOCIATE is refused when empty
+	UDPRelay string `yaml:"udp_relay"`
+}
+
+// SOCKSUser is a SOCKS5 username/password pair.
+type SOCKSUser struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// SSHConfig contains settings for the SSH dynamic-forward layer that
+// runs over the tunnel when dnstt-server forwards to an SSH server.
+type SSHConfig struct {
+	// Enabled determines if the SSH layer should start
+	Enabled bool `yaml:"enabled"`
+
+	// User is the SSH login name
+	User string `yaml:"user"`
+
+	// KeyFile is the path to the private key used for authentication
+	KeyFile string `yaml:"key_file"`
+
+	// KeyPassphrase decrypts KeyFile if it is encrypted (optional)
+	KeyPassphrase string `yaml:"key_passphrase"`
+
+	// KnownHostsFile is an OpenSSH known_hosts file to verify the server
+	KnownHostsFile string `yaml:"known_hosts_file"`
+
+	// HostKeyFingerprint pins the server host key (e.g., "SHA256:...")
+	HostKeyFingerprint string `yaml:"host_key_fingerprint"`
+
+	// HostKeyAlias is the host name looked up in KnownHostsFile
+	// (defaults to tunnel.local_addr, e.g. "[127.0.0.1]:7000")
+	HostKeyAlias string `yaml:"host_key_alias"`
+
+	// SOCKSListen is the address of the SOCKS5 proxy served over SSH
+	// (like ssh -D); empty disables it
+	SOCKSListen string `yaml:"socks_listen"`
+
+	// ConnectTimeout limits the TCP connect and SSH handshake over the tunnel
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+
+	// KeepAlive is the interval between SSH keepalive requests (0 disables)
+	KeepAlive time.Duration `yaml:"keepalive"`
+}
+
+// HTTPProxyConfig contains settings for the HTTP forward proxy.
+type HTTPProxyConfig struct {
+	// Enabled determines if the HTTP proxy should start
+	Enabled bool `yaml:"enabled"`
+
+	// Listen is the address to accept proxy clients on (e.g., 127.0.0.1:8118)
+	Listen string `yaml:"listen"`
+
+	// DialTimeout limits how long a connection through the tunnel may take
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+
+	// PACBypass lists hosts sent DIRECT by /proxy.pac: CIDR blocks,
+	// domain suffixes (".ir") or exact host names
+	PACBypass []string `yaml:"pac_bypass"`
+
+	// PACProxyHost overrides the proxy host written into /proxy.pac
+	PACProxyHost string `yaml:"pac_proxy_host"`
+}
+
+// UDPOverTCPConfig contains settings for carrying UDP (e.g., WireGuard)
+// over the tunnel. The server side must run `dns-tunnel uot-server`
+// as the dnstt-server target.
+type UDPOverTCPConfig struct {
+	// Enabled determines if the UDP listener should start
+	Enabled bool `yaml:"enabled"`
+
+	// Listen is the local UDP address to accept datagrams on (e.g., 127.0.0.1:51820)
+	Listen string `yaml:"listen"`
+}
+
 // TunnelConfig contains tunnel-specific settings.
 type TunnelConfig struct {
-	// DnsttPath is the path to dnstt-client executable
+	// Mode selects how the dnstt client is run: "subprocess" or "embedded"
+	Mode string `yaml:"mode"`
+
+	// DnsttPath is the path to dnstt-client executable (subprocess mode)
 	DnsttPath string `yaml:"dnstt_path"`
 
 	// Domain is the tunnel domain (e.g., t.example.com)
@@ -54,9 +239,15 @@ type TunnelConfig struct {
 	// PubKeyFile is the path to the server's public key file
 	PubKeyFile string `yaml:"pubkey_file"`
 
+	// PubKeyReloadInterval is how often PubKeyFile is checked for changes (0 disables)
+	PubKeyReloadInterval time.Duration `yaml:"pubkey_reload_interval"`
+
 	// LocalAddr is the local address to listen on (e.g., 127.0.0.1:7000)
 	LocalAddr string `yaml:"local_addr"`
 
+	// Resolvers are seed resolvers added to the pool at startup
+	Resolvers []string `yaml:"resolvers"`
+
 	// ResolverType is the DNS resolver type: "doh", "dot", or "udp"
 	ResolverType string `yaml:"resolver_type"`
 
@@ -65,6 +256,73 @@ type TunnelConfig struct {
 
 	// IdleTimeout is the timeout for idle connections
 	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// Standby is the number of warm standby sessions kept running on other
+	// healthy resolvers (0 disables; LocalAddr then belongs to dnstt-client)
+	Standby int `yaml:"standby"`
+
+	// StandbyBasePort is the first internal port used by sessions when
+	// standby is enabled
+	StandbyBasePort int `yaml:"standby_base_port"`
+
+	// Bonding spreads new connections across the active and all standby
+	// sessions instead of keeping standbys idle (requires standby > 0)
+	Bonding bool `yaml:"bonding"`
+}
+
+// ServerConfig contains settings for `dns-tunnel server`, which
+// supervises dnstt-server on the tunnel's server side.
+type ServerConfig struct {
+	// DnsttServerPath is the path to the dnstt-server executable
+	DnsttServerPath string `yaml:"dnstt_server_path"`
+
+	// Domain is the tunnel domain delegated to this server (e.g., t.example.com)
+	Domain string `yaml:"domain"`
+
+	// Listen is the UDP address dnstt-server accepts DNS queries on
+	Listen string `yaml:"listen"`
+
+	// PrivKeyFile and PubKeyFile hold the tunnel keypair; both are
+	// generated on first start if missing
+	PrivKeyFile string `yaml:"privkey_file"`
+	PubKeyFile  string `yaml:"pubkey_file"`
+
+	// Upstream is the TCP address tunnel streams are forwarded to
+	Upstream string `yaml:"upstream"`
+
+	// UDPForward, if set, runs the UDP-over-TCP relay on Upstream and
+	// forwards datagrams to this UDP address (e.g., WireGuard on 127.0.0.1:51820)
+	UDPForward string `yaml:"udp_forward"`
+
+	// MTU is the maximum DNS response payload size (0 uses dnstt's default)
+	MTU int `yaml:"mtu"`
+
+	// HealthEcho, if set, runs a TCP echo service on this address for
+	// clients' echo health probes (e.g., 127.0.0.1:7007)
+	HealthEcho string `yaml:"health_echo"`
+
+	// UDPRelay, if set, runs the relay for clients' SOCKS5 UDP ASSOCIATE
+	// on this TCP address (e.g., 127.0.0.1:5356)
+	UDPRelay string `yaml:"udp_relay"`
+
+	// RestartDelay is the wait before restarting dnstt-server after it exits
+	RestartDelay time.Duration `yaml:"restart_delay"`
+
+	// Echo answers the scanner's tunnel-compatibility probes
+	Echo EchoConfig `yaml:"echo"`
+
+	// API configures the server status endpoints
+	API APIConfig `yaml:"api"`
+}
+
+// EchoConfig contains the probe echo responder settings. When enabled the
+// responder takes over Listen and relays tunnel queries to dnstt-server.
+type EchoConfig struct {
+	// Enabled determines if the echo responder runs in front of dnstt-server
+	Enabled bool `yaml:"enabled"`
+
+	// DnsttListen is the internal UDP address dnstt-server listens on
+	DnsttListen string `yaml:"dnstt_listen"`
 }
 
 // ScannerConfig contains scanner-specific settings.
@@ -75,15 +333,27 @@ type ScannerConfig struct {
 	// ConcurrentScans is the number of concurrent resolver scans
 	ConcurrentScans int `yaml:"concurrent_scans"`
 
+	// RateLimit caps scan queries sent per second (0 = unlimited)
+	RateLimit int `yaml:"rate_limit"`
+
+	// SubnetInterval is the minimum gap between queries to addresses in
+	// the same /24 (/48 for IPv6) (0 = none)
+	SubnetInterval time.Duration `yaml:"subnet_interval"`
+
 	// Timeout is the timeout for each resolver scan
 	Timeout time.Duration `yaml:"timeout"`
 
 	// MinResolvers is the minimum number of working resolvers to find
 	MinResolvers int `yaml:"min_resolvers"`
 
-	// ResolverSources is a list of sources to fetch resolver lists from
+	// ResolverSources is a list of sources to fetch resolver lists from:
+	// http(s) URLs, file:// URLs or paths; plain, CSV or JSON lists
 	ResolverSources []string `yaml:"resolver_sources"`
 
+	// MinSourceReliability drops list entries whose reliability column
+	// (public-dns.info CSV/JSON) is below this value
+	MinSourceReliability float64 `yaml:"min_source_reliability"`
+
 	// BackgroundInterval is the interval between background scans
 	BackgroundInterval time.Duration `yaml:"background_interval"`
 
@@ -92,6 +362,85 @@ type ScannerConfig struct {
 
 	// MaxCandidates limits the number of IPs to scan from country ranges
 	MaxCandidates int `yaml:"max_candidates"`
+
+	// CIDRSampling chooses which addresses of the country ranges to scan
+	CIDRSampling CIDRSamplingConfig `yaml:"cidr_sampling"`
+
+	// ResponsiveCache is where addresses that answered are kept, so later
+	// scans start from them (empty disables)
+	ResponsiveCache string `yaml:"responsive_cache"`
+
+	// CheckpointFile is where an interrupted scan's progress is saved, so
+	// the next scan resumes from it (empty disables)
+	CheckpointFile string `yaml:"checkpoint_file"`
+
+	// ControlResolvers are trusted resolvers (DoH URLs work best) whose
+	// answers candidates must agree with; empty (the default) disables the
+	// comparison
+	ControlResolvers []string `yaml:"control_resolvers"`
+
+	// FilterDomains are commonly censored names used to tag resolvers
+	// that filter them (none by default)
+	FilterDomains []string `yaml:"filter_domains"`
+
+	// CuratedEncrypted scans a built-in list of well-known DoH and DoT
+	// resolvers after the plain builtin ones (off by default)
+	CuratedEncrypted bool `yaml:"curated_encrypted"`
+
+	// ProbeEncrypted also tries every IP candidate as a DoH server on 443
+	// (/dns-query) and a DoT server on 853
+	ProbeEncrypted bool `yaml:"probe_encrypted"`
+
+	// BenchmarkInterval is how often pool UDP resolvers' capacity (query
+	// rate, response size, truncation, TCP) is measured for ranking;
+	// needs TunnelProbe (0 disables)
+	BenchmarkInterval time.Duration `yaml:"benchmark_interval"`
+
+	// TunnelProbe also requires candidates to carry long random TXT
+	// queries to the server's echo responder under tunnel.domain
+	TunnelProbe bool `yaml:"tunnel_probe"`
+}
+
+// CIDRSamplingConfig contains country-range sampling settings.
+type CIDRSamplingConfig struct {
+	// Strategy is "first" (network+1), "random" (PerBlock random hosts),
+	// "offsets" (Offsets in PerBlock random /24s) or "weighted" (random
+	// hosts, blocks picked in proportion to their size)
+	Strategy string `yaml:"strategy"`
+
+	// PerBlock is the number of hosts or /24 subnets sampled per block
+	PerBlock int `yaml:"per_block"`
+
+	// Offsets are the last-octet values tried by the "offsets" strategy
+	Offsets []int `yaml:"offsets"`
+}
+
+// PoolConfig contains resolver pool settings.
+type PoolConfig struct {
+	// StateFile is where pool state is saved across restarts (empty disables)
+	StateFile string `yaml:"state_file"`
+
+	// StateMaxAge drops saved resolvers not seen for this long (0 keeps all)
+	StateMaxAge time.Duration `yaml:"state_max_age"`
+
+	// SaveInterval is how often pool state is written to StateFile
+	SaveInterval time.Duration `yaml:"save_interval"`
+
+	// CooldownBase is how long a blocked resolver stays quarantined before
+	// it is re-probed; each repeated block doubles it (0, the default,
+	// blocks permanently)
+	CooldownBase time.Duration `yaml:"cooldown_base"`
+
+	// CooldownMax caps the quarantine cooldown
+	CooldownMax time.Duration `yaml:"cooldown_max"`
+
+	// Strategy selects the next resolver on failover: "round-robin",
+	// "lowest-latency", "weighted-random" or "ewma"
+	Strategy string `yaml:"strategy"`
+
+	// AddressFamily is "prefer-v4", "prefer-v6" or "both": which resolvers
+	// are selected first and which country ranges are scanned first
+	AddressFamily string `yaml:"address_family"`
 }
 
 // HealthConfig contains health monitoring settings.
@@ -107,6 +456,48 @@ type HealthConfig struct {
 
 	// Timeout is the timeout for each health check
 	Timeout time.Duration `yaml:"timeout"`
+
+	// Probe is what each check does through the tunnel (HealthProbe* constants)
+	Probe string `yaml:"probe"`
+
+	// ProbeTarget is the host:port the connect and echo probes reach
+	// through the server-side SOCKS5 proxy
+	ProbeTarget string `yaml:"probe_target"`
+
+	// Checks replaces Probe with several checks run together (optional)
+	Checks []HealthCheckConfig `yaml:"checks"`
+
+	// Policy combines the results of Checks (HealthPolicy* constants)
+	Policy string `yaml:"policy"`
+
+	// PassWeight is the share of the total weight that must pass under
+	// the weighted policy (0-1)
+	PassWeight float64 `yaml:"pass_weight"`
+
+	// DecodeErrorThreshold is the number of dnstt decode errors within one
+	// check interval after which the resolver is treated as corrupting
+	DecodeErrorThreshold int `yaml:"decode_error_threshold"`
+}
+
+// HealthCheckConfig is one check of a health check set.
+type HealthCheckConfig struct {
+	// Type is the probe to run (HealthProbe* constants)
+	Type string `yaml:"type"`
+
+	// Weight counts towards PassWeight under the weighted policy (default 1)
+	Weight float64 `yaml:"weight"`
+
+	// Target is the host:port for connect and echo, or the name to look
+	// up for dns
+	Target string `yaml:"target"`
+
+	// URL is fetched by the http check
+	URL string `yaml:"url"`
+
+	// Command is run by the exec check, with the tunnel's local address
+	// and resolver in DNS_TUNNEL_PROXY, DNS_TUNNEL_RESOLVER and
+	// DNS_TUNNEL_RESOLVER_TYPE
+	Command []string `yaml:"command"`
 }
 
 // CloudflareConfig contains Cloudflare DNS settings.
@@ -140,25 +531,49 @@ type LogConfig struct {
 func DefaultConfig() *Config {
 	return &Config{
 		Tunnel: TunnelConfig{
+			Mode:            TunnelModeSubprocess,
 			LocalAddr:       "127.0.0.1:7000",
 			ResolverType:    "udp",
 			UTLSFingerprint: "4*random,3*Firefox_120,1*Firefox_105,3*Chrome_120",
 			IdleTimeout:     2 * time.Minute,
+
+			PubKeyReloadInterval: 30 * time.Second,
+			StandbyBasePort:      17000,
 		},
 		Scanner: ScannerConfig{
-			Enabled:            true,
-			ConcurrentScans:    10,
-			Timeout:            5 * time.Second,
-			MinResolvers:       3,
-			BackgroundInterval: 5 * time.Minute,
-			CountryCode:        "",
-			MaxCandidates:      1000,
+			Enabled:              true,
+			ConcurrentScans:      10,
+			Timeout:              5 * time.Second,
+			MinResolvers:         3,
+			BackgroundInterval:   5 * time.Minute,
+			CountryCode:          "",
+			MaxCandidates:        1000,
+			MinSourceReliability: 0.5,
+			CIDRSampling: CIDRSamplingConfig{
+				Strategy: "first",
+				PerBlock: 2,
+				Offsets:  []int{1, 2, 53, 254},
+			},
+		},
+		Pool: PoolConfig{
+			StateMaxAge:  7 * 24 * time.Hour,
+			SaveInterval: time.Minute,
+			CooldownMax:  time.Hour,
+			Strategy:     resolver.StrategyRoundRobin,
+
+			AddressFamily: resolver.FamilyPreferV4,
 		},
 		Health: HealthConfig{
 			CheckInterval:     10 * time.Second,
 			FailThreshold:     3,
 			RecoveryThreshold: 1,
 			Timeout:           5 * time.Second,
+			Probe:             HealthProbeHandshake,
+			ProbeTarget:       "1.1.1.1:443",
+			Policy:            HealthPolicyAll,
+			PassWeight:        0.5,
+
+			DecodeErrorThreshold: 3,
 		},
 		Cloudflare: CloudflareConfig{
 			Enabled: false,
@@ -167,6 +582,49 @@ func DefaultConfig() *Config {
 			Enabled: false,
 			Port:    8080,
 		},
+		SOCKS: SOCKSConfig{
+			Enabled:          false,
+			Listen:           "127.0.0.1:1080",
+			HandshakeTimeout: 10 * time.Second,
+			DialTimeout:      30 * time.Second,
+		},
+		SSH: SSHConfig{
+			Enabled:        false,
+			SOCKSListen:    "127.0.0.1:1080",
+			ConnectTimeout: 60 * time.Second,
+			KeepAlive:      30 * time.Second,
+		},
+		HTTPProxy: HTTPProxyConfig{
+			Enabled:     false,
+			Listen:      "127.0.0.1:8118",
+			DialTimeout: 30 * time.Second,
+			PACBypass: []string{
+				"localhost",
+				"127.0.0.0/8",
+				"10.0.0.0/8",
+				"172.16.0.0/12",
+				"192.168.0.0/16",
+			},
+		},
+		UDPOverTCP: UDPOverTCPConfig{
+			Enabled: false,
+			Listen:  "127.0.0.1:51820",
+		},
+		Server: ServerConfig{
+			Listen:       ":53",
+			PrivKeyFile:  "dnstt-server.key",
+			PubKeyFile:   "dnstt-server.pub",
+			Upstream:     "127.0.0.1:5555",
+			RestartDelay: 5 * time.Second,
+			Echo: EchoConfig{
+				Enabled:     true,
+				DnsttListen: "127.0.0.1:5300",
+			},
+			API: APIConfig{
+				Enabled: false,
+				Port:    8081,
+			},
+		},
 		Log: LogConfig{
 			Level:  "info",
 			Format: "text",
@@ -174,8 +632,69 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load reads configuration from a YAML file.
-func Load(path string) (*Config, error) {
+// Load reads configuration from a YAML file. path may also be a signed
+// client profile (a YAML bundle or a dnstunnel:// URI), which is only
+// accepted when signed by the key with fingerprint profileSigner.
+func Load(path, profileSigner string) (*Config, error) {
+	var data []byte
+	if strings.HasPrefix(path, profile.URIScheme) {
+		data = []byte(path)
+	} else {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	cfg := DefaultConfig()
+	if profile.IsProfile(data) {
+		p, err := profile.Parse(data, profileSigner)
+		if err != nil {
+			return nil, fmt.Errorf("loading profile: %w", err)
+		}
+		cfg.applyProfile(p)
+	} else if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+
+	// Resolve relative paths
+	cfg.resolvePaths()
+
+	// Load public key from file if configured
+	if err := cfg.loadPubKey(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validating config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// applyProfile fills tunnel settings from a client profile. dnstt-client
+// is looked up in PATH, falling back to the executable's directory.
+func (c *Config) applyProfile(p *profile.Profile) {
+	c.Tunnel.Domain = p.Domain
+	c.Tunnel.PubKey = p.PubKey
+	c.Tunnel.Resolvers = p.Resolvers
+	if p.ResolverType != "" {
+		c.Tunnel.ResolverType = p.ResolverType
+	}
+	if p.UTLSFingerprint != "" {
+		c.Tunnel.UTLSFingerprint = p.UTLSFingerprint
+	}
+	if path, err := exec.LookPath("dnstt-client"); err == nil {
+		c.Tunnel.DnsttPath = path
+	} else {
+		c.Tunnel.DnsttPath = "dnstt-client"
+	}
+}
+
+// LoadServer reads configuration for `dns-tunnel server` from a YAML
+// file. Only the server section is validated.
+func LoadServer(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %w", err)
@@ -186,10 +705,9 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
 
-	// Resolve relative paths
 	cfg.resolvePaths()
 
-	if err := cfg.Validate(); err != nil {
+	if err := cfg.ValidateServer(); err != nil {
 		return nil, fmt.Errorf("validating config: %w", err)
 	}
 
@@ -214,6 +732,40 @@ func (c *Config) resolvePaths() {
 		c.Tunnel.PubKeyFile = filepath.Join(exeDir, c.Tunnel.PubKeyFile)
 	}
 
+	// Resolve SSH key and known_hosts files if relative
+	if c.SSH.KeyFile != "" && !filepath.IsAbs(c.SSH.KeyFile) {
+		c.SSH.KeyFile = filepath.Join(exeDir, c.SSH.KeyFile)
+	}
+	if c.SSH.KnownHostsFile != "" && !filepath.IsAbs(c.SSH.KnownHostsFile) {
+		c.SSH.KnownHostsFile = filepath.Join(exeDir, c.SSH.KnownHostsFile)
+	}
+
+	// Resolve server-side paths if relative
+	if c.Server.DnsttServerPath != "" && !filepath.IsAbs(c.Server.DnsttServerPath) {
+		c.Server.DnsttServerPath = filepath.Join(exeDir, c.Server.DnsttServerPath)
+	}
+	if c.Server.PrivKeyFile != "" && !filepath.IsAbs(c.Server.PrivKeyFile) {
+		c.Server.PrivKeyFile = filepath.Join(exeDir, c.Server.PrivKeyFile)
+	}
+	if c.Server.PubKeyFile != "" && !filepath.IsAbs(c.Server.PubKeyFile) {
+		c.Server.PubKeyFile = filepath.Join(exeDir, c.Server.PubKeyFile)
+	}
+
+	// Resolve pool state file if relative
+	if c.Pool.StateFile != "" && !filepath.IsAbs(c.Pool.StateFile) {
+		c.Pool.StateFile = filepath.Join(exeDir, c.Pool.StateFile)
+	}
+
+	// Resolve scanner responsive cache if relative
+	if c.Scanner.ResponsiveCache != "" && !filepath.IsAbs(c.Scanner.ResponsiveCache) {
+		c.Scanner.ResponsiveCache = filepath.Join(exeDir, c.Scanner.ResponsiveCache)
+	}
+
+	// Resolve scanner checkpoint file if relative
+	if c.Scanner.CheckpointFile != "" && !filepath.IsAbs(c.Scanner.CheckpointFile) {
+		c.Scanner.CheckpointFile = filepath.Join(exeDir, c.Scanner.CheckpointFile)
+	}
+
 	// Resolve log file if relative
 	if c.Log.File != "" && !filepath.IsAbs(c.Log.File) {
 		c.Log.File = filepath.Join(exeDir, c.Log.File)
@@ -230,10 +782,91 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("tunnel.pubkey or tunnel.pubkey_file is required")
 	}
 
+	if c.Tunnel.PubKey != "" {
+		key, err := ParsePubKey(c.Tunnel.PubKey)
+		if err != nil {
+			return fmt.Errorf("tunnel.pubkey: %w", err)
+		}
+		c.Tunnel.PubKey = key
+	}
+
 	if c.Tunnel.LocalAddr == "" {
 		return fmt.Errorf("tunnel.local_addr is required")
 	}
 
+	switch c.Tunnel.Mode {
+	case TunnelModeSubprocess:
+		if c.Tunnel.DnsttPath == "" {
+			return fmt.Errorf("tunnel.dnstt_path is required in %s mode", c.Tunnel.Mode)
+		}
+	case TunnelModeEmbedded:
+		if _, err := fingerprint.Parse(c.Tunnel.UTLSFingerprint); err != nil {
+			return fmt.Errorf("tunnel.utls_fingerprint: %w", err)
+		}
+	default:
+		return fmt.Errorf("tunnel.mode must be '%s' or '%s'", TunnelModeSubprocess, TunnelModeEmbedded)
+	}
+
+	if c.Tunnel.Standby < 0 {
+		return fmt.Errorf("tunnel.standby must not be negative")
+	}
+	if c.Tunnel.Bonding && c.Tunnel.Standby == 0 {
+		return fmt.Errorf("tunnel.bonding requires tunnel.standby > 0")
+	}
+	if c.Tunnel.Standby > 0 && (c.Tunnel.StandbyBasePort <= 0 || c.Tunnel.StandbyBasePort > 65535) {
+		return fmt.Errorf("tunnel.standby_base_port must be a valid port")
+	}
+
+	if c.Scanner.BenchmarkInterval > 0 && !c.Scanner.TunnelProbe {
+		return fmt.Errorf("scanner.benchmark_interval requires scanner.tunnel_probe")
+	}
+	if c.Scanner.ConcurrentScans < 1 {
+		return fmt.Errorf("scanner.concurrent_scans must be at least 1")
+	}
+	if c.Scanner.RateLimit < 0 {
+		return fmt.Errorf("scanner.rate_limit must not be negative")
+	}
+	if c.Scanner.SubnetInterval < 0 {
+		return fmt.Errorf("scanner.subnet_interval must not be negative")
+	}
+
+	switch c.Scanner.CIDRSampling.Strategy {
+	case "first", "random", "offsets", "weighted":
+		// valid
+	default:
+		return fmt.Errorf("scanner.cidr_sampling.strategy must be 'first', 'random', 'offsets', or 'weighted'")
+	}
+	if c.Scanner.CIDRSampling.PerBlock < 1 {
+		return fmt.Errorf("scanner.cidr_sampling.per_block must be at least 1")
+	}
+	for _, off := range c.Scanner.CIDRSampling.Offsets {
+		if off < 0 || off > 255 {
+			return fmt.Errorf("scanner.cidr_sampling.offsets must be between 0 and 255")
+		}
+	}
+	if c.Scanner.CIDRSampling.Strategy == "offsets" && len(c.Scanner.CIDRSampling.Offsets) == 0 {
+		return fmt.Errorf("scanner.cidr_sampling.offsets is required for the offsets strategy")
+	}
+
+	if c.Pool.StateFile != "" && c.Pool.SaveInterval <= 0 {
+		return fmt.Errorf("pool.save_interval must be positive when pool.state_file is set")
+	}
+
+	if _, err := resolver.NewStrategy(c.Pool.Strategy); err != nil {
+		return fmt.Errorf("pool.strategy: %w", err)
+	}
+	if !resolver.ValidFamily(c.Pool.AddressFamily) {
+		return fmt.Errorf("pool.address_family must be '%s', '%s', or '%s'",
+			resolver.FamilyPreferV4, resolver.FamilyPreferV6, resolver.FamilyBoth)
+	}
+
+	if c.Pool.CooldownBase < 0 {
+		return fmt.Errorf("pool.cooldown_base must not be negative")
+	}
+	if c.Pool.CooldownBase > 0 && c.Pool.CooldownMax < c.Pool.CooldownBase {
+		return fmt.Errorf("pool.cooldown_max must be at least pool.cooldown_base")
+	}
+
 	switch c.Tunnel.ResolverType {
 	case "doh", "dot", "udp":
 		// valid
@@ -241,5 +874,165 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("tunnel.resolver_type must be 'doh', 'dot', or 'udp'")
 	}
 
+	if c.Health.Timeout <= 0 {
+		return fmt.Errorf("health.timeout must be positive")
+	}
+	if len(c.Health.Checks) == 0 {
+		switch c.Health.Probe {
+		case HealthProbeHandshake, HealthProbeConnect, HealthProbeSSH, HealthProbeEcho:
+			probe := HealthCheckConfig{Type: c.Health.Probe, Target: c.Health.ProbeTarget}
+			if err := c.validateHealthCheck("health.probe", probe); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("health.probe must be '%s', '%s', '%s', or '%s'",
+				HealthProbeHandshake, HealthProbeConnect, HealthProbeSSH, HealthProbeEcho)
+		}
+	}
+	for i, check := range c.Health.Checks {
+		if err := c.validateHealthCheck(fmt.Sprintf("health.checks[%d]", i), check); err != nil {
+			return err
+		}
+	}
+	switch c.Health.Policy {
+	case HealthPolicyAll, HealthPolicyAny:
+		// valid
+	case HealthPolicyWeighted:
+		if c.Health.PassWeight <= 0 || c.Health.PassWeight > 1 {
+			return fmt.Errorf("health.pass_weight must be in (0, 1]")
+		}
+	default:
+		return fmt.Errorf("health.policy must be '%s', '%s', or '%s'",
+			HealthPolicyAll, HealthPolicyAny, HealthPolicyWeighted)
+	}
+
+	if c.SOCKS.Enabled {
+		if c.SOCKS.Listen == "" {
+			return fmt.Errorf("socks.listen is required when socks is enabled")
+		}
+		if c.SOCKS.Listen == c.Tunnel.LocalAddr {
+			return fmt.Errorf("socks.listen must differ from tunnel.local_addr")
+		}
+		for i, u := range c.SOCKS.Users {
+			if u.Username == "" || len(u.Username) > 255 || len(u.Password) > 255 {
+				return fmt.Errorf("socks.users[%d]: username required, username and password at most 255 bytes", i)
+			}
+		}
+	}
+
+	if c.HTTPProxy.Enabled {
+		if c.HTTPProxy.Listen == "" {
+			return fmt.Errorf("http_proxy.listen is required when http_proxy is enabled")
+		}
+		if c.HTTPProxy.Listen == c.Tunnel.LocalAddr {
+			return fmt.Errorf("http_proxy.listen must differ from tunnel.local_addr")
+		}
+	}
+
+	if c.UDPOverTCP.Enabled {
+		if c.UDPOverTCP.Listen == "" {
+			return fmt.Errorf("udp_over_tcp.listen is required when udp_over_tcp is enabled")
+		}
+		// The tunnel carries either UDP frames or proxied streams, not both
+		if c.SOCKS.Enabled || c.SSH.Enabled || c.HTTPProxy.Enabled {
+			return fmt.Errorf("udp_over_tcp cannot be combined with socks, ssh or http_proxy")
+		}
+	}
+
+	if c.SSH.Enabled {
+		if c.SSH.User == "" {
+			return fmt.Errorf("ssh.user is required when ssh is enabled")
+		}
+		if c.SSH.KeyFile == "" {
+			return fmt.Errorf("ssh.key_file is required when ssh is enabled")
+		}
+		if c.SSH.KnownHostsFile == "" && c.SSH.HostKeyFingerprint == "" {
+			return fmt.Errorf("ssh.known_hosts_file or ssh.host_key_fingerprint is required to verify the server")
+		}
+		if c.SSH.SOCKSListen != "" {
+			if c.SSH.SOCKSListen == c.Tunnel.LocalAddr {
+				return fmt.Errorf("ssh.socks_listen must differ from tunnel.local_addr")
+			}
+			if c.SOCKS.Enabled && c.SSH.SOCKSListen == c.SOCKS.Listen {
+				return fmt.Errorf("ssh.socks_listen must differ from socks.listen")
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateHealthCheck checks one health check against what the tunnel
+// carries; field names it in errors.
+func (c *Config) validateHealthCheck(field string, check HealthCheckConfig) error {
+	if check.Weight < 0 {
+		return fmt.Errorf("%s: weight must not be negative", field)
+	}
+
+	switch check.Type {
+	case HealthProbeProcess, HealthProbePort, HealthProbeHandshake, HealthProbeDNS:
+		// valid
+	case HealthProbeConnect, HealthProbeEcho, HealthProbeHTTP:
+		if check.Type == HealthProbeHTTP && check.URL == "" {
+			return fmt.Errorf("%s: url is required for the http probe", field)
+		}
+		if check.Type != HealthProbeHTTP && check.Target == "" {
+			return fmt.Errorf("%s: a target is required for the %s probe", field, check.Type)
+		}
+		// These go through a SOCKS5 proxy behind the tunnel
+		if c.SSH.Enabled || c.UDPOverTCP.Enabled {
+			return fmt.Errorf("%s: the %s probe needs a SOCKS5 proxy behind the tunnel, not ssh or udp_over_tcp", field, check.Type)
+		}
+	case HealthProbeSSH:
+		if c.SOCKS.Enabled || c.HTTPProxy.Enabled || c.UDPOverTCP.Enabled {
+			return fmt.Errorf("%s: the ssh probe needs an SSH server behind the tunnel, not socks, http_proxy or udp_over_tcp", field)
+		}
+	case HealthProbeExec:
+		if len(check.Command) == 0 {
+			return fmt.Errorf("%s: command is required for the exec probe", field)
+		}
+	default:
+		return fmt.Errorf("%s: unknown probe type '%s'", field, check.Type)
+	}
+	return nil
+}
+
+// ValidateServer checks the server section for required fields and valid values.
+func (c *Config) ValidateServer() error {
+	s := &c.Server
+
+	if s.DnsttServerPath == "" {
+		return fmt.Errorf("server.dnstt_server_path is required")
+	}
+	if s.Domain == "" {
+		return fmt.Errorf("server.domain is required")
+	}
+	if s.Listen == "" {
+		return fmt.Errorf("server.listen is required")
+	}
+	if s.PrivKeyFile == "" || s.PubKeyFile == "" {
+		return fmt.Errorf("server.privkey_file and server.pubkey_file are required")
+	}
+	if s.Upstream == "" {
+		return fmt.Errorf("server.upstream is required")
+	}
+	if s.MTU < 0 {
+		return fmt.Errorf("server.mtu must not be negative")
+	}
+	if s.HealthEcho != "" && s.HealthEcho == s.Upstream {
+		return fmt.Errorf("server.health_echo must differ from server.upstream")
+	}
+	if s.UDPRelay != "" && (s.UDPRelay == s.Upstream || s.UDPRelay == s.HealthEcho) {
+		return fmt.Errorf("server.udp_relay must differ from server.upstream and server.health_echo")
+	}
+	if s.Echo.Enabled {
+		if s.Echo.DnsttListen == "" {
+			return fmt.Errorf("server.echo.dnstt_listen is required when echo is enabled")
+		}
+		if s.Echo.DnsttListen == s.Listen {
+			return fmt.Errorf("server.echo.dnstt_listen must differ from server.listen")
+		}
+	}
+
 	return nil
 }
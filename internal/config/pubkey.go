@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PubKeyLen is the length of a dnstt server public key in bytes.
+const PubKeyLen = 32
+
+// ParsePubKey validates a dnstt public key given as a hex string.
+// It returns the normalized (lowercase, trimmed) key.
+func ParsePubKey(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) != PubKeyLen*2 {
+		return "", fmt.Errorf("public key must be %d hex characters, got %d", PubKeyLen*2, len(s))
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", fmt.Errorf("public key is not valid hex: %w", err)
+	}
+	return s, nil
+}
+
+// ReadPubKeyFile reads a dnstt public key file.
+// Accepts the format written by "dnstt-server -gen-key -pubkey-file",
+// which is the hex key on a single line. Blank lines and lines starting
+// with '#' are ignored.
+func ReadPubKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading pubkey file: %w", err)
+	}
+
+	var key string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key != "" {
+			return "", fmt.Errorf("pubkey file %s contains more than one key", path)
+		}
+		key = line
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("reading pubkey file: %w", err)
+	}
+	if key == "" {
+		return "", fmt.Errorf("pubkey file %s is empty", path)
+	}
+
+	key, err = ParsePubKey(key)
+	if err != nil {
+		return "", fmt.Errorf("pubkey file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// loadPubKey populates Tunnel.PubKey from Tunnel.PubKeyFile when set.
+// The file takes precedence over an inline pubkey.
+func (c *Config) loadPubKey() error {
+	if c.Tunnel.PubKeyFile == "" {
+		return nil
+	}
+	key, err := ReadPubKeyFile(c.Tunnel.PubKeyFile)
+	if err != nil {
+		return err
+	}
+	c.Tunnel.PubKey = key
+	return nil
+}
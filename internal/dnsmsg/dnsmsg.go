@@ -0,0 +1,340 @@
+// Package dnsmsg encodes and decodes the subset of DNS messages used by the
+// scanner probes and the server-side echo responder.
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Record types.
+const (
+	TypeA     uint16 = 1
+	TypeNS    uint16 = 2
+	TypeCNAME uint16 = 5
+	TypeSOA   uint16 = 6
+	TypeTXT   uint16 = 16
+	TypeAAAA  uint16 = 28
+	TypeOPT   uint16 = 41
+)
+
+// ClassINET is the Internet class.
+const ClassINET uint16 = 1
+
+// Response codes.
+const (
+	RcodeSuccess  = 0
+	RcodeFormErr  = 1
+	RcodeServFail = 2
+	RcodeNXDomain = 3
+	RcodeNotImp   = 4
+	RcodeRefused  = 5
+)
+
+// Header flag bits.
+const (
+	FlagResponse  uint16 = 1 << 15
+	FlagAuthority uint16 = 1 << 10
+	FlagTruncated uint16 = 1 << 9
+	FlagRecursion uint16 = 1 << 8
+	FlagAvailable uint16 = 1 << 7
+)
+
+// headerLen is the fixed DNS header size.
+const headerLen = 12
+
+// ErrShort is returned when a message ends in the middle of a field.
+var ErrShort = errors.New("dns message too short")
+
+// Question is one entry of the question section.
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// RR is a resource record with undecoded RDATA.
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// Message is a decoded DNS message.
+type Message struct {
+	ID    uint16
+	Flags uint16
+
+	Questions  []Question
+	Answers    []RR
+	Authority  []RR
+	Additional []RR
+}
+
+// Response reports whether the QR bit is set.
+func (m *Message) Response() bool { return m.Flags&FlagResponse != 0 }
+
+// Truncated reports whether the TC bit is set.
+func (m *Message) Truncated() bool { return m.Flags&FlagTruncated != 0 }
+
+// Rcode returns the response code.
+func (m *Message) Rcode() int { return int(m.Flags & 0xf) }
+
+// EDNSSize returns the UDP payload size advertised in an OPT record.
+func (m *Message) EDNSSize() (int, bool) {
+	for _, rr := range m.Additional {
+		if rr.Type == TypeOPT {
+			return int(rr.Class), true
+		}
+	}
+	return 0, false
+}
+
+// NewQuery builds a recursive query for name. A non-zero ednsSize adds an
+// OPT record advertising that UDP payload size.
+func NewQuery(id uint16, name string, qtype uint16, ednsSize int) ([]byte, error) {
+	m := &Message{
+		ID:        id,
+		Flags:     FlagRecursion,
+		Questions: []Question{{Name: name, Type: qtype, Class: ClassINET}},
+	}
+	if ednsSize > 0 {
+		m.Additional = []RR{{Name: ".", Type: TypeOPT, Class: uint16(ednsSize)}}
+	}
+	return m.Pack()
+}
+
+// Pack encodes the message. Record names equal to the first question name
+// are compressed to a pointer to it; no other compression is done.
+func (m *Message) Pack() ([]byte, error) {
+	b := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.Flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additional)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+	qname := ""
+	if len(m.Questions) > 0 && m.Questions[0].Name != "." {
+		qname = m.Questions[0].Name
+	}
+	for _, section := range [][]RR{m.Answers, m.Authority, m.Additional} {
+		for _, rr := range section {
+			if b, err = appendRR(b, rr, qname); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// appendRR encodes one resource record, pointing its name at the first
+// question when they match.
+func appendRR(b []byte, rr RR, qname string) ([]byte, error) {
+	if len(rr.Data) > 0xffff {
+		return nil, fmt.Errorf("rdata too long: %d bytes", len(rr.Data))
+	}
+	var err error
+	if qname != "" && rr.Name == qname {
+		b = append(b, 0xc0, headerLen)
+	} else if b, err = appendName(b, rr.Name); err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint16(b, rr.Type)
+	b = binary.BigEndian.AppendUint16(b, rr.Class)
+	b = binary.BigEndian.AppendUint32(b, rr.TTL)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rr.Data)))
+	return append(b, rr.Data...), nil
+}
+
+// appendName encodes a dotted name as a sequence of labels.
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return append(b, 0), nil
+	}
+	if len(name) > 253 {
+		return nil, fmt.Errorf("name too long: %d bytes", len(name))
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid label %q in %q", label, name)
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+// Parse decodes a DNS message.
+func Parse(b []byte) (*Message, error) {
+	if len(b) < headerLen {
+		return nil, ErrShort
+	}
+	m := &Message{
+		ID:    binary.BigEndian.Uint16(b[0:]),
+		Flags: binary.BigEndian.Uint16(b[2:]),
+	}
+	qd := int(binary.BigEndian.Uint16(b[4:]))
+	an := int(binary.BigEndian.Uint16(b[6:]))
+	ns := int(binary.BigEndian.Uint16(b[8:]))
+	ar := int(binary.BigEndian.Uint16(b[10:]))
+
+	off := headerLen
+	for i := 0; i < qd; i++ {
+		name, n, err := readName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(b) {
+			return nil, ErrShort
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[off:]),
+			Class: binary.BigEndian.Uint16(b[off+2:]),
+		})
+		off += 4
+	}
+
+	var err error
+	if m.Answers, off, err = readRRs(b, off, an); err != nil {
+		return nil, err
+	}
+	if m.Authority, off, err = readRRs(b, off, ns); err != nil {
+		return nil, err
+	}
+	if m.Additional, _, err = readRRs(b, off, ar); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readRRs decodes count resource records starting at off.
+func readRRs(b []byte, off, count int) ([]RR, int, error) {
+	var rrs []RR
+	for i := 0; i < count; i++ {
+		name, n, err := readName(b, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		off = n
+		if off+10 > len(b) {
+			return nil, 0, ErrShort
+		}
+		rr := RR{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[off:]),
+			Class: binary.BigEndian.Uint16(b[off+2:]),
+			TTL:   binary.BigEndian.Uint32(b[off+4:]),
+		}
+		size := int(binary.BigEndian.Uint16(b[off+8:]))
+		off += 10
+		if off+size > len(b) {
+			return nil, 0, ErrShort
+		}
+		rr.Data = b[off : off+size]
+		off += size
+		rrs = append(rrs, rr)
+	}
+	return rrs, off, nil
+}
+
+// readName decodes a possibly compressed name at off and returns it with
+// the offset just past it. The root name is returned as ".".
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, ErrShort
+		}
+		c := int(b[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				if len(labels) == 0 {
+					return ".", end, nil
+				}
+				return strings.Join(labels, "."), end, nil
+			}
+			if off+1+c > len(b) {
+				return "", 0, ErrShort
+			}
+			labels = append(labels, string(b[off+1:off+1+c]))
+			off += 1 + c
+		case 0xc0:
+			if off+2 > len(b) {
+				return "", 0, ErrShort
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errors.New("dns name compression loop")
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+		default:
+			return "", 0, fmt.Errorf("unsupported label type 0x%02x", c)
+		}
+	}
+}
+
+// IP returns the address carried by an A or AAAA record.
+func (rr RR) IP() (netip.Addr, bool) {
+	switch {
+	case rr.Type == TypeA && len(rr.Data) == 4:
+		return netip.AddrFrom4([4]byte(rr.Data)), true
+	case rr.Type == TypeAAAA && len(rr.Data) == 16:
+		return netip.AddrFrom16([16]byte(rr.Data)), true
+	default:
+		return netip.Addr{}, false
+	}
+}
+
+// TXT splits TXT RDATA into its character-strings.
+func TXT(data []byte) ([][]byte, error) {
+	var strs [][]byte
+	for len(data) > 0 {
+		n := int(data[0])
+		if 1+n > len(data) {
+			return nil, ErrShort
+		}
+		strs = append(strs, data[1:1+n])
+		data = data[1+n:]
+	}
+	return strs, nil
+}
+
+// TXTData encodes a payload as TXT RDATA, split into 255-byte strings.
+func TXTData(payload []byte) []byte {
+	data := make([]byte, 0, len(payload)+len(payload)/255+1)
+	for len(payload) > 0 {
+		n := min(len(payload), 255)
+		data = append(data, byte(n))
+		data = append(data, payload[:n]...)
+		payload = payload[n:]
+	}
+	if len(data) == 0 {
+		data = append(data, 0)
+	}
+	return data
+}
@@ -0,0 +1,326 @@
+package dnstt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/fingerprint"
+)
+
+const (
+	// dohSenders is how many DoH requests may be in flight at once
+	dohSenders = 32
+
+	// defaultRetryAfter is how long DoH sending pauses after an error
+	// status without a Retry-After header
+	defaultRetryAfter = 10 * time.Second
+
+	// dialTimeout bounds each DoH or DoT connection attempt
+	dialTimeout = 30 * time.Second
+
+	// maxResponseSize bounds a DoH response body
+	maxResponseSize = 64000
+)
+
+// carrier moves DNS messages between the client and one resolver.
+// Responses are handed to the receive function it was created with.
+type carrier interface {
+	// send delivers one query
+	send(query []byte) error
+
+	// close releases the carrier's connections
+	close() error
+}
+
+// udpCarrier sends queries as plain DNS over UDP.
+type udpCarrier struct {
+	conn net.Conn
+}
+
+// newUDPCarrier connects a UDP socket to addr and starts reading
+// responses from it.
+func newUDPCarrier(addr string, receive func([]byte), fail func(error)) (*udpCarrier, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				// ICMP errors surface here; keep reading
+				fail(err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			receive(bytes.Clone(buf[:n]))
+		}
+	}()
+	return &udpCarrier{conn: conn}, nil
+}
+
+func (c *udpCarrier) send(query []byte) error {
+	_, err := c.conn.Write(query)
+	return err
+}
+
+func (c *udpCarrier) close() error {
+	return c.conn.Close()
+}
+
+// dohCarrier POSTs each query to a DoH URL from a pool of senders.
+type dohCarrier struct {
+	client  *http.Client
+	url     string
+	receive func([]byte)
+	fail    func(error)
+
+	queue chan []byte
+	done  chan struct{}
+
+	mu        sync.Mutex
+	notBefore time.Time
+}
+
+// newDoHCarrier starts the senders for url. TLS presents id's ClientHello,
+// with serverName (if set) as SNI and verified name.
+func newDoHCarrier(url, serverName string, id *utls.ClientHelloID, receive func([]byte), fail func(error)) *dohCarrier {
+	c := &dohCarrier{
+		client: &http.Client{
+			Transport: &fingerprint.Transport{
+				Dialer: &net.Dialer{Timeout: dialTimeout},
+				Config: &utls.Config{ServerName: serverName},
+				ID:     id,
+			},
+			Timeout: time.Minute,
+		},
+		url:     url,
+		receive: receive,
+		fail:    fail,
+		queue:   make(chan []byte, queueSize),
+		done:    make(chan struct{}),
+	}
+	for range dohSenders {
+		go c.sendLoop()
+	}
+	return c
+}
+
+// send queues a query for the next free sender.
+func (c *dohCarrier) send(query []byte) error {
+	select {
+	case c.queue <- query:
+		return nil
+	case <-c.done:
+		return errClosed
+	default:
+		return errors.New("DoH send queue full")
+	}
+}
+
+// sendLoop posts queued queries, pausing while rate-limited.
+func (c *dohCarrier) sendLoop() {
+	for {
+		var query []byte
+		select {
+		case query = <-c.queue:
+		case <-c.done:
+			return
+		}
+
+		c.mu.Lock()
+		wait := time.Until(c.notBefore)
+		c.mu.Unlock()
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.done:
+				return
+			}
+		}
+
+		if err := c.post(query); err != nil {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			c.fail(err)
+		}
+	}
+}
+
+// post sends one query and hands over the response.
+func (c *dohCarrier) post(query []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(query))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("User-Agent", "")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Mostly 429 Too Many Requests: back off as asked
+		retryAfter := defaultRetryAfter
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		c.mu.Lock()
+		if until := time.Now().Add(retryAfter); until.After(c.notBefore) {
+			c.notBefore = until
+		}
+		c.mu.Unlock()
+		return fmt.Errorf("DoH server answered %q; pausing for %v", resp.Status, retryAfter)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/dns-message" {
+		return fmt.Errorf("DoH response has Content-Type %q", ct)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	c.receive(body)
+	return nil
+}
+
+func (c *dohCarrier) close() error {
+	close(c.done)
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// dotCarrier sends queries over one DNS-over-TLS connection, redialing
+// when it breaks.
+type dotCarrier struct {
+	addr    string
+	config  *utls.Config
+	id      *utls.ClientHelloID
+	receive func([]byte)
+	fail    func(error)
+
+	mu     sync.Mutex
+	conn   net.Conn // nil while redialing
+	closed bool
+	done   chan struct{}
+
+	writeMu sync.Mutex
+}
+
+// newDoTCarrier starts connecting to addr. TLS presents id's ClientHello,
+// with serverName (if set) as SNI and verified name.
+func newDoTCarrier(addr, serverName string, id *utls.ClientHelloID, receive func([]byte), fail func(error)) *dotCarrier {
+	c := &dotCarrier{
+		addr:    addr,
+		config:  &utls.Config{ServerName: serverName},
+		id:      id,
+		receive: receive,
+		fail:    fail,
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// run keeps a connection up, reading responses from it.
+func (c *dotCarrier) run() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		conn, err := fingerprint.Dial(ctx, &net.Dialer{}, "tcp", c.addr, c.config, c.id)
+		cancel()
+		if err != nil {
+			c.fail(fmt.Errorf("dialing %s: %w", c.addr, err))
+			select {
+			case <-time.After(5 * time.Second):
+				continue
+			case <-c.done:
+				return
+			}
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+		c.conn = conn
+		c.mu.Unlock()
+
+		err = c.readLoop(conn)
+		c.mu.Lock()
+		c.conn = nil
+		closed := c.closed
+		c.mu.Unlock()
+		conn.Close()
+		if closed {
+			return
+		}
+		log.Printf("[dnstt] DoT connection to %s lost: %v", c.addr, err)
+	}
+}
+
+// readLoop hands over length-prefixed responses until conn fails.
+func (c *dotCarrier) readLoop(conn net.Conn) error {
+	for {
+		var n uint16
+		if err := binary.Read(conn, binary.BigEndian, &n); err != nil {
+			return err
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return err
+		}
+		c.receive(msg)
+	}
+}
+
+// send writes a length-prefixed query; it fails while redialing.
+func (c *dotCarrier) send(query []byte) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return errors.New("DoT connection not established")
+	}
+	buf := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(query)), uint16(len(query)))
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := conn.Write(append(buf, query...))
+	return err
+}
+
+func (c *dotCarrier) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package dnstt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// clientIDLen is the size of the random ID the server tells clients
+	// apart by
+	clientIDLen = 8
+
+	// numPadding is the random padding in a query carrying data, and
+	// numPaddingForPoll in an empty poll, to defeat resolver caching
+	numPadding        = 3
+	numPaddingForPoll = 8
+
+	// Empty polls are sent after initPollDelay without a send, backing
+	// off to maxPollDelay; a data send or received data resets the delay
+	initPollDelay       = 500 * time.Millisecond
+	maxPollDelay        = 10 * time.Second
+	pollDelayMultiplier = 2
+
+	// pollLimit bounds the polls queued up by received data
+	pollLimit = 16
+
+	// queueSize is the packet queue length in each direction
+	queueSize = 128
+
+	// ednsSize is the UDP payload size advertised in queries
+	ednsSize = 4096
+)
+
+// base32Encoding is lower-case-able base32 without padding.
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// errClosed is returned by a packetConn after Close.
+var errClosed = errors.New("packet conn closed")
+
+// serverAddr is the single remote address KCP sees.
+type serverAddr struct{}
+
+func (serverAddr) Network() string { return "dnstt" }
+func (serverAddr) String() string  { return "dnstt" }
+
+// packetConn is the net.PacketConn KCP runs over. Each packet written is
+// sent as one DNS query; packets from DNS responses are returned by
+// ReadFrom.
+type packetConn struct {
+	clientID [clientIDLen]byte
+	domain   string
+	carrier  carrier
+
+	incoming chan []byte
+	outgoing chan []byte
+	poll     chan struct{}
+
+	// onDecodeError and onQueryError report bad responses and failed
+	// sends
+	onDecodeError func(error)
+	onQueryError  func(error)
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// newPacketConn returns a packetConn with a new random client ID. Its
+// carrier is attached with start.
+func newPacketConn(domain string, onDecodeError, onQueryError func(error)) *packetConn {
+	c := &packetConn{
+		domain:        strings.ToLower(strings.TrimSuffix(domain, ".")),
+		incoming:      make(chan []byte, queueSize),
+		outgoing:      make(chan []byte, queueSize),
+		poll:          make(chan struct{}, pollLimit),
+		onDecodeError: onDecodeError,
+		onQueryError:  onQueryError,
+		closed:        make(chan struct{}),
+	}
+	_, _ = rand.Read(c.clientID[:])
+	return c
+}
+
+// start begins sending queries through carrier.
+func (c *packetConn) start(carrier carrier) {
+	c.carrier = carrier
+	go c.sendLoop()
+}
+
+// ReadFrom returns the next packet from the server.
+func (c *packetConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case packet := <-c.incoming:
+		return copy(p, packet), serverAddr{}, nil
+	case <-c.closed:
+		return 0, nil, errClosed
+	}
+}
+
+// WriteTo queues p to be sent in a query. Packets are dropped when the
+// queue is full; KCP retransmits them.
+func (c *packetConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, errClosed
+	default:
+	}
+	select {
+	case c.outgoing <- bytes.Clone(p):
+	default:
+	}
+	return len(p), nil
+}
+
+// Close stops sending and receiving and closes the carrier.
+func (c *packetConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.carrier != nil {
+			c.carrier.close()
+		}
+	})
+	return nil
+}
+
+func (c *packetConn) LocalAddr() net.Addr                { return serverAddr{} }
+func (c *packetConn) SetDeadline(t time.Time) error      { return nil }
+func (c *packetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *packetConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// sendLoop sends queued packets, one per query, and empty polls when
+// there is nothing to send so the server can return data.
+func (c *packetConn) sendLoop() {
+	pollDelay := initPollDelay
+	pollTimer := time.NewTimer(pollDelay)
+	defer pollTimer.Stop()
+	for {
+		var p []byte
+		pollTimerExpired := false
+		// Prefer data; only poll when the outgoing queue is empty
+		select {
+		case p = <-c.outgoing:
+		default:
+			select {
+			case p = <-c.outgoing:
+			case <-c.poll:
+			case <-pollTimer.C:
+				pollTimerExpired = true
+			case <-c.closed:
+				return
+			}
+		}
+
+		if len(p) > 0 {
+			// A data query doubles as a poll
+			select {
+			case <-c.poll:
+			default:
+			}
+		}
+
+		if pollTimerExpired {
+			pollDelay = min(pollDelay*pollDelayMultiplier, maxPollDelay)
+		} else {
+			if !pollTimer.Stop() {
+				<-pollTimer.C
+			}
+			pollDelay = initPollDelay
+		}
+		pollTimer.Reset(pollDelay)
+
+		query, err := c.encodeQuery(p)
+		if err != nil {
+			c.onQueryError(err)
+			continue
+		}
+		if err := c.carrier.send(query); err != nil {
+			c.onQueryError(err)
+		}
+	}
+}
+
+// encodeQuery builds a TXT query whose name carries p: the client ID, a
+// padding marker byte (224 + n) and n random bytes, then p's length and
+// p, base32-encoded into labels under the tunnel domain.
+func (c *packetConn) encodeQuery(p []byte) ([]byte, error) {
+	if len(p) >= 224 {
+		return nil, fmt.Errorf("packet of %d bytes too long for a query", len(p))
+	}
+	var buf bytes.Buffer
+	buf.Write(c.clientID[:])
+	n := numPadding
+	if len(p) == 0 {
+		n = numPaddingForPoll
+	}
+	buf.WriteByte(byte(224 + n))
+	if _, err := io.CopyN(&buf, rand.Reader, int64(n)); err != nil {
+		return nil, err
+	}
+	if len(p) > 0 {
+		buf.WriteByte(byte(len(p)))
+		buf.Write(p)
+	}
+
+	encoded := strings.ToLower(base32Encoding.EncodeToString(buf.Bytes()))
+	var labels []string
+	for len(encoded) > 63 {
+		labels = append(labels, encoded[:63])
+		encoded = encoded[63:]
+	}
+	labels = append(labels, encoded, c.domain)
+	name, err := dnsmessage.NewName(strings.Join(labels, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var id [2]byte
+	_, _ = rand.Read(id[:])
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               binary.BigEndian.Uint16(id[:]),
+		RecursionDesired: true,
+	})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(ednsSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// receive handles one DNS response from the carrier, queueing the packets
+// in its payload.
+func (c *packetConn) receive(msg []byte) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(msg)
+	if err == nil {
+		err = parser.SkipAllQuestions()
+	}
+	var answers []dnsmessage.Resource
+	if err == nil {
+		answers, err = parser.AllAnswers()
+	}
+	if err != nil {
+		c.onDecodeError(fmt.Errorf("parsing response: %w", err))
+		return
+	}
+	payload, err := c.responsePayload(header, answers)
+	if err != nil {
+		c.onQueryError(err)
+		return
+	}
+
+	r := bytes.NewReader(payload)
+	got := false
+	for {
+		p, err := nextPacket(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.onDecodeError(fmt.Errorf("reading response payload: %w", err))
+			break
+		}
+		got = true
+		select {
+		case c.incoming <- p:
+		case <-c.closed:
+			return
+		default:
+		}
+	}
+
+	// The server may have more to send; let sendLoop poll right away
+	if got {
+		for range 2 {
+			select {
+			case c.poll <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// responsePayload extracts the tunnel payload from the TXT answer of a
+// response.
+func (c *packetConn) responsePayload(header dnsmessage.Header, answers []dnsmessage.Resource) ([]byte, error) {
+	if !header.Response {
+		return nil, errors.New("response is not a DNS response")
+	}
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("resolver answered rcode %d", header.RCode)
+	}
+	if len(answers) != 1 {
+		return nil, fmt.Errorf("response has %d answers", len(answers))
+	}
+	answer := answers[0]
+	name := strings.ToLower(strings.TrimSuffix(answer.Header.Name.String(), "."))
+	if name != c.domain && !strings.HasSuffix(name, "."+c.domain) {
+		return nil, fmt.Errorf("answer for unexpected name %s", answer.Header.Name)
+	}
+	txt, ok := answer.Body.(*dnsmessage.TXTResource)
+	if !ok {
+		return nil, fmt.Errorf("answer has type %d, not TXT", answer.Header.Type)
+	}
+	return []byte(strings.Join(txt.TXT, "")), nil
+}
+
+// nextPacket reads one 16-bit length-prefixed packet. It returns io.EOF
+// only at the end of r.
+func nextPacket(r *bytes.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return p, nil
+}
+
+// mtu returns the largest packet that fits in one query under domain.
+func mtu(domain string) int {
+	// A name is at most 255 octets: the root's length byte, then each
+	// domain label with its length byte
+	capacity := 255 - 1
+	for _, label := range strings.Split(strings.TrimSuffix(domain, "."), ".") {
+		capacity -= len(label) + 1
+	}
+	// Data labels carry 63 of every 64 octets, and base32 turns 5
+	// bytes into 8
+	capacity = capacity * 63 / 64
+	capacity = capacity * 5 / 8
+	// Less the client ID, padding marker, padding and length byte
+	return capacity - clientIDLen - 1 - numPadding - 1
+}
@@ -0,0 +1,322 @@
+package dnstt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMTU(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   int
+	}{
+		{"t.example.com", 134},
+		{"t.example.com.", 134},
+		{"t.co", 140},
+		{"tunnel.example.org", 131},
+		{strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + ".com", 62},
+	}
+	for _, tt := range tests {
+		if got := mtu(tt.domain); got != tt.want {
+			t.Errorf("mtu(%q) = %d, want %d", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeQueryFitsMTU(t *testing.T) {
+	for _, domain := range []string{"t.example.com", "t.co", "tunnel.example.org", "a.b.c.d.e.example.net"} {
+		c := newPacketConn(domain, nil, nil)
+		if _, err := c.encodeQuery(make([]byte, mtu(domain))); err != nil {
+			t.Errorf("%s: packet of mtu %d bytes: %v", domain, mtu(domain), err)
+		}
+	}
+}
+
+// decodeQuery reverses encodeQuery, returning the client ID, the padding
+// length and the packet.
+func decodeQuery(t *testing.T, query []byte, domain string) (clientID []byte, padding int, p []byte) {
+	t.Helper()
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		t.Fatalf("parsing query: %v", err)
+	}
+	if !header.RecursionDesired {
+		t.Error("query without RD")
+	}
+	question, err := parser.Question()
+	if err != nil {
+		t.Fatalf("reading question: %v", err)
+	}
+	if question.Type != dnsmessage.TypeTXT {
+		t.Errorf("question type %v, want TXT", question.Type)
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := parser.SkipAllAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	if err := parser.SkipAllAuthorities(); err != nil {
+		t.Fatal(err)
+	}
+	additionals, err := parser.AllAdditionals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(additionals) != 1 || additionals[0].Header.Type != dnsmessage.TypeOPT || additionals[0].Header.Class != ednsSize {
+		t.Errorf("additionals %v, want one OPT of %d", additionals, ednsSize)
+	}
+
+	name := question.Name.String()
+	prefix, ok := strings.CutSuffix(name, "."+domain+".")
+	if !ok {
+		t.Fatalf("name %s not under %s", name, domain)
+	}
+	labels := strings.Split(prefix, ".")
+	for _, label := range labels {
+		if len(label) > 63 {
+			t.Errorf("label of %d bytes", len(label))
+		}
+	}
+	data, err := base32Encoding.DecodeString(strings.ToUpper(strings.Join(labels, "")))
+	if err != nil {
+		t.Fatalf("decoding name: %v", err)
+	}
+	if len(data) < clientIDLen+1 {
+		t.Fatalf("name carries only %d bytes", len(data))
+	}
+	clientID, data = data[:clientIDLen], data[clientIDLen:]
+	padding = int(data[0]) - 224
+	data = data[1:]
+	if padding < 0 || padding > len(data) {
+		t.Fatalf("bad padding marker %d", padding+224)
+	}
+	data = data[padding:]
+	if len(data) == 0 {
+		return clientID, padding, nil
+	}
+	if int(data[0]) != len(data)-1 {
+		t.Fatalf("length byte %d for %d bytes", data[0], len(data)-1)
+	}
+	return clientID, padding, data[1:]
+}
+
+func TestEncodeQueryRoundTrip(t *testing.T) {
+	const domain = "t.example.com"
+	tests := []struct {
+		name        string
+		size        int
+		wantPadding int
+	}{
+		{"poll", 0, numPaddingForPoll},
+		{"one byte", 1, numPadding},
+		{"mtu", mtu(domain), numPadding},
+		{"max", 223, numPadding},
+	}
+	c := newPacketConn(domain, nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.size)
+			for i := range p {
+				p[i] = byte(i)
+			}
+			query, err := c.encodeQuery(p)
+			if tt.size > mtu(domain) {
+				// Too long for the name; encodeQuery must fail, not truncate
+				if err == nil {
+					t.Fatalf("%d bytes encoded into a %d-byte query", tt.size, len(query))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientID, padding, got := decodeQuery(t, query, domain)
+			if !bytes.Equal(clientID, c.clientID[:]) {
+				t.Errorf("client ID %x, want %x", clientID, c.clientID)
+			}
+			if padding != tt.wantPadding {
+				t.Errorf("padding %d, want %d", padding, tt.wantPadding)
+			}
+			if !bytes.Equal(got, p) {
+				t.Errorf("packet %x, want %x", got, p)
+			}
+		})
+	}
+
+	if _, err := c.encodeQuery(make([]byte, 224)); err == nil {
+		t.Error("encoded a 224-byte packet")
+	}
+}
+
+// response builds a response to a tunnel query with the given rcode and
+// TXT strings for name.
+func response(t *testing.T, name string, rcode dnsmessage.RCode, txt ...string) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1, Response: true, RCode: rcode})
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	n := dnsmessage.MustNewName(name)
+	if err := b.Question(dnsmessage.Question{Name: n, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	if txt != nil {
+		if err := b.StartAnswers(); err != nil {
+			t.Fatal(err)
+		}
+		hdr := dnsmessage.ResourceHeader{Name: n, Class: dnsmessage.ClassINET, TTL: 60}
+		if err := b.TXTResource(hdr, dnsmessage.TXTResource{TXT: txt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// payload length-prefixes each packet.
+func payload(packets ...[]byte) string {
+	var buf bytes.Buffer
+	for _, p := range packets {
+		buf.WriteByte(byte(len(p) >> 8))
+		buf.WriteByte(byte(len(p)))
+		buf.Write(p)
+	}
+	return buf.String()
+}
+
+func TestReceive(t *testing.T) {
+	const domain = "t.example.com"
+	const name = "aaaa.t.example.com."
+	long := bytes.Repeat([]byte("x"), 300)
+	tests := []struct {
+		name        string
+		msg         func(t *testing.T) []byte
+		want        [][]byte
+		decodeError bool
+		queryError  bool
+	}{
+		{
+			name: "one packet",
+			msg:  func(t *testing.T) []byte { return response(t, name, dnsmessage.RCodeSuccess, payload([]byte("hello"))) },
+			want: [][]byte{[]byte("hello")},
+		},
+		{
+			name: "packets split across strings",
+			msg: func(t *testing.T) []byte {
+				p := payload([]byte("a"), long, []byte{})
+				return response(t, name, dnsmessage.RCodeSuccess, p[:100], p[100:255], p[255:])
+			},
+			want: [][]byte{[]byte("a"), long, {}},
+		},
+		{
+			name: "empty payload",
+			msg:  func(t *testing.T) []byte { return response(t, name, dnsmessage.RCodeSuccess, "") },
+		},
+		{
+			name: "domain in other case",
+			msg: func(t *testing.T) []byte {
+				return response(t, "AAAA.T.Example.COM.", dnsmessage.RCodeSuccess, payload([]byte("hi")))
+			},
+			want: [][]byte{[]byte("hi")},
+		},
+		{
+			name: "truncated packet",
+			msg: func(t *testing.T) []byte {
+				return response(t, name, dnsmessage.RCodeSuccess, payload([]byte("hello"))[:4])
+			},
+			decodeError: true,
+		},
+		{
+			name: "truncated packet after a good one",
+			msg: func(t *testing.T) []byte {
+				return response(t, name, dnsmessage.RCodeSuccess, payload([]byte("ok"), []byte("hello"))[:7])
+			},
+			want:        [][]byte{[]byte("ok")},
+			decodeError: true,
+		},
+		{
+			name:        "garbage",
+			msg:         func(t *testing.T) []byte { return []byte{0, 1, 2} },
+			decodeError: true,
+		},
+		{
+			name:       "NXDOMAIN",
+			msg:        func(t *testing.T) []byte { return response(t, name, dnsmessage.RCodeNameError) },
+			queryError: true,
+		},
+		{
+			name:       "no answer",
+			msg:        func(t *testing.T) []byte { return response(t, name, dnsmessage.RCodeSuccess) },
+			queryError: true,
+		},
+		{
+			name: "other domain",
+			msg: func(t *testing.T) []byte {
+				return response(t, "aaaa.example.com.", dnsmessage.RCodeSuccess, payload([]byte("x")))
+			},
+			queryError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decodeErr, queryErr error
+			c := newPacketConn(domain, func(err error) { decodeErr = err }, func(err error) { queryErr = err })
+			c.receive(tt.msg(t))
+			close(c.incoming)
+			var got [][]byte
+			for p := range c.incoming {
+				got = append(got, p)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d packets, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("packet %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			if (decodeErr != nil) != tt.decodeError {
+				t.Errorf("decode error %v, want one: %v", decodeErr, tt.decodeError)
+			}
+			if (queryErr != nil) != tt.queryError {
+				t.Errorf("query error %v, want one: %v", queryErr, tt.queryError)
+			}
+		})
+	}
+}
+
+func TestNextPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+		err  error
+	}{
+		{"empty", nil, nil, io.EOF},
+		{"zero length", []byte{0, 0}, []byte{}, nil},
+		{"three bytes", []byte{0, 3, 'a', 'b', 'c', 'd'}, []byte("abc"), nil},
+		{"half a length", []byte{0}, nil, io.ErrUnexpectedEOF},
+		{"short packet", []byte{0, 3, 'a'}, nil, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextPacket(bytes.NewReader(tt.in))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("packet %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
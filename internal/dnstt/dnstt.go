@@ -0,0 +1,176 @@
+// Package dnstt is an in-process dnstt client: KCP over DNS queries sent
+// through a UDP, DoH or DoT resolver, a Noise NK channel on top, and smux
+// streams inside it, wire-compatible with dnstt-server.
+package dnstt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"github.com/xtaci/kcp-go/v5"
+	"github.com/xtaci/smux"
+)
+
+// Config describes one session with a dnstt server.
+type Config struct {
+	// Domain is the tunnel domain (e.g., t.example.com)
+	Domain string
+
+	// PubKey is the server's Noise public key
+	PubKey []byte
+
+	// Resolver is the resolver address: host:port for UDP and DoT, a
+	// URL for DoH
+	Resolver string
+
+	// Type is the resolver type: "udp", "doh" or "dot"
+	Type string
+
+	// ServerName, if set, is the TLS name for DoH and DoT when Resolver's
+	// host is an IP its certificate doesn't cover
+	ServerName string
+
+	// Fingerprint is the TLS ClientHello for DoH and DoT, nil for Go's own
+	Fingerprint *utls.ClientHelloID
+
+	// IdleTimeout closes the session after this long without hearing
+	// from the server
+	IdleTimeout time.Duration
+
+	// OnDecodeError reports resolver responses that could not be decoded
+	OnDecodeError func(error)
+
+	// OnQueryError reports queries that failed or were answered with an
+	// error
+	OnQueryError func(error)
+}
+
+// Session is one KCP session with the server, the equivalent of one
+// dnstt-client run.
+type Session struct {
+	config Config
+	pconn  *packetConn
+	kcp    *kcp.UDPSession
+	smux   *smux.Session
+}
+
+// NewSession opens the resolver transport and a KCP session over it.
+// Nothing reaches the server until Handshake.
+func NewSession(cfg Config) (*Session, error) {
+	onDecodeError, onQueryError := cfg.OnDecodeError, cfg.OnQueryError
+	if onDecodeError == nil {
+		onDecodeError = func(error) {}
+	}
+	if onQueryError == nil {
+		onQueryError = func(error) {}
+	}
+
+	size := mtu(cfg.Domain)
+	if size < 80 {
+		return nil, fmt.Errorf("domain %s leaves only %d bytes for payload", cfg.Domain, size)
+	}
+
+	pconn := newPacketConn(cfg.Domain, onDecodeError, onQueryError)
+	var c carrier
+	switch cfg.Type {
+	case "udp", "":
+		udp, err := newUDPCarrier(cfg.Resolver, pconn.receive, onQueryError)
+		if err != nil {
+			return nil, err
+		}
+		c = udp
+	case "doh":
+		if _, err := url.Parse(cfg.Resolver); err != nil {
+			return nil, fmt.Errorf("parsing DoH URL: %w", err)
+		}
+		c = newDoHCarrier(cfg.Resolver, cfg.ServerName, cfg.Fingerprint, pconn.receive, onQueryError)
+	case "dot":
+		c = newDoTCarrier(cfg.Resolver, cfg.ServerName, cfg.Fingerprint, pconn.receive, onQueryError)
+	default:
+		return nil, fmt.Errorf("unsupported resolver type %q", cfg.Type)
+	}
+	pconn.start(c)
+
+	conn, err := kcp.NewConn2(serverAddr{}, nil, 0, 0, pconn)
+	if err != nil {
+		pconn.Close()
+		return nil, fmt.Errorf("opening KCP conn: %w", err)
+	}
+	// Coalesce consecutive writes, and limit only by the static windows
+	// rather than a congestion window
+	conn.SetStreamMode(true)
+	conn.SetNoDelay(0, 0, 0, 1)
+	conn.SetWindowSize(queueSize/2, queueSize/2)
+	conn.SetMtu(size)
+
+	return &Session{config: cfg, pconn: pconn, kcp: conn}, nil
+}
+
+// Conv returns the KCP conversation ID, which dnstt logs as the session ID.
+func (s *Session) Conv() uint32 {
+	return s.kcp.GetConv()
+}
+
+// Handshake runs the Noise handshake over the KCP session and starts smux
+// on top. It gives up when ctx ends.
+func (s *Session) Handshake(ctx context.Context) error {
+	// Cancellation interrupts the handshake through the KCP deadline,
+	// which must be cleared before anything else reads the conn
+	expired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(expired)
+		s.kcp.SetDeadline(time.Now())
+	})
+	send, recv, err := noiseHandshake(s.kcp, s.config.PubKey)
+	if !stop() {
+		<-expired
+	}
+	s.kcp.SetDeadline(time.Time{})
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("noise handshake: %w", err)
+	}
+	rw := newNoiseConn(s.kcp, send, recv)
+
+	cfg := smux.DefaultConfig()
+	cfg.Version = 2
+	if s.config.IdleTimeout > 0 {
+		cfg.KeepAliveTimeout = s.config.IdleTimeout
+	}
+	cfg.MaxStreamBuffer = 1024 * 1024
+	sess, err := smux.Client(rw, cfg)
+	if err != nil {
+		return fmt.Errorf("opening smux session: %w", err)
+	}
+	s.smux = sess
+	return nil
+}
+
+// OpenStream opens a stream to the server's upstream.
+func (s *Session) OpenStream() (*smux.Stream, error) {
+	return s.smux.OpenStream()
+}
+
+// CloseChan is closed when the smux session ends.
+func (s *Session) CloseChan() <-chan struct{} {
+	return s.smux.CloseChan()
+}
+
+// IsClosed reports whether the smux session has ended.
+func (s *Session) IsClosed() bool {
+	return s.smux == nil || s.smux.IsClosed()
+}
+
+// Close ends the session and its resolver transport.
+func (s *Session) Close() error {
+	if s.smux != nil {
+		s.smux.Close()
+	}
+	s.kcp.Close()
+	return s.pconn.Close()
+}
@@ -0,0 +1,134 @@
+package dnstt
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/flynn/noise"
+)
+
+// noisePrologue must match dnstt-server's for the handshake to succeed.
+const noisePrologue = "dnstt 2020-04-13"
+
+// maxNoisePayload is the largest plaintext that fits one Noise message
+// after the 16-byte authentication tag.
+const maxNoisePayload = 65535 - 16
+
+// cipherSuite is Noise_NK_25519_ChaChaPoly_BLAKE2s, as dnstt uses.
+var cipherSuite = noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, noise.HashBLAKE2s)
+
+// readMessage reads one 16-bit length-prefixed Noise message.
+func readMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeMessage writes one 16-bit length-prefixed Noise message.
+func writeMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	_, err := w.Write(append(buf, msg...))
+	return err
+}
+
+// noiseConn encrypts writes to and decrypts reads from the wrapped stream
+// with the ciphers of a completed handshake.
+type noiseConn struct {
+	io.ReadWriteCloser
+	send *noise.CipherState
+	recv *io.PipeReader
+}
+
+// newNoiseConn starts decrypting rwc's messages into the read pipe.
+func newNoiseConn(rwc io.ReadWriteCloser, send, recv *noise.CipherState) *noiseConn {
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		defer func() { pw.CloseWithError(err) }()
+		for {
+			var msg []byte
+			if msg, err = readMessage(rwc); err != nil {
+				return
+			}
+			var p []byte
+			if p, err = recv.Decrypt(nil, nil, msg); err != nil {
+				return
+			}
+			if _, err = pw.Write(p); err != nil {
+				return
+			}
+		}
+	}()
+	return &noiseConn{ReadWriteCloser: rwc, send: send, recv: pr}
+}
+
+// Read returns decrypted data.
+func (c *noiseConn) Read(p []byte) (int, error) {
+	return c.recv.Read(p)
+}
+
+// Write encrypts p into one or more messages.
+func (c *noiseConn) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		n := min(len(p), maxNoisePayload)
+		msg, err := c.send.Encrypt(nil, nil, p[:n])
+		if err != nil {
+			return total, err
+		}
+		if err := writeMessage(c.ReadWriteCloser, msg); err != nil {
+			return total, err
+		}
+		total += n
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// noiseHandshake runs the NK handshake as initiator against the server's
+// static public key and returns the sending and receiving ciphers.
+func noiseHandshake(rw io.ReadWriter, serverPubKey []byte) (send, recv *noise.CipherState, err error) {
+	hs, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite: cipherSuite,
+		Pattern:     noise.HandshakeNK,
+		Initiator:   true,
+		Prologue:    []byte(noisePrologue),
+		PeerStatic:  serverPubKey,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// -> e, es
+	msg, _, _, err := hs.WriteMessage(nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeMessage(rw, msg); err != nil {
+		return nil, nil, err
+	}
+
+	// <- e, ee
+	if msg, err = readMessage(rw); err != nil {
+		return nil, nil, err
+	}
+	payload, send, recv, err := hs.ReadMessage(nil, msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(payload) != 0 {
+		return nil, nil, errors.New("unexpected payload in server handshake")
+	}
+	return send, recv, nil
+}
@@ -0,0 +1,178 @@
+package dnstt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/flynn/noise"
+)
+
+// serverKey is a fixed Curve25519 key pair generated from a zero seed.
+func serverKey(t *testing.T) noise.DHKey {
+	t.Helper()
+	key, err := noise.DH25519.GenerateKeypair(bytes.NewReader(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// serverHandshake runs the responder side of dnstt's NK handshake.
+func serverHandshake(rw io.ReadWriter, key noise.DHKey) (send, recv *noise.CipherState, err error) {
+	hs, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:   cipherSuite,
+		Pattern:       noise.HandshakeNK,
+		Initiator:     false,
+		Prologue:      []byte(noisePrologue),
+		StaticKeypair: key,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, err := readMessage(rw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, _, _, err := hs.ReadMessage(nil, msg); err != nil {
+		return nil, nil, err
+	}
+	msg, recv, send, err = hs.WriteMessage(nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return send, recv, writeMessage(rw, msg)
+}
+
+func TestServerKey(t *testing.T) {
+	// The public key of the zero private key; catches a change in how the
+	// fixed key pair is derived
+	const want = "2fe57da347cd62431528daac5fbb290730fff684afc4cfc2ed90995f58cb3b74"
+	if got := hex.EncodeToString(serverKey(t).Public); got != want {
+		t.Fatalf("public key %s, want %s", got, want)
+	}
+}
+
+func TestNoiseHandshake(t *testing.T) {
+	key := serverKey(t)
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	type result struct {
+		conn *noiseConn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		send, recv, err := serverHandshake(server, key)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{conn: newNoiseConn(server, send, recv)}
+	}()
+
+	send, recv, err := noiseHandshake(client, key.Public)
+	if err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("server handshake: %v", res.err)
+	}
+	c, s := newNoiseConn(client, send, recv), res.conn
+
+	// Larger than one Noise message, so Write must split it
+	data := make([]byte, maxNoisePayload+1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for _, dir := range []struct {
+		name string
+		w, r io.ReadWriter
+	}{
+		{"client to server", c, s},
+		{"server to client", s, c},
+	} {
+		t.Run(dir.name, func(t *testing.T) {
+			errc := make(chan error, 1)
+			go func() {
+				_, err := dir.w.Write(data)
+				errc <- err
+			}()
+			got := make([]byte, len(data))
+			if _, err := io.ReadFull(dir.r, got); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("data changed in transit")
+			}
+		})
+	}
+}
+
+func TestNoiseHandshakeWrongKey(t *testing.T) {
+	key := serverKey(t)
+	other, err := noise.DH25519.GenerateKeypair(bytes.NewReader(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := serverHandshake(server, key)
+		// dnstt-server drops the session; the client sees the stream end
+		server.Close()
+		errc <- err
+	}()
+
+	if _, _, err := noiseHandshake(client, other.Public); err == nil {
+		t.Error("client handshake succeeded against the wrong key")
+	}
+	if err := <-errc; err == nil {
+		t.Error("server accepted a handshake for another key")
+	}
+}
+
+func TestMessageFraming(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+		err  error
+	}{
+		{"empty message", []byte{0, 0}, []byte{}, nil},
+		{"message", []byte{0, 2, 'h', 'i'}, []byte("hi"), nil},
+		{"no length", nil, nil, io.EOF},
+		{"short message", []byte{0, 3, 'h', 'i'}, nil, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readMessage(bytes.NewReader(tt.in))
+			if err != tt.err {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("message %q, want %q", got, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			var buf bytes.Buffer
+			if err := writeMessage(&buf, got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.in) {
+				t.Errorf("rewritten as %x, want %x", buf.Bytes(), tt.in)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package echo implements the tunnel-compatibility probe. The scanner sends
+// TXT queries with long random labels under the tunnel domain; a
+// cooperative responder on the server answers them with a digest of the
+// name it received, padded to the requested response size. Responses
+// larger than OpenSize need a token keyed with the tunnel public key, so
+// only clients of the server can have large responses sent anywhere.
+package echo
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Label is the zone under the tunnel domain reserved for probes:
+// <random labels>.s<size>[-<token>].echo.<domain>
+const Label = "echo"
+
+// Response sizes the responder will pad to. Probes without a valid token
+// get at most OpenSize bytes, which covers the scanner's tunnel probe.
+const (
+	MinSize  = 512
+	OpenSize = 1232
+	MaxSize  = 4096
+)
+
+// tokenLen is the number of hex characters of the HMAC in a token.
+const tokenLen = 16
+
+// base32Alphabet matches the labels dnstt puts on the wire.
+const base32Alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+// maxNameLen is the longest dotted name that fits in 255 wire bytes.
+const maxNameLen = 253
+
+// Zone returns the probe zone for domain.
+func Zone(domain string) string {
+	return Label + "." + strings.TrimSuffix(domain, ".")
+}
+
+// ProbeName returns a maximum-length query name asking for a response of
+// size bytes, filled with random base32 labels like a dnstt query. With
+// a key (the tunnel public key) the name carries a token allowing sizes
+// above OpenSize.
+func ProbeName(domain string, size int, key string) (string, error) {
+	sizeLabel := "s" + strconv.Itoa(size)
+	if key != "" {
+		sizeLabel += "-" + strings.Repeat("0", tokenLen)
+	}
+	room := maxNameLen - len(sizeLabel) - 1 - len(Zone(domain))
+	if room < 2 {
+		return "", fmt.Errorf("domain %q too long for probe names", domain)
+	}
+
+	var labels []string
+	for room >= 2 {
+		n := min(room-1, 63)
+		labels = append(labels, randomLabel(n))
+		room -= n + 1
+	}
+	prefix := strings.Join(labels, ".")
+	sizeLabel = "s" + strconv.Itoa(size)
+	if key != "" {
+		sizeLabel += "-" + token(key, prefix, size)
+	}
+	return prefix + "." + sizeLabel + "." + Zone(domain), nil
+}
+
+// token authenticates a probe's random labels and size with key.
+func token(key, prefix string, size int) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strings.ToLower(prefix) + "." + strconv.Itoa(size)))
+	return hex.EncodeToString(mac.Sum(nil))[:tokenLen]
+}
+
+// randomLabel returns n random base32 characters.
+func randomLabel(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	for i := range b {
+		b[i] = base32Alphabet[int(b[i])%len(base32Alphabet)]
+	}
+	return string(b)
+}
+
+// ParseProbe returns the response size to send if name is a probe under
+// domain. Sizes above OpenSize are only granted to names carrying a valid
+// token for key; others are capped at OpenSize.
+func ParseProbe(name, domain, key string) (int, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	suffix := "." + strings.ToLower(Zone(domain))
+	if !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+	rest := strings.TrimSuffix(name, suffix)
+	i := strings.LastIndexByte(rest, '.')
+	if i < 0 {
+		return 0, false
+	}
+	sizeLabel, tok, _ := strings.Cut(rest[i+1:], "-")
+	if !strings.HasPrefix(sizeLabel, "s") {
+		return 0, false
+	}
+	requested, err := strconv.Atoi(sizeLabel[1:])
+	if err != nil || requested < 0 {
+		return 0, false
+	}
+	size := min(max(requested, MinSize), MaxSize)
+	if size > OpenSize && (key == "" || !hmac.Equal([]byte(tok), []byte(token(key, rest[:i], requested)))) {
+		size = OpenSize
+	}
+	return size, true
+}
+
+// InZone reports whether name is the probe zone or below it.
+func InZone(name, domain string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone := strings.ToLower(Zone(domain))
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// Payload returns the n-byte TXT payload for a probe name: the hex SHA-256
+// of the lowercased name, repeated. Resolvers may randomize the case of
+// names they forward, so case is ignored.
+func Payload(name string, n int) []byte {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSuffix(name, "."))))
+	digest := hex.EncodeToString(sum[:])
+	payload := make([]byte, 0, n+len(digest))
+	for len(payload) < n {
+		payload = append(payload, digest...)
+	}
+	return payload[:n]
+}
@@ -0,0 +1,155 @@
+package echo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProbeName(t *testing.T) {
+	tests := []struct {
+		domain string
+		size   int
+		key    string
+	}{
+		{"t.example.com", 512, ""},
+		{"t.example.com.", 1232, ""},
+		{"t.example.com", 4096, testKey},
+		{"tunnel.some-long-domain.example.org", 2048, testKey},
+	}
+	for _, tt := range tests {
+		name, err := ProbeName(tt.domain, tt.size, tt.key)
+		if err != nil {
+			t.Errorf("ProbeName(%q, %d): %v", tt.domain, tt.size, err)
+			continue
+		}
+		if len(name) > maxNameLen || len(name) < maxNameLen-1 {
+			t.Errorf("%s: name of %d bytes, want %d", tt.domain, len(name), maxNameLen)
+		}
+		if !strings.HasSuffix(name, "."+Zone(tt.domain)) {
+			t.Errorf("%s not under %s", name, Zone(tt.domain))
+		}
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				t.Errorf("%s: label of %d bytes", name, len(label))
+			}
+		}
+		if !InZone(name, tt.domain) {
+			t.Errorf("%s not in zone", name)
+		}
+	}
+
+	if _, err := ProbeName(strings.Repeat("a.", 120)+"com", 512, ""); err == nil {
+		t.Error("made a probe name under a domain too long for one")
+	}
+
+	a, _ := ProbeName("t.example.com", 512, "")
+	b, _ := ProbeName("t.example.com", 512, "")
+	if a == b {
+		t.Error("two probe names are the same")
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	const domain = "t.example.com"
+	zone := "." + Zone(domain)
+	tests := []struct {
+		name string
+		key  string
+		want int
+		ok   bool
+	}{
+		{"abc.s700" + zone, "", 700, true},
+		{"ABC.S700" + strings.ToUpper(zone) + ".", "", 700, true},
+		{"abc.s10" + zone, "", MinSize, true},
+		{"abc.s4096" + zone, "", OpenSize, true},
+		{"abc.s4096" + zone, testKey, OpenSize, true},
+		{"abc.s4096-0123456789abcdef" + zone, testKey, OpenSize, true},
+		{"abc.s700-" + zone, testKey, 700, true},
+		{"s700" + zone, "", 0, false},
+		{"abc.x700" + zone, "", 0, false},
+		{"abc.s-1" + zone, "", 0, false},
+		{"abc.sbig" + zone, "", 0, false},
+		{"abc.s700.t.example.com", "", 0, false},
+		{"abc.s700.echo.example.com", "", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseProbe(tt.name, domain, tt.key)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseProbe(%q) = %d, %v; want %d, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestProbeRoundTrip(t *testing.T) {
+	const domain = "t.example.com"
+	tests := []struct {
+		size     int
+		nameKey  string
+		parseKey string
+		want     int
+	}{
+		{512, "", testKey, 512},
+		{1024, testKey, testKey, 1024},
+		{1232, "", "", 1232},
+		{2048, "", testKey, OpenSize},
+		{2048, testKey, "", OpenSize},
+		{2048, testKey, testKey, 2048},
+		{4096, testKey, testKey, 4096},
+		{9000, testKey, testKey, MaxSize},
+		{4096, testKey, "ff" + testKey[2:], OpenSize},
+	}
+	for _, tt := range tests {
+		name, err := ProbeName(domain, tt.size, tt.nameKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Resolvers may randomize the case of the names they forward
+		for _, n := range []string{name, strings.ToUpper(name), name + "."} {
+			got, ok := ParseProbe(n, domain, tt.parseKey)
+			if !ok || got != tt.want {
+				t.Errorf("size %d, name key %t, parse key %q: parsed %d, %v; want %d", tt.size, tt.nameKey != "", tt.parseKey, got, ok, tt.want)
+			}
+		}
+	}
+}
+
+func TestInZone(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"echo.t.example.com", true},
+		{"ECHO.T.example.com.", true},
+		{"a.b.echo.t.example.com", true},
+		{"t.example.com", false},
+		{"xecho.t.example.com", false},
+		{"a.t.example.com", false},
+		{"echo.t.example.org", false},
+	}
+	for _, tt := range tests {
+		if got := InZone(tt.name, "t.example.com."); got != tt.want {
+			t.Errorf("InZone(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	const name = "abc.s512.echo.t.example.com"
+	for _, n := range []int{0, 1, 64, 65, 1000} {
+		p := Payload(name, n)
+		if len(p) != n {
+			t.Errorf("Payload(%d) has %d bytes", n, len(p))
+		}
+	}
+
+	p := Payload(name, 1000)
+	if string(p[:64]) != string(p[64:128]) {
+		t.Error("payload does not repeat the digest")
+	}
+	if string(Payload(strings.ToUpper(name)+".", 1000)) != string(p) {
+		t.Error("payload depends on case or the trailing dot")
+	}
+	if string(Payload("abd.s512.echo.t.example.com", 64)) == string(p[:64]) {
+		t.Error("different names gave the same payload")
+	}
+}
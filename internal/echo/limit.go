@@ -0,0 +1,73 @@
+package echo
+
+import (
+	"sync"
+	"time"
+)
+
+// Per-source limits on probe answers, so the responder can't be used to
+// flood a spoofed source address. A benchmark burst (200 queries a second
+// of 512-byte answers) stays under the rate.
+const (
+	sourceRate  = 128 << 10 // bytes per second
+	sourceBurst = 256 << 10 // bytes
+)
+
+// sourceLimiter is a token bucket of response bytes per source host.
+type sourceLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket holds a source's remaining bytes as of last.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newSourceLimiter creates a limiter refilling rate bytes per second up
+// to burst.
+func newSourceLimiter(rate, burst float64) *sourceLimiter {
+	return &sourceLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow reports whether n more bytes may be sent to host, taking them
+// from its bucket if so.
+func (l *sourceLimiter) allow(host string, n int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[host] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// prune forgets sources whose buckets have refilled.
+func (l *sourceLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for host, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, host)
+		}
+	}
+}
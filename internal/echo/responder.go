@@ -0,0 +1,251 @@
+package echo
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnsmsg"
+)
+
+// relayIdle is how long a client's relay socket to dnstt-server is kept
+// without traffic.
+const relayIdle = 2 * time.Minute
+
+// Responder listens for DNS queries in front of dnstt-server. Probe
+// queries under the echo zone are answered directly, within a per-source
+// byte rate; everything else is relayed to dnstt-server, with one UDP
+// socket per client address.
+type Responder struct {
+	listen  string
+	backend string
+	domain  string
+	key     string
+
+	probes  atomic.Int64
+	limited atomic.Int64
+	limiter *sourceLimiter
+
+	mu     sync.Mutex
+	relays map[string]*relay
+}
+
+// relay carries one client's queries to dnstt-server and its replies back.
+type relay struct {
+	conn     *net.UDPConn
+	lastUsed atomic.Int64
+}
+
+// NewResponder creates a Responder on UDP listen relaying to backend.
+// key is the tunnel public key that probe tokens are checked against.
+func NewResponder(listen, backend, domain, key string) *Responder {
+	return &Responder{
+		listen:  listen,
+		backend: backend,
+		domain:  domain,
+		key:     key,
+		limiter: newSourceLimiter(sourceRate, sourceBurst),
+		relays:  make(map[string]*relay),
+	}
+}
+
+// Probes returns the number of probe queries answered.
+func (r *Responder) Probes() int64 {
+	return r.probes.Load()
+}
+
+// Limited returns the number of probe queries dropped by the per-source
+// rate limit.
+func (r *Responder) Limited() int64 {
+	return r.limited.Load()
+}
+
+// Run serves until ctx is cancelled.
+func (r *Responder) Run(ctx context.Context) error {
+	pc, err := net.ListenPacket("udp", r.listen)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+	}()
+	defer r.closeRelays()
+
+	log.Printf("[echo] Listening on udp %s, relaying to %s", pc.LocalAddr(), r.backend)
+
+	go r.reapRelays(ctx)
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		query := buf[:n]
+
+		if resp := r.answer(query); resp != nil {
+			if !r.limiter.allow(sourceHost(addr), len(resp), time.Now()) {
+				r.limited.Add(1)
+				continue
+			}
+			r.probes.Add(1)
+			pc.WriteTo(resp, addr)
+			continue
+		}
+
+		rl, err := r.relayFor(pc, addr)
+		if err != nil {
+			log.Printf("[echo] Relay to %s failed: %v", r.backend, err)
+			continue
+		}
+		rl.lastUsed.Store(time.Now().UnixNano())
+		rl.conn.Write(query)
+	}
+}
+
+// answer returns the response for a query in the echo zone, or nil if the
+// query belongs to dnstt-server.
+func (r *Responder) answer(query []byte) []byte {
+	m, err := dnsmsg.Parse(query)
+	if err != nil || m.Response() || len(m.Questions) != 1 {
+		return nil
+	}
+	q := m.Questions[0]
+	if !InZone(q.Name, r.domain) {
+		return nil
+	}
+
+	resp := &dnsmsg.Message{
+		ID:        m.ID,
+		Flags:     dnsmsg.FlagResponse | dnsmsg.FlagAuthority | m.Flags&dnsmsg.FlagRecursion,
+		Questions: m.Questions,
+	}
+	limit := 512
+	if size, ok := m.EDNSSize(); ok {
+		limit = max(size, 512)
+		resp.Additional = []dnsmsg.RR{{Name: ".", Type: dnsmsg.TypeOPT, Class: MaxSize}}
+	}
+
+	// Names in the zone that aren't TXT probes get an empty answer, so
+	// resolvers doing QNAME minimization walk down to the probe name
+	size, ok := ParseProbe(q.Name, r.domain, r.key)
+	if !ok || q.Type != dnsmsg.TypeTXT {
+		b, _ := resp.Pack()
+		return b
+	}
+
+	// Size the payload so the whole response is size bytes
+	rr := dnsmsg.RR{Name: q.Name, Type: dnsmsg.TypeTXT, Class: dnsmsg.ClassINET}
+	resp.Answers = []dnsmsg.RR{rr}
+	base, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	room := size - len(base)
+	n := room - (room+254)/255
+	for n+(n+254)/255 > room {
+		n--
+	}
+	rr.Data = dnsmsg.TXTData(Payload(q.Name, max(n, 64)))
+	resp.Answers[0] = rr
+
+	b, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	if len(b) > limit {
+		resp.Answers = nil
+		resp.Flags |= dnsmsg.FlagTruncated
+		b, _ = resp.Pack()
+	}
+	return b
+}
+
+// relayFor returns the relay socket for a client, creating it on first use.
+func (r *Responder) relayFor(pc net.PacketConn, addr net.Addr) (*relay, error) {
+	key := addr.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rl, ok := r.relays[key]; ok {
+		return rl, nil
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", r.backend)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	rl := &relay{conn: conn}
+	rl.lastUsed.Store(time.Now().UnixNano())
+	r.relays[key] = rl
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			rl.lastUsed.Store(time.Now().UnixNano())
+			pc.WriteTo(buf[:n], addr)
+		}
+	}()
+	return rl, nil
+}
+
+// sourceHost returns the host a query came from; the port is left out so
+// one limit covers all of a host's sockets.
+func sourceHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// reapRelays closes relay sockets idle for longer than relayIdle and
+// forgets rate limits of sources that went quiet.
+func (r *Responder) reapRelays(ctx context.Context) {
+	ticker := time.NewTicker(relayIdle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			for key, rl := range r.relays {
+				if now.Sub(time.Unix(0, rl.lastUsed.Load())) > relayIdle {
+					rl.conn.Close()
+					delete(r.relays, key)
+				}
+			}
+			r.mu.Unlock()
+			r.limiter.prune(now)
+		}
+	}
+}
+
+// closeRelays closes every relay socket.
+func (r *Responder) closeRelays() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, rl := range r.relays {
+		rl.conn.Close()
+		delete(r.relays, key)
+	}
+}
@@ -0,0 +1,125 @@
+package echo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnsmsg"
+)
+
+const (
+	testDomain = "t.example.com"
+	testKey    = "2fe57da347cd62431528daac5fbb290730fff684afc4cfc2ed90995f58cb3b74"
+)
+
+func TestAnswerSize(t *testing.T) {
+	r := NewResponder("", "", testDomain, testKey)
+	tests := []struct {
+		name     string
+		size     int
+		key      string
+		ednsSize int
+		want     int
+	}{
+		{"minimum", 512, "", 4096, 512},
+		{"open size without token", OpenSize, "", 4096, OpenSize},
+		{"large without token", 4096, "", 4096, OpenSize},
+		{"large with wrong key", 4096, "00" + testKey[2:], 4096, OpenSize},
+		{"large with token", 4096, testKey, 4096, 4096},
+		{"medium with token", 2048, testKey, 4096, 2048},
+		{"over maximum with token", 8000, testKey, 4096, MaxSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := ProbeName(testDomain, tt.size, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, err := dnsmsg.NewQuery(1, name, dnsmsg.TypeTXT, tt.ednsSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := r.answer(query)
+			if len(resp) != tt.want {
+				t.Errorf("answered with %d bytes, want %d", len(resp), tt.want)
+			}
+			m, err := dnsmsg.Parse(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Truncated() || len(m.Answers) != 1 {
+				t.Fatalf("truncated %v with %d answers", m.Truncated(), len(m.Answers))
+			}
+		})
+	}
+}
+
+func TestAnswerTruncates(t *testing.T) {
+	r := NewResponder("", "", testDomain, testKey)
+	name, err := ProbeName(testDomain, 1024, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, edns := range []int{0, 600} {
+		query, err := dnsmsg.NewQuery(1, name, dnsmsg.TypeTXT, edns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := dnsmsg.Parse(r.answer(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.Truncated() || len(m.Answers) != 0 {
+			t.Errorf("EDNS size %d: truncated %v with %d answers, want TC and none", edns, m.Truncated(), len(m.Answers))
+		}
+	}
+}
+
+func TestAnswerOutsideZone(t *testing.T) {
+	r := NewResponder("", "", testDomain, testKey)
+	for _, name := range []string{"abc." + testDomain, "echo.example.com", "x.echo.t.example.org"} {
+		query, err := dnsmsg.NewQuery(1, name, dnsmsg.TypeTXT, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := r.answer(query); resp != nil {
+			t.Errorf("answered %s, which belongs to dnstt-server", name)
+		}
+	}
+}
+
+func TestSourceLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newSourceLimiter(1000, 2000)
+
+	steps := []struct {
+		host  string
+		n     int
+		after time.Duration
+		want  bool
+	}{
+		{"192.0.2.1", 1500, 0, true},
+		{"192.0.2.1", 600, 0, false},
+		{"192.0.2.2", 2000, 0, true},
+		{"192.0.2.1", 500, 0, true},
+		{"192.0.2.1", 1000, 500 * time.Millisecond, false},
+		{"192.0.2.1", 1000, 500 * time.Millisecond, true},
+		{"192.0.2.1", 2001, 10 * time.Second, false},
+		{"192.0.2.1", 2000, 0, true},
+	}
+	for i, s := range steps {
+		now = now.Add(s.after)
+		if got := l.allow(s.host, s.n, now); got != s.want {
+			t.Errorf("step %d: allow(%s, %d) = %v, want %v", i, s.host, s.n, got, s.want)
+		}
+	}
+
+	l.prune(now.Add(time.Second))
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after prune, want 1", len(l.buckets))
+	}
+	l.prune(now.Add(2 * time.Second))
+	if len(l.buckets) != 0 {
+		t.Errorf("%d buckets after prune, want 0", len(l.buckets))
+	}
+}
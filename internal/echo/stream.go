@@ -0,0 +1,85 @@
+package echo
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// Stream echo limits. Health probes send a few bytes, so anything more is
+// cut off rather than relayed back through the tunnel.
+const (
+	// streamMaxBytes is the most a connection may echo
+	streamMaxBytes = 4096
+
+	// streamIdle closes connections that send nothing for this long
+	streamIdle = 30 * time.Second
+)
+
+// StreamServer is a TCP echo service for clients' end-to-end health
+// probes, reached through the server-side SOCKS5 proxy.
+type StreamServer struct {
+	listen string
+}
+
+// NewStreamServer creates a StreamServer on TCP listen.
+func NewStreamServer(listen string) *StreamServer {
+	return &StreamServer{listen: listen}
+}
+
+// Run serves until ctx is cancelled.
+func (s *StreamServer) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	log.Printf("[echo] Health echo listening on tcp %s", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle echoes one connection until it closes, idles or hits streamMaxBytes.
+func (s *StreamServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	buf := make([]byte, 512)
+	remaining := streamMaxBytes
+	for remaining > 0 {
+		conn.SetReadDeadline(time.Now().Add(streamIdle))
+		n, err := conn.Read(buf[:min(len(buf), remaining)])
+		if n > 0 {
+			if _, werr := conn.Write(buf[:n]); werr != nil {
+				return
+			}
+			remaining -= n
+		}
+		if err != nil {
+			if err != io.EOF && !isTimeout(err) {
+				log.Printf("[echo] Health echo read from %s failed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
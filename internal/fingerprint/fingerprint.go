@@ -0,0 +1,163 @@
+// Package fingerprint maps dnstt-client's uTLS fingerprint names to uTLS
+// ClientHello IDs and dials TLS connections that present them.
+package fingerprint
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// helloIDs are the fingerprint names dnstt-client's -utls option accepts,
+// lower-cased. A nil ID means Go's own ClientHello.
+var helloIDs = map[string]*utls.ClientHelloID{
+	// "random" uses the no-ALPN variant, as dnstt-client does, so the
+	// negotiated protocol is always HTTP/1.1
+	"random":     &utls.HelloRandomizedNoALPN,
+	"randomized": &utls.HelloRandomizedNoALPN,
+	"golang":     nil,
+
+	"firefox":     &utls.HelloFirefox_Auto,
+	"firefox_55":  &utls.HelloFirefox_55,
+	"firefox_56":  &utls.HelloFirefox_56,
+	"firefox_63":  &utls.HelloFirefox_63,
+	"firefox_65":  &utls.HelloFirefox_65,
+	"firefox_99":  &utls.HelloFirefox_99,
+	"firefox_102": &utls.HelloFirefox_102,
+	"firefox_105": &utls.HelloFirefox_105,
+	"firefox_120": &utls.HelloFirefox_120,
+
+	"chrome":     &utls.HelloChrome_Auto,
+	"chrome_58":  &utls.HelloChrome_58,
+	"chrome_62":  &utls.HelloChrome_62,
+	"chrome_70":  &utls.HelloChrome_70,
+	"chrome_72":  &utls.HelloChrome_72,
+	"chrome_83":  &utls.HelloChrome_83,
+	"chrome_87":  &utls.HelloChrome_87,
+	"chrome_96":  &utls.HelloChrome_96,
+	"chrome_100": &utls.HelloChrome_100,
+	"chrome_102": &utls.HelloChrome_102,
+	"chrome_106": &utls.HelloChrome_106_Shuffle,
+	"chrome_120": &utls.HelloChrome_120,
+
+	"ios":      &utls.HelloIOS_Auto,
+	"ios_11_1": &utls.HelloIOS_11_1,
+	"ios_12_1": &utls.HelloIOS_12_1,
+	"ios_13":   &utls.HelloIOS_13,
+	"ios_14":   &utls.HelloIOS_14,
+
+	"android_11_okhttp": &utls.HelloAndroid_11_OkHttp,
+
+	"edge":     &utls.HelloEdge_Auto,
+	"edge_85":  &utls.HelloEdge_85,
+	"edge_106": &utls.HelloEdge_106,
+
+	"safari":      &utls.HelloSafari_Auto,
+	"safari_16_0": &utls.HelloSafari_16_0,
+
+	"360":      &utls.Hello360_Auto,
+	"360_7_5":  &utls.Hello360_7_5,
+	"360_11_0": &utls.Hello360_11_0,
+
+	"qq":      &utls.HelloQQ_Auto,
+	"qq_11_1": &utls.HelloQQ_11_1,
+}
+
+// Lookup returns the ClientHello ID for a dnstt fingerprint name, matched
+// case-insensitively. The ID is nil for "golang".
+func Lookup(name string) (*utls.ClientHelloID, bool) {
+	id, ok := helloIDs[strings.ToLower(strings.TrimSpace(name))]
+	return id, ok
+}
+
+// entry is one weighted name of a Distribution.
+type entry struct {
+	id     *utls.ClientHelloID
+	weight int
+}
+
+// Distribution is a weighted choice of ClientHello fingerprints.
+type Distribution []entry
+
+// Parse reads a distribution in dnstt-client's "4*random,3*Firefox_120"
+// format. A name without a weight counts once. An empty spec yields an
+// empty distribution, which always picks Go's own ClientHello.
+func Parse(spec string) (Distribution, error) {
+	var d Distribution
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weight := part, 1
+		if w, n, ok := strings.Cut(part, "*"); ok {
+			var err error
+			if weight, err = strconv.Atoi(strings.TrimSpace(w)); err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid weight in %q", part)
+			}
+			name = n
+		}
+		id, ok := Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown uTLS fingerprint %q", name)
+		}
+		d = append(d, entry{id: id, weight: weight})
+	}
+	return d, nil
+}
+
+// Pick draws a ClientHello ID from the distribution. nil means Go's own
+// ClientHello.
+func (d Distribution) Pick() *utls.ClientHelloID {
+	total := 0
+	for _, e := range d {
+		total += e.weight
+	}
+	if total == 0 {
+		return nil
+	}
+	x := rand.Intn(total)
+	for _, e := range d {
+		if x < e.weight {
+			return e.id
+		}
+		x -= e.weight
+	}
+	return nil
+}
+
+// Dial connects to addr and completes a TLS handshake presenting id's
+// ClientHello, or Go's own for a nil id. An empty cfg.ServerName is taken
+// from addr's host.
+func Dial(ctx context.Context, dialer *net.Dialer, network, addr string, cfg *utls.Config, id *utls.ClientHelloID) (*utls.UConn, error) {
+	if cfg == nil {
+		cfg = &utls.Config{}
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+	if id == nil {
+		id = &utls.HelloGolang
+	}
+
+	raw, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := utls.UClient(raw, cfg, *id)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,95 @@
+package fingerprint
+
+import (
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		want *utls.ClientHelloID
+		ok   bool
+	}{
+		{"Firefox_120", &utls.HelloFirefox_120, true},
+		{"firefox_120", &utls.HelloFirefox_120, true},
+		{" Chrome_120 ", &utls.HelloChrome_120, true},
+		{"iOS_14", &utls.HelloIOS_14, true},
+		{"random", &utls.HelloRandomizedNoALPN, true},
+		{"golang", nil, true},
+		{"none", nil, false},
+		{"Firefox_121", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := Lookup(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %v, %v; want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Distribution
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: " , ", want: nil},
+		{spec: "Chrome_120", want: Distribution{{&utls.HelloChrome_120, 1}}},
+		{
+			spec: "4*random,3*Firefox_120,1*Firefox_105,3*Chrome_120",
+			want: Distribution{
+				{&utls.HelloRandomizedNoALPN, 4},
+				{&utls.HelloFirefox_120, 3},
+				{&utls.HelloFirefox_105, 1},
+				{&utls.HelloChrome_120, 3},
+			},
+		},
+		{spec: " 2 * golang , iOS_14", want: Distribution{{nil, 2}, {&utls.HelloIOS_14, 1}}},
+		{spec: "0*random", wantErr: true},
+		{spec: "-1*random", wantErr: true},
+		{spec: "x*random", wantErr: true},
+		{spec: "random,none", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.spec, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Parse(%q)[%d] = %v, want %v", tt.spec, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	if id := Distribution(nil).Pick(); id != nil {
+		t.Errorf("empty distribution picked %v", id)
+	}
+
+	d, err := Parse("3*Firefox_120,1*Chrome_120")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[*utls.ClientHelloID]int{}
+	const n = 4000
+	for range n {
+		counts[d.Pick()]++
+	}
+	if len(counts) != 2 {
+		t.Fatalf("picked %d IDs, want 2", len(counts))
+	}
+	// Expect 3000 and 1000; allow a wide margin
+	if got := counts[&utls.HelloFirefox_120]; got < 2700 || got > 3300 {
+		t.Errorf("Firefox_120 picked %d of %d times, want about 3000", got, n)
+	}
+}
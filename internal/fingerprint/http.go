@@ -0,0 +1,111 @@
+package fingerprint
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+// Transport is an http.RoundTripper for HTTPS requests whose TLS
+// connections present a uTLS ClientHello. Browser fingerprints offer h2,
+// so it speaks HTTP/2 or HTTP/1.1, whichever its first connection
+// negotiated. Requests should all go to one origin.
+type Transport struct {
+	// Dialer makes the TCP connections
+	Dialer *net.Dialer
+
+	// Config is the TLS config; an empty ServerName is taken from the URL
+	Config *utls.Config
+
+	// ID is the ClientHello to present, nil for Go's own
+	ID *utls.ClientHelloID
+
+	mu    sync.Mutex
+	rt    http.RoundTripper
+	first net.Conn // the probing connection, reused by rt's first dial
+}
+
+// RoundTrip sends req over HTTP/2 or HTTP/1.1.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", req.URL.Scheme)
+	}
+	rt, err := t.roundTripper(req.Context(), req.URL)
+	if err != nil {
+		return nil, err
+	}
+	return rt.RoundTrip(req)
+}
+
+// roundTripper returns the HTTP/2 or HTTP/1.1 transport, dialing once to
+// learn which protocol the server negotiates.
+func (t *Transport) roundTripper(ctx context.Context, u *url.URL) (http.RoundTripper, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rt != nil {
+		return t.rt, nil
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	conn, err := t.dial(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	t.first = conn
+
+	if conn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		t.rt = &http2.Transport{
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return t.nextConn(ctx, network, addr)
+			},
+		}
+	} else {
+		t.rt = &http.Transport{DialTLSContext: t.nextConn}
+	}
+	return t.rt, nil
+}
+
+// nextConn hands out the probing connection first, then dials new ones.
+func (t *Transport) nextConn(ctx context.Context, network, addr string) (net.Conn, error) {
+	t.mu.Lock()
+	first := t.first
+	t.first = nil
+	t.mu.Unlock()
+	if first != nil {
+		return first, nil
+	}
+	return t.dial(ctx, network, addr)
+}
+
+// dial makes one TLS connection presenting t.ID.
+func (t *Transport) dial(ctx context.Context, network, addr string) (*utls.UConn, error) {
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	return Dial(ctx, dialer, network, addr, t.Config, t.ID)
+}
+
+// CloseIdleConnections closes idle connections of the underlying transport.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	rt, first := t.rt, t.first
+	t.first = nil
+	t.mu.Unlock()
+	if first != nil {
+		first.Close()
+	}
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,164 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// Target is what a health check examines.
+type Target struct {
+	// ProxyAddr is the tunnel's local address (dnstt-client or the front
+	// listener when standby sessions run)
+	ProxyAddr string
+
+	// Resolver is the resolver the tunnel is using
+	Resolver *resolver.Resolver
+}
+
+// Checker is one health check. Check returns nil if the target is healthy
+// and must give up when ctx is done.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, t Target) error
+}
+
+// weightedChecker is a Checker and its weight in the verdict.
+type weightedChecker struct {
+	checker Checker
+	weight  float64
+}
+
+// checkResult is the outcome of one Checker.
+type checkResult struct {
+	name   string
+	weight float64
+	err    error
+}
+
+// AddChecker adds a custom check alongside those from the configuration.
+// It must be called before Start.
+func (m *Monitor) AddChecker(c Checker, weight float64) {
+	m.custom = append(m.custom, weightedChecker{checker: c, weight: weight})
+}
+
+// SetExchanger sets how the dns check queries resolvers.
+func (m *Monitor) SetExchanger(exchange ExchangeFunc) {
+	m.exchange = exchange
+}
+
+// buildCheckers creates the configured checks: Checks if set, otherwise
+// the single Probe.
+func (m *Monitor) buildCheckers() []weightedChecker {
+	checks := m.config.Checks
+	if len(checks) == 0 {
+		checks = []config.HealthCheckConfig{{Type: m.config.Probe, Target: m.config.ProbeTarget}}
+	}
+
+	var checkers []weightedChecker
+	for _, cfg := range checks {
+		c := m.newChecker(cfg)
+		if c == nil {
+			continue
+		}
+		weight := cfg.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		checkers = append(checkers, weightedChecker{checker: c, weight: weight})
+	}
+	return append(checkers, m.custom...)
+}
+
+// newChecker creates the built-in Checker for cfg, or nil if the type is
+// unknown.
+func (m *Monitor) newChecker(cfg config.HealthCheckConfig) Checker {
+	switch cfg.Type {
+	case config.HealthProbeProcess:
+		return &ProcessChecker{Alive: m.tunnelMgr.IsConnected}
+	case config.HealthProbePort:
+		return &PortChecker{}
+	case config.HealthProbeHandshake, "":
+		return &HandshakeChecker{}
+	case config.HealthProbeConnect:
+		return &ConnectChecker{Target: cfg.Target, Username: m.proxyUser, Password: m.proxyPass}
+	case config.HealthProbeHTTP:
+		return &HTTPChecker{URL: cfg.URL, Username: m.proxyUser, Password: m.proxyPass}
+	case config.HealthProbeSSH:
+		return &SSHChecker{}
+	case config.HealthProbeEcho:
+		return &EchoChecker{Target: cfg.Target, Username: m.proxyUser, Password: m.proxyPass}
+	case config.HealthProbeDNS:
+		return &DNSChecker{Query: cfg.Target, Exchange: m.exchange}
+	case config.HealthProbeExec:
+		return &ExecChecker{Command: cfg.Command}
+	default:
+		return nil
+	}
+}
+
+// checkerNames lists checker names for logs.
+func checkerNames(checkers []weightedChecker) string {
+	names := make([]string, len(checkers))
+	for i, wc := range checkers {
+		names[i] = wc.checker.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// runCheckers runs all checkers concurrently and combines their results
+// under the configured policy.
+func (m *Monitor) runCheckers(ctx context.Context, t Target) error {
+	results := make([]checkResult, len(m.checkers))
+	var wg sync.WaitGroup
+	for i, wc := range m.checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = checkResult{
+				name:   wc.checker.Name(),
+				weight: wc.weight,
+				err:    wc.checker.Check(ctx, t),
+			}
+		}()
+	}
+	wg.Wait()
+
+	return verdict(m.config.Policy, m.config.PassWeight, results)
+}
+
+// verdict combines check results: all must pass, any may pass, or the
+// passing share of the total weight must reach passWeight.
+func verdict(policy string, passWeight float64, results []checkResult) error {
+	var failed []string
+	var passed, total float64
+	for _, r := range results {
+		total += r.weight
+		if r.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.name, r.err))
+			continue
+		}
+		passed += r.weight
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	ok := false
+	switch policy {
+	case config.HealthPolicyAny:
+		ok = len(failed) < len(results)
+	case config.HealthPolicyWeighted:
+		ok = total > 0 && passed/total >= passWeight
+	}
+	if ok {
+		log.Printf("[health] Passed under the %s policy despite %s", policy, strings.Join(failed, "; "))
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(failed, "; "))
+}
@@ -4,9 +4,7 @@ package health
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"net"
 	"sync"
 	"time"
 
@@ -29,13 +27,31 @@ const (
 
 // Monitor continuously monitors the health of the tunnel connection.
 type Monitor struct {
-	config     *config.HealthConfig
-	tunnelMgr  *tunnel.Manager
-	pool       *resolver.Pool
+	config    *config.HealthConfig
+	tunnelMgr *tunnel.Manager
+	pool      *resolver.Pool
+
+	// Credentials for the server-side SOCKS5 proxy (connect, echo and
+	// http probes)
+	proxyUser string
+	proxyPass string
+
+	// exchange sends the dns probe's queries
+	exchange ExchangeFunc
+
+	// checkers run on every check: the configured ones followed by custom
+	checkers []weightedChecker
+	custom   []weightedChecker
 
 	status     Status
 	statusMu   sync.RWMutex
 	failCount  int
+	decodeErrs int
+
+	// Query timeouts and tunnel session ends since the last check; they
+	// come in bursts on a working tunnel, so only checks count as failures
+	timeouts    int
+	sessionEnds int
 
 	// Event channels
 	onUnhealthy chan struct{}
@@ -66,7 +82,9 @@ func (m *Monitor) Start(ctx context.Context) error {
 	ticker := time.NewTicker(m.config.CheckInterval)
 	defer ticker.Stop()
 
-	log.Printf("Health monitor started (interval: %v)", m.config.CheckInterval)
+	m.checkers = m.buildCheckers()
+	log.Printf("Health monitor started (interval: %v, checks: %s, policy: %s)",
+		m.config.CheckInterval, checkerNames(m.checkers), m.config.Policy)
 
 	for {
 		select {
@@ -76,12 +94,61 @@ func (m *Monitor) Start(ctx context.Context) error {
 			return nil
 		case <-ticker.C:
 			m.check()
+		case ev := <-m.tunnelMgr.Events():
+			m.handleEvent(ev)
 		}
 	}
 }
 
+// handleEvent reacts to events reported by the running tunnel session.
+// Decode errors mean the resolver is rewriting our queries, so enough of
+// them within one check interval drops the resolver immediately instead
+// of waiting for FailThreshold failed checks. Timeouts and tunnel session
+// ends are only counted for the next check to report.
+func (m *Monitor) handleEvent(ev tunnel.Event) {
+	// Ignore late events from a session we already switched away from
+	current := m.tunnelMgr.CurrentResolver()
+	if current == nil || current.Address != ev.Resolver {
+		return
+	}
+
+	switch ev.Type {
+	case tunnel.EventDecodeError:
+		m.statusMu.Lock()
+		m.decodeErrs++
+		count := m.decodeErrs
+		m.statusMu.Unlock()
+
+		threshold := m.config.DecodeErrorThreshold
+		if threshold <= 0 || count < threshold {
+			return
+		}
+		log.Printf("[health] Resolver %s corrupting tunnel queries (%d decode errors)", ev.Resolver, count)
+		m.pool.MarkCorrupting(ev.Resolver)
+		m.markUnhealthy("resolver corrupting queries")
+	case tunnel.EventTimeout:
+		m.statusMu.Lock()
+		m.timeouts++
+		m.statusMu.Unlock()
+	case tunnel.EventTunnelSessionEnded:
+		m.statusMu.Lock()
+		m.sessionEnds++
+		m.statusMu.Unlock()
+	}
+}
+
 // check performs a single health check.
 func (m *Monitor) check() {
+	m.statusMu.Lock()
+	timeouts, sessionEnds := m.timeouts, m.sessionEnds
+	m.decodeErrs, m.timeouts, m.sessionEnds = 0, 0, 0
+	m.statusMu.Unlock()
+
+	var events string
+	if timeouts > 0 || sessionEnds > 0 {
+		events = fmt.Sprintf("%d timeouts and %d tunnel session ends since last check", timeouts, sessionEnds)
+	}
+
 	if !m.tunnelMgr.IsConnected() {
 		m.handleFailure("tunnel not connected")
 		return
@@ -99,70 +166,42 @@ func (m *Monitor) check() {
 	latency := time.Since(start)
 
 	if err != nil {
-		m.handleFailure(err.Error())
+		reason := err.Error()
+		if events != "" {
+			reason += " (" + events + ")"
+		}
+		m.handleFailure(reason)
 		m.pool.MarkFailed(r.Address)
 	} else {
+		if events != "" {
+			log.Printf("[health] Check passed despite %s", events)
+		}
 		m.handleSuccess(latency)
 		m.pool.MarkHealthy(r.Address, latency)
 	}
 }
 
-// checkResolver performs an ACTIVE connectivity check through the SOCKS proxy.
+// checkResolver performs an ACTIVE connectivity check through the tunnel,
+// running the configured checkers.
 func (m *Monitor) checkResolver(r *resolver.Resolver) error {
 	// First check if tunnel process is running
 	if !m.tunnelMgr.IsConnected() {
 		return &HealthError{message: "tunnel disconnected"}
 	}
 
-	// Active check: Try to connect through SOCKS5 proxy
+	// Active check: probe the tunnel through its local address
 	proxyAddr := m.tunnelMgr.LocalAddr()
 	if proxyAddr == "" {
 		proxyAddr = "127.0.0.1:7000"
 	}
 
-	// Test by connecting to a known endpoint through the SOCKS proxy
-	err := m.testSOCKS5Connection(proxyAddr)
-	if err != nil {
-		return &HealthError{message: fmt.Sprintf("SOCKS5 test failed: %v", err)}
-	}
+	ctx, cancel := context.WithTimeout(m.ctx, m.config.Timeout)
+	defer cancel()
 
-	return nil
-}
-
-// testSOCKS5Connection tests if SOCKS5 proxy is accepting connections.
-// This is a LIGHTWEIGHT check - only tests handshake, not full connection.
-// DNS tunneling is slow; we don't want to mark "unhealthy" just because it's overloaded.
-func (m *Monitor) testSOCKS5Connection(proxyAddr string) error {
-	// Connect to the SOCKS5 proxy with short timeout
-	conn, err := net.DialTimeout("tcp", proxyAddr, 2*time.Second)
-	if err != nil {
-		return fmt.Errorf("proxy unreachable: %w", err)
-	}
-	defer conn.Close()
-
-	// Short deadline for handshake only
-	conn.SetDeadline(time.Now().Add(3 * time.Second))
-
-	// SOCKS5 handshake - no auth
-	_, err = conn.Write([]byte{0x05, 0x01, 0x00})
-	if err != nil {
-		return fmt.Errorf("handshake write failed: %w", err)
-	}
-
-	// Read response: version(1) + method(1)
-	resp := make([]byte, 2)
-	_, err = io.ReadFull(conn, resp)
-	if err != nil {
-		return fmt.Errorf("handshake read failed: %w", err)
+	if err := m.runCheckers(ctx, Target{ProxyAddr: proxyAddr, Resolver: r}); err != nil {
+		return &HealthError{message: err.Error()}
 	}
 
-	if resp[0] != 0x05 {
-		return fmt.Errorf("invalid SOCKS5 version: %d", resp[0])
-	}
-
-	// Handshake successful - proxy is alive
-	// Don't test full CONNECT as it goes through slow DNS tunnel
-	log.Printf("[health] SOCKS5 handshake OK (proxy accepting connections)")
 	return nil
 }
 
@@ -192,6 +231,24 @@ func (m *Monitor) handleFailure(reason string) {
 	}
 }
 
+// markUnhealthy forces the unhealthy state and triggers a reconnect.
+func (m *Monitor) markUnhealthy(reason string) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	if m.status == StatusUnhealthy {
+		return
+	}
+	m.status = StatusUnhealthy
+	m.failCount = m.config.FailThreshold
+	log.Printf("[health] Connection marked as UNHEALTHY (%s) - triggering reconnect", reason)
+	select {
+	case m.onUnhealthy <- struct{}{}:
+	default:
+		log.Printf("[health] WARNING: unhealthy channel full, reconnect already pending")
+	}
+}
+
 // handleSuccess handles a successful health check.
 func (m *Monitor) handleSuccess(latency time.Duration) {
 	m.statusMu.Lock()
@@ -220,6 +277,9 @@ func (m *Monitor) Reset() {
 	m.statusMu.Lock()
 	defer m.statusMu.Unlock()
 	m.failCount = 0
+	m.decodeErrs = 0
+	m.timeouts = 0
+	m.sessionEnds = 0
 	m.status = StatusHealthy
 	log.Printf("[health] Monitor reset - status healthy")
 }
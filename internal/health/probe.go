@@ -0,0 +1,367 @@
+package health
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnsmsg"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/socks"
+)
+
+const (
+	// echoProbeSize is how many random bytes the echo probe sends
+	echoProbeSize = 16
+
+	// dnsProbeName is looked up by the dns probe when no target is set
+	dnsProbeName = "example.com"
+
+	// execOutputMax caps the command output quoted in exec probe errors
+	execOutputMax = 200
+)
+
+// ExchangeFunc sends a raw DNS query to a resolver over its transport and
+// returns the raw response.
+type ExchangeFunc func(ctx context.Context, address, resolverType string, query []byte) ([]byte, error)
+
+// SetProxyAuth sets the credentials the connect, echo and http probes
+// present to the SOCKS5 proxy on the server side of the tunnel. It must be
+// called before Start.
+func (m *Monitor) SetProxyAuth(username, password string) {
+	m.proxyUser = username
+	m.proxyPass = password
+}
+
+// ProcessChecker checks that the tunnel session is running.
+type ProcessChecker struct {
+	Alive func() bool
+}
+
+// Name implements Checker.
+func (c *ProcessChecker) Name() string { return "process" }
+
+// Check implements Checker.
+func (c *ProcessChecker) Check(ctx context.Context, t Target) error {
+	if !c.Alive() {
+		return fmt.Errorf("tunnel process not running")
+	}
+	return nil
+}
+
+// PortChecker checks that the tunnel's local address accepts connections.
+type PortChecker struct{}
+
+// Name implements Checker.
+func (c *PortChecker) Name() string { return "port" }
+
+// Check implements Checker.
+func (c *PortChecker) Check(ctx context.Context, t Target) error {
+	conn, err := dialLocal(ctx, t.ProxyAddr)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// HandshakeChecker tests if SOCKS5 proxy is accepting connections.
+// This is a LIGHTWEIGHT check - only tests handshake, not full connection.
+// dnstt-client accepts connections even when the resolver drops every
+// query, so this can't detect a dead tunnel; the other probes can.
+type HandshakeChecker struct{}
+
+// Name implements Checker.
+func (c *HandshakeChecker) Name() string { return "handshake" }
+
+// Check implements Checker.
+func (c *HandshakeChecker) Check(ctx context.Context, t Target) error {
+	conn, err := dialLocal(ctx, t.ProxyAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// SOCKS5 handshake - no auth
+	_, err = conn.Write([]byte{0x05, 0x01, 0x00})
+	if err != nil {
+		return fmt.Errorf("handshake write failed: %w", err)
+	}
+
+	// Read response: version(1) + method(1)
+	resp := make([]byte, 2)
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		return fmt.Errorf("handshake read failed: %w", err)
+	}
+
+	if resp[0] != 0x05 {
+		return fmt.Errorf("invalid SOCKS5 version: %d", resp[0])
+	}
+
+	// Handshake successful - proxy is alive
+	log.Printf("[health] SOCKS5 handshake OK (proxy accepting connections)")
+	return nil
+}
+
+// ConnectChecker opens a stream through the tunnel and has the server-side
+// SOCKS5 proxy connect to Target. The CONNECT reply only arrives after a
+// full round trip through the resolver, so even a refusal from the proxy
+// shows the tunnel is working.
+type ConnectChecker struct {
+	Target string
+
+	// Username and Password authenticate to the server-side proxy (optional)
+	Username string
+	Password string
+}
+
+// Name implements Checker.
+func (c *ConnectChecker) Name() string { return "connect" }
+
+// Check implements Checker.
+func (c *ConnectChecker) Check(ctx context.Context, t Target) error {
+	conn, err := dialThrough(ctx, t.ProxyAddr, c.Username, c.Password, c.Target)
+	var replyErr *socks.ReplyError
+	if errors.As(err, &replyErr) {
+		log.Printf("[health] Tunnel OK, but the server could not reach %s: %v", c.Target, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// HTTPChecker fetches URL through the server-side SOCKS5 proxy and expects
+// a 2xx or 3xx status.
+type HTTPChecker struct {
+	URL string
+
+	// Username and Password authenticate to the server-side proxy (optional)
+	Username string
+	Password string
+}
+
+// Name implements Checker.
+func (c *HTTPChecker) Name() string { return "http" }
+
+// Check implements Checker.
+func (c *HTTPChecker) Check(ctx context.Context, t Target) error {
+	dialer := &socks.UpstreamDialer{
+		ProxyAddr: func() string { return t.ProxyAddr },
+		Username:  c.Username,
+		Password:  c.Password,
+	}
+	transport := &http.Transport{
+		DialContext:       dialer.DialContext,
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return fmt.Errorf("create request failed: %w", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("GET %s failed: %w", c.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s: %s", c.URL, resp.Status)
+	}
+	return nil
+}
+
+// SSHChecker reads the banner of the SSH server at the far end of the
+// tunnel.
+type SSHChecker struct{}
+
+// Name implements Checker.
+func (c *SSHChecker) Name() string { return "ssh" }
+
+// Check implements Checker.
+func (c *SSHChecker) Check(ctx context.Context, t Target) error {
+	conn, err := dialLocal(ctx, t.ProxyAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Servers may send other lines before the version line (RFC 4253 4.2)
+	r := bufio.NewReaderSize(io.LimitReader(conn, 4096), 256)
+	for {
+		line, err := r.ReadString('\n')
+		if strings.HasPrefix(line, "SSH-") {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("no SSH banner: %w", err)
+		}
+	}
+}
+
+// EchoChecker sends random bytes to the echo service at Target through the
+// server-side SOCKS5 proxy and checks they come back unchanged.
+type EchoChecker struct {
+	Target string
+
+	// Username and Password authenticate to the server-side proxy (optional)
+	Username string
+	Password string
+}
+
+// Name implements Checker.
+func (c *EchoChecker) Name() string { return "echo" }
+
+// Check implements Checker.
+func (c *EchoChecker) Check(ctx context.Context, t Target) error {
+	conn, err := dialThrough(ctx, t.ProxyAddr, c.Username, c.Password, c.Target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	payload := make([]byte, echoProbeSize)
+	rand.Read(payload)
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("echo write failed: %w", err)
+	}
+	reply := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("echo read failed: %w", err)
+	}
+	if !bytes.Equal(reply, payload) {
+		return fmt.Errorf("echo reply mismatch")
+	}
+	return nil
+}
+
+// DNSChecker looks Query up through the current resolver directly,
+// outside the tunnel, to tell a dead resolver from a dead tunnel server.
+type DNSChecker struct {
+	// Query is the name looked up (default example.com)
+	Query string
+
+	// Exchange sends the query over the resolver's transport
+	Exchange ExchangeFunc
+}
+
+// Name implements Checker.
+func (c *DNSChecker) Name() string { return "dns" }
+
+// Check implements Checker.
+func (c *DNSChecker) Check(ctx context.Context, t Target) error {
+	if c.Exchange == nil {
+		return fmt.Errorf("no DNS transport configured")
+	}
+	if t.Resolver == nil {
+		return fmt.Errorf("no current resolver")
+	}
+
+	name := c.Query
+	if name == "" {
+		name = dnsProbeName
+	}
+	var idBytes [2]byte
+	rand.Read(idBytes[:])
+	id := binary.BigEndian.Uint16(idBytes[:])
+	query, err := dnsmsg.NewQuery(id, name, dnsmsg.TypeA, 0)
+	if err != nil {
+		return err
+	}
+	response, err := c.Exchange(ctx, t.Resolver.Address, t.Resolver.Type, query)
+	if err != nil {
+		return err
+	}
+	m, err := dnsmsg.Parse(response)
+	if err != nil {
+		return fmt.Errorf("bad response: %w", err)
+	}
+	if !m.Response() || m.ID != id {
+		return fmt.Errorf("response does not match query")
+	}
+	if rcode := m.Rcode(); rcode != dnsmsg.RcodeSuccess && rcode != dnsmsg.RcodeNXDomain {
+		return fmt.Errorf("resolver answered rcode %d", rcode)
+	}
+	return nil
+}
+
+// ExecChecker runs Command with the tunnel's local address and resolver
+// in DNS_TUNNEL_PROXY, DNS_TUNNEL_RESOLVER and DNS_TUNNEL_RESOLVER_TYPE.
+// Exit status 0 is healthy.
+type ExecChecker struct {
+	Command []string
+}
+
+// Name implements Checker.
+func (c *ExecChecker) Name() string { return "exec" }
+
+// Check implements Checker.
+func (c *ExecChecker) Check(ctx context.Context, t Target) error {
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	cmd.Env = append(os.Environ(), "DNS_TUNNEL_PROXY="+t.ProxyAddr)
+	if t.Resolver != nil {
+		cmd.Env = append(cmd.Env,
+			"DNS_TUNNEL_RESOLVER="+t.Resolver.Address,
+			"DNS_TUNNEL_RESOLVER_TYPE="+t.Resolver.Type)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		out := strings.TrimSpace(string(output))
+		if len(out) > execOutputMax {
+			out = out[:execOutputMax] + "..."
+		}
+		if out != "" {
+			return fmt.Errorf("%s: %w: %s", c.Command[0], err, out)
+		}
+		return fmt.Errorf("%s: %w", c.Command[0], err)
+	}
+	return nil
+}
+
+// dialLocal connects to the tunnel's local address, with the connection
+// deadline set from ctx.
+func dialLocal(ctx context.Context, proxyAddr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy unreachable: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// dialThrough connects to target through the server-side SOCKS5 proxy.
+func dialThrough(ctx context.Context, proxyAddr, username, password, target string) (net.Conn, error) {
+	dialer := &socks.UpstreamDialer{
+		ProxyAddr: func() string { return proxyAddr },
+		Username:  username,
+		Password:  password,
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s failed: %w", target, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,54 @@
+package httpproxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// GeneratePAC builds a proxy auto-config script that sends traffic to
+// proxyAddr except for hosts matching bypass. Bypass entries may be
+// CIDR blocks ("10.0.0.0/8"), domain suffixes (".ir") or exact host
+// names ("localhost"). CIDR checks only apply to IP literals so the
+// script never triggers DNS lookups outside the tunnel.
+func GeneratePAC(proxyAddr string, bypass []string) string {
+	var b strings.Builder
+
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  if (isPlainHostName(host)) return \"DIRECT\";\n")
+
+	var nets []string
+	for _, entry := range bypass {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ip4 := ipNet.IP.To4(); ip4 != nil {
+				nets = append(nets, fmt.Sprintf("isInNet(host, %q, %q)", ip4.String(), net.IP(ipNet.Mask).String()))
+			}
+			continue
+		}
+
+		if strings.HasPrefix(entry, ".") {
+			fmt.Fprintf(&b, "  if (dnsDomainIs(host, %q) || host == %q) return \"DIRECT\";\n",
+				entry, strings.TrimPrefix(entry, "."))
+		} else {
+			fmt.Fprintf(&b, "  if (host == %q) return \"DIRECT\";\n", entry)
+		}
+	}
+
+	if len(nets) > 0 {
+		b.WriteString("  if (/^\\d+\\.\\d+\\.\\d+\\.\\d+$/.test(host)) {\n")
+		for _, n := range nets {
+			fmt.Fprintf(&b, "    if (%s) return \"DIRECT\";\n", n)
+		}
+		b.WriteString("  }\n")
+	}
+
+	fmt.Fprintf(&b, "  return \"PROXY %s\";\n", proxyAddr)
+	b.WriteString("}\n")
+
+	return b.String()
+}
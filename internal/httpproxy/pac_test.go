@@ -0,0 +1,52 @@
+package httpproxy
+
+import "testing"
+
+func TestGeneratePAC(t *testing.T) {
+	tests := []struct {
+		name   string
+		bypass []string
+		want   string
+	}{
+		{
+			name: "no bypass",
+			want: `function FindProxyForURL(url, host) {
+  if (isPlainHostName(host)) return "DIRECT";
+  return "PROXY 127.0.0.1:8118";
+}
+`,
+		},
+		{
+			name:   "hosts and domain suffixes",
+			bypass: []string{"localhost", " .ir ", ""},
+			want: `function FindProxyForURL(url, host) {
+  if (isPlainHostName(host)) return "DIRECT";
+  if (host == "localhost") return "DIRECT";
+  if (dnsDomainIs(host, ".ir") || host == "ir") return "DIRECT";
+  return "PROXY 127.0.0.1:8118";
+}
+`,
+		},
+		{
+			name:   "CIDR blocks only match IPv4 literals",
+			bypass: []string{"10.0.0.0/8", "192.168.1.7/16", "fd00::/8", "localhost"},
+			want: `function FindProxyForURL(url, host) {
+  if (isPlainHostName(host)) return "DIRECT";
+  if (host == "localhost") return "DIRECT";
+  if (/^\d+\.\d+\.\d+\.\d+$/.test(host)) {
+    if (isInNet(host, "10.0.0.0", "255.0.0.0")) return "DIRECT";
+    if (isInNet(host, "192.168.0.0", "255.255.0.0")) return "DIRECT";
+  }
+  return "PROXY 127.0.0.1:8118";
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GeneratePAC("127.0.0.1:8118", tt.bypass); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Package httpproxy provides an HTTP/1.1 forward proxy that carries
+// requests over the tunnel.
+package httpproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+)
+
+// Dialer opens outbound connections for proxied requests.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// hopHeaders are removed when forwarding plain HTTP requests (RFC 7230 6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Server is an HTTP forward proxy supporting CONNECT and plain HTTP.
+type Server struct {
+	config    *config.HTTPProxyConfig
+	dialer    Dialer
+	transport *http.Transport
+
+	mu     sync.RWMutex
+	server *http.Server
+}
+
+// New creates an HTTP proxy that dials through dialer.
+func New(cfg *config.HTTPProxyConfig, dialer Dialer) *Server {
+	return &Server{
+		config: cfg,
+		dialer: dialer,
+		transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          32,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: cfg.DialTimeout,
+		},
+	}
+}
+
+// Start listens on the configured address and serves until Stop is called.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	s.server = &http.Server{
+		Addr:              s.config.Listen,
+		Handler:           s,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	srv := s.server
+	s.mu.Unlock()
+
+	log.Printf("[http-proxy] Listening on %s", s.config.Listen)
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop shuts down the proxy.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.RLock()
+	srv := s.server
+	s.mu.RUnlock()
+	if srv == nil {
+		return nil
+	}
+	s.transport.CloseIdleConnections()
+	return srv.Shutdown(ctx)
+}
+
+// ServeHTTP dispatches CONNECT tunnels and plain HTTP requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		s.handleConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "This is a proxy server; absolute URL required", http.StatusBadRequest)
+		return
+	}
+	s.handleHTTP(w, r)
+}
+
+// handleConnect opens a raw tunnel to the requested host:port.
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	dest := r.Host
+	if _, _, err := net.SplitHostPort(dest); err != nil {
+		dest = net.JoinHostPort(dest, "443")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.DialTimeout)
+	upstream, err := s.dialer.DialContext(ctx, "tcp", dest)
+	cancel()
+	if err != nil {
+		log.Printf("[http-proxy] CONNECT %s: %v", dest, err)
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		log.Printf("[http-proxy] Hijack failed: %v", err)
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return
+	}
+
+	// Forward anything the client sent after the CONNECT request
+	if n := buf.Reader.Buffered(); n > 0 {
+		data, _ := buf.Reader.Peek(n)
+		if _, err := upstream.Write(data); err != nil {
+			return
+		}
+	}
+
+	pipe(client, upstream)
+}
+
+// handleHTTP forwards a plain HTTP request.
+func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+
+	resp, err := s.transport.RoundTrip(out)
+	if err != nil {
+		log.Printf("[http-proxy] %s %s: %v", r.Method, r.URL, err)
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// removeHopHeaders strips hop-by-hop headers, including any named in Connection.
+func removeHopHeaders(h http.Header) {
+	for _, f := range h.Values("Connection") {
+		for _, name := range strings.Split(f, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// pipe copies data in both directions until both sides close.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if tc, ok := dst.(interface{ CloseWrite() error }); ok {
+			tc.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	<-done
+}
+
+// ProxyAddr returns the address clients should use to reach the proxy.
+// If the proxy listens on all interfaces, requestHost (the host a client
+// used to reach us) supplies the IP.
+func (s *Server) ProxyAddr(requestHost string) string {
+	if s.config.PACProxyHost != "" {
+		_, port, _ := net.SplitHostPort(s.config.Listen)
+		return net.JoinHostPort(s.config.PACProxyHost, port)
+	}
+
+	host, port, err := net.SplitHostPort(s.config.Listen)
+	if err != nil {
+		return s.config.Listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+		if requestHost != "" {
+			if h, _, err := net.SplitHostPort(requestHost); err == nil {
+				host = h
+			} else {
+				host = requestHost
+			}
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// PAC returns a proxy auto-config script pointing browsers at this proxy.
+func (s *Server) PAC(requestHost string) string {
+	return GeneratePAC(s.ProxyAddr(requestHost), s.config.PACBypass)
+}
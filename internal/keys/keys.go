@@ -0,0 +1,85 @@
+// Package keys generates and stores dnstt Curve25519 keypairs. Key files
+// use dnstt's format: the 32-byte key as lowercase hex followed by a newline.
+package keys
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// KeyLen is the length of a Curve25519 key in bytes.
+const KeyLen = 32
+
+// Generate creates a new Curve25519 keypair.
+func Generate() (priv, pub []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key: %w", err)
+	}
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// PubKey derives the public key for a private key.
+func PubKey(priv []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return key.PublicKey().Bytes(), nil
+}
+
+// WriteFiles writes the keypair to privPath and pubPath. Existing files
+// are only replaced when overwrite is set.
+func WriteFiles(privPath, pubPath string, priv, pub []byte, overwrite bool) error {
+	if err := writeKeyFile(privPath, priv, 0600, overwrite); err != nil {
+		return err
+	}
+	return writeKeyFile(pubPath, pub, 0644, overwrite)
+}
+
+// WritePubKeyFile writes a public key file, replacing any existing one.
+func WritePubKeyFile(path string, pub []byte) error {
+	return writeKeyFile(path, pub, 0644, true)
+}
+
+// writeKeyFile writes one hex-encoded key file.
+func writeKeyFile(path string, key []byte, perm os.FileMode, overwrite bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating key directory: %w", err)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		return fmt.Errorf("writing key file: %w", err)
+	}
+	if _, err := fmt.Fprintf(f, "%x\n", key); err != nil {
+		f.Close()
+		return fmt.Errorf("writing key file: %w", err)
+	}
+	return f.Close()
+}
+
+// ReadPrivKeyFile reads a private key file in dnstt's format.
+func ReadPrivKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading privkey file: %w", err)
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("privkey file %s: %w", path, err)
+	}
+	if len(key) != KeyLen {
+		return nil, fmt.Errorf("privkey file %s: key is %d bytes, want %d", path, len(key), KeyLen)
+	}
+	return key, nil
+}
@@ -0,0 +1,66 @@
+// Package logline splits a child process's output into lines, logs them
+// and hands each one to a callback.
+package logline
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Writer is an io.Writer for a command's Stdout or Stderr. Each complete
+// line is logged with Prefix and passed to OnLine; blank lines are
+// dropped.
+type Writer struct {
+	prefix string
+	onLine func(line string)
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// New creates a Writer that logs lines as "[prefix] line" and calls
+// onLine (optional) with each of them.
+func New(prefix string, onLine func(line string)) *Writer {
+	return &Writer{prefix: prefix, onLine: onLine}
+}
+
+// Write buffers output and handles each complete line
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.handleLine(string(bytes.TrimRight(w.buf[:i], "\r")))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush handles any trailing output not terminated by a newline
+func (w *Writer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.handleLine(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// handleLine logs one line of output and passes it on
+func (w *Writer) handleLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	log.Printf("[%s] %s", w.prefix, line)
+	if w.onLine != nil {
+		w.onLine(line)
+	}
+}
@@ -0,0 +1,57 @@
+package logline
+
+import (
+	"bytes"
+	"log"
+	"slices"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var logged bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&logged)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{"single line", []string{"listening\n"}, []string{"listening"}},
+		{"split across writes", []string{"conn", "ected\nre", "ady\n"}, []string{"connected", "ready"}},
+		{"CRLF", []string{"one\r\ntwo\r\n"}, []string{"one", "two"}},
+		{"blank lines dropped", []string{"\n  \none\n\n"}, []string{"one"}},
+		{"trailing output flushed", []string{"one\ntwo"}, []string{"one", "two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged.Reset()
+			var got []string
+			w := New("dnstt", func(line string) { got = append(got, line) })
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write = %d, %v", n, err)
+				}
+			}
+			w.Flush()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lines %q, want %q", got, tt.want)
+			}
+			var want bytes.Buffer
+			for _, line := range tt.want {
+				want.WriteString("[dnstt] " + line + "\n")
+			}
+			if logged.String() != want.String() {
+				t.Errorf("logged %q, want %q", logged.String(), want.String())
+			}
+		})
+	}
+
+	// onLine is optional
+	New("dnstt", nil).Write([]byte("no callback\n"))
+}
@@ -0,0 +1,185 @@
+// Package profile encodes signed client profiles: everything a client
+// needs to reach a tunnel server (domain, public key, seed resolvers and
+// transport preferences) as a YAML bundle, a dnstunnel:// URI or a QR code.
+package profile
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+	"gopkg.in/yaml.v3"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/keys"
+)
+
+// URIScheme prefixes compact profile URIs.
+const URIScheme = "dnstunnel://"
+
+// Version is the current profile format version.
+const Version = 1
+
+// signingContext separates the profile signing key from the tunnel key
+// it is derived from.
+const signingContext = "dns-tunnel profile signing key v1"
+
+// Profile is a signed client bundle. JSON tags are kept short because
+// the JSON form is what goes into the URI and QR code.
+type Profile struct {
+	Version         int      `yaml:"dns_tunnel_profile" json:"v"`
+	Domain          string   `yaml:"domain" json:"d"`
+	PubKey          string   `yaml:"pubkey" json:"k"`
+	Resolvers       []string `yaml:"resolvers,omitempty" json:"r,omitempty"`
+	ResolverType    string   `yaml:"resolver_type,omitempty" json:"t,omitempty"`
+	UTLSFingerprint string   `yaml:"utls_fingerprint,omitempty" json:"u,omitempty"`
+	Signer          string   `yaml:"signer" json:"s"`
+	Signature       string   `yaml:"signature" json:"g"`
+}
+
+// signingKey derives the Ed25519 profile signing key from the server's
+// Curve25519 private key, so one secret backs both.
+func signingKey(serverPriv []byte) ed25519.PrivateKey {
+	seed := sha256.Sum256(append([]byte(signingContext), serverPriv...))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// Sign sets Signer and Signature using the server's private key. It
+// fails if PubKey does not belong to that private key.
+func (p *Profile) Sign(serverPriv []byte) error {
+	pub, err := keys.PubKey(serverPriv)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprintf("%x", pub) != strings.ToLower(p.PubKey) {
+		return fmt.Errorf("profile pubkey does not match the server private key")
+	}
+	p.PubKey = strings.ToLower(p.PubKey)
+
+	key := signingKey(serverPriv)
+	p.Version = Version
+	p.Signer = base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	msg, err := p.signedBytes()
+	if err != nil {
+		return err
+	}
+	p.Signature = base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, msg))
+	return nil
+}
+
+// Verify checks the signature against the embedded signer key. On its own
+// this only shows the bundle is intact; Parse also checks the signer
+// against a fingerprint the user got from the server operator.
+func (p *Profile) Verify() error {
+	if p.Version != Version {
+		return fmt.Errorf("unsupported profile version %d", p.Version)
+	}
+	signer, err := base64.RawURLEncoding.DecodeString(p.Signer)
+	if err != nil || len(signer) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid profile signer")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(p.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid profile signature encoding")
+	}
+	msg, err := p.signedBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(signer, msg, sig) {
+		return fmt.Errorf("profile signature does not verify")
+	}
+	return nil
+}
+
+// SignerFingerprint returns the fingerprint of the signer key that
+// clients pin to accept the profile.
+func (p *Profile) SignerFingerprint() string {
+	signer, _ := base64.RawURLEncoding.DecodeString(p.Signer)
+	sum := sha256.Sum256(signer)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// signedBytes returns the canonical encoding covered by the signature:
+// the JSON form with Signature cleared.
+func (p *Profile) signedBytes() ([]byte, error) {
+	c := *p
+	c.Signature = ""
+	return json.Marshal(&c)
+}
+
+// YAML returns the profile as a YAML bundle.
+func (p *Profile) YAML() ([]byte, error) {
+	return yaml.Marshal(p)
+}
+
+// URI returns the profile as a compact dnstunnel:// URI.
+func (p *Profile) URI() (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return URIScheme + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// QR renders the profile URI as a QR code for display in a terminal.
+func (p *Profile) QR() (string, error) {
+	uri, err := p.URI()
+	if err != nil {
+		return "", err
+	}
+	qr, err := qrcode.New(uri, qrcode.Low)
+	if err != nil {
+		return "", fmt.Errorf("encoding QR code: %w", err)
+	}
+	return qr.ToSmallString(false), nil
+}
+
+// IsProfile reports whether data looks like a profile URI or YAML bundle
+// rather than a regular configuration file.
+func IsProfile(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte(URIScheme)) {
+		return true
+	}
+	var probe struct {
+		Version int `yaml:"dns_tunnel_profile"`
+	}
+	return yaml.Unmarshal(data, &probe) == nil && probe.Version > 0
+}
+
+// Parse decodes a profile URI or YAML bundle, verifies its signature and
+// checks that it was signed by the key with fingerprint signer. Anyone
+// can sign a bundle with a key of their own, so a profile is only trusted
+// when its signer is pinned.
+func Parse(data []byte, signer string) (*Profile, error) {
+	data = bytes.TrimSpace(data)
+
+	var p Profile
+	if s := string(data); strings.HasPrefix(s, URIScheme) {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, URIScheme))
+		if err != nil {
+			return nil, fmt.Errorf("decoding profile URI: %w", err)
+		}
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, fmt.Errorf("parsing profile URI: %w", err)
+		}
+	} else if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing profile: %w", err)
+	}
+
+	if err := p.Verify(); err != nil {
+		return nil, err
+	}
+	if signer == "" {
+		return nil, fmt.Errorf("profile signer is not pinned; supply the signer fingerprint the server operator published")
+	}
+	if p.SignerFingerprint() != signer {
+		return nil, fmt.Errorf("profile signed by %s, expected %s", p.SignerFingerprint(), signer)
+	}
+	return &p, nil
+}
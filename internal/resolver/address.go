@@ -0,0 +1,92 @@
+package resolver
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// Address family preferences for resolver selection and scanning.
+const (
+	FamilyBoth     = "both"
+	FamilyPreferV4 = "prefer-v4"
+	FamilyPreferV6 = "prefer-v6"
+)
+
+// ValidFamily reports whether family is a known address family preference.
+func ValidFamily(family string) bool {
+	switch family {
+	case FamilyBoth, FamilyPreferV4, FamilyPreferV6:
+		return true
+	}
+	return false
+}
+
+// Host returns the host part of a resolver address: an IP or hostname
+// from ip:port, [ipv6]:port, a bare IP, a tls:// address or a DoH URL.
+func Host(address string) string {
+	if strings.HasPrefix(address, "https://") || strings.HasPrefix(address, "http://") {
+		if u, err := url.Parse(address); err == nil {
+			return u.Hostname()
+		}
+		return ""
+	}
+	address = strings.TrimPrefix(address, "tls://")
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
+
+// IsIPv6 reports whether the resolver address is an IPv6 literal.
+func IsIPv6(address string) bool {
+	ip, err := netip.ParseAddr(Host(address))
+	return err == nil && !ip.Unmap().Is4()
+}
+
+// HostPort returns address as host:port for dialing, adding port if it has
+// none. IPv6 hosts are bracketed; a bare IPv6 address never carries a port.
+func HostPort(address, port string) string {
+	address = strings.TrimPrefix(address, "tls://")
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), port)
+}
+
+// hasPort reports whether address is host:port with the given port.
+// Bare IPv6 addresses have no port.
+func hasPort(address, port string) bool {
+	_, p, err := net.SplitHostPort(address)
+	return err == nil && p == port
+}
+
+// NormalizeAddress gives IPv6 literals the bracketed [ip]:port form with
+// the type's default port, so one resolver has one pool entry. Other
+// addresses are returned unchanged.
+func NormalizeAddress(address, resolverType string) string {
+	if resolverType == "doh" || strings.HasPrefix(address, "https://") || !IsIPv6(address) {
+		return address
+	}
+	if resolverType == "dot" {
+		prefix := ""
+		if strings.HasPrefix(address, "tls://") {
+			prefix = "tls://"
+		}
+		return prefix + HostPort(address, "853")
+	}
+	return HostPort(address, "53")
+}
+
+// preferred reports whether a resolver matches the family preference.
+func preferred(address, family string) bool {
+	switch family {
+	case FamilyPreferV4:
+		return !IsIPv6(address)
+	case FamilyPreferV6:
+		return IsIPv6(address)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,78 @@
+package resolver
+
+import "time"
+
+// How a resolver handles responses too big to pass.
+const (
+	TruncationTC   = "tc"   // answers with the TC bit set
+	TruncationDrop = "drop" // drops or mangles the response
+)
+
+// Capacity reference points for scoring.
+const (
+	// capacityRefQPS is the sustained query rate that scores 0.5
+	capacityRefQPS = 50
+
+	// capacityRefResponse is the response size that scores full marks
+	capacityRefResponse = 1232
+)
+
+// Capacity is a resolver's measured tunnel capacity.
+type Capacity struct {
+	// QPS is the highest query rate forwarded with acceptable loss
+	QPS float64
+
+	// Loss is the fraction of queries lost at QPS (or at the lowest rate
+	// tried, if none was acceptable)
+	Loss float64
+
+	// Truncation is how responses above MaxResponse are handled
+	// (Truncation* constants); empty if every size tried got through
+	Truncation string
+
+	// TCP is set if the resolver answers queries over TCP
+	TCP bool
+
+	// MeasuredAt is when the benchmark ran; zero if never benchmarked
+	MeasuredAt time.Time
+}
+
+// SetCapacity records a capacity benchmark result.
+func (p *Pool) SetCapacity(address string, c Capacity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			r.Capacity = c
+			return
+		}
+	}
+}
+
+// BenchmarkDue returns copies of usable resolvers of the given type that
+// were never benchmarked or not within maxAge.
+func (p *Pool) BenchmarkDue(resolverType string, maxAge time.Duration) []Resolver {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	var due []Resolver
+	for _, r := range p.resolvers {
+		if r.Type == resolverType && r.usable() && now.Sub(r.Capacity.MeasuredAt) >= maxAge {
+			due = append(due, *r.clone())
+		}
+	}
+	return due
+}
+
+// capacityScore rates benchmarked query rate and response size from 0 to
+// 1; resolvers never benchmarked score 0.5.
+func (r *Resolver) capacityScore() float64 {
+	if r.Capacity.MeasuredAt.IsZero() {
+		return 0.5
+	}
+	qps := r.Capacity.QPS / (r.Capacity.QPS + capacityRefQPS)
+	size := min(float64(r.MaxResponse)/capacityRefResponse, 1)
+	return 0.7*qps + 0.3*size
+}
@@ -2,6 +2,8 @@
 package resolver
 
 import (
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,8 +20,43 @@ const (
 	StatusDegraded
 	// StatusBlocked indicates the resolver is blocked or not working.
 	StatusBlocked
+	// StatusIncompatible indicates the resolver answers DNS but mangles
+	// or drops tunnel queries.
+	StatusIncompatible
 )
 
+// String returns the lowercase status name.
+func (s Status) String() string {
+	switch s {
+	case StatusHealthy:
+		return "healthy"
+	case StatusDegraded:
+		return "degraded"
+	case StatusBlocked:
+		return "blocked"
+	case StatusIncompatible:
+		return "incompatible"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseStatus converts a status name back to a Status (unknown if unrecognized).
+func ParseStatus(s string) Status {
+	switch s {
+	case "healthy":
+		return StatusHealthy
+	case "degraded":
+		return StatusDegraded
+	case "blocked":
+		return StatusBlocked
+	case "incompatible":
+		return StatusIncompatible
+	default:
+		return StatusUnknown
+	}
+}
+
 // Resolver represents a DNS resolver with its status.
 type Resolver struct {
 	// Address is the resolver address (e.g., "8.8.8.8:53" or "https://dns.google/dns-query")
@@ -28,6 +65,10 @@ type Resolver struct {
 	// Type is the resolver type: "udp", "doh", or "dot"
 	Type string
 
+	// ServerName is the TLS name of a DoH or DoT resolver whose address is
+	// an IP its certificate doesn't cover; empty otherwise
+	ServerName string
+
 	// Status is the current health status
 	Status Status
 
@@ -37,11 +78,73 @@ type Resolver struct {
 	// FailCount is the number of consecutive failures
 	FailCount int
 
-	// Latency is the average response latency
+	// Latency is the average response latency (exponentially weighted)
 	Latency time.Duration
 
 	// BlockedAt is when the resolver was marked as blocked
 	BlockedAt time.Time
+
+	// Corrupting is set when the resolver was seen mangling tunnel queries
+	Corrupting bool
+
+	// Origin records where the resolver came from (see Origin* constants)
+	Origin string
+
+	// Source is the resolver list a scanned resolver was found in
+	Source string
+
+	// AddedAt is when the resolver first entered the pool
+	AddedAt time.Time
+
+	// BlockCount is how many times the resolver has been blocked
+	BlockCount int
+
+	// BlockHistory holds the most recent block times, oldest first
+	BlockHistory []time.Time
+
+	// BlockStreak counts blocks in quick succession; it sets the cooldown length
+	BlockStreak int
+
+	// CooldownUntil is when a blocked resolver becomes due for a re-probe
+	CooldownUntil time.Time
+
+	// ReleasedAt is when the resolver last left quarantine
+	ReleasedAt time.Time
+
+	// Successes and Failures count probe outcomes
+	Successes int
+	Failures  int
+
+	// Reliability is the exponentially weighted success rate (0 to 1)
+	Reliability float64
+
+	// MaxResponse is the largest DNS response (bytes) the tunnel probe got
+	// through intact; 0 if not probed
+	MaxResponse int
+
+	// Capacity is the last capacity benchmark result
+	Capacity Capacity
+}
+
+// Resolver origins.
+const (
+	OriginSeed = "seed"
+	OriginTXT  = "txt"
+	OriginScan = "scan"
+)
+
+// TypeForAddress infers the resolver type from the address format.
+// URLs ("https://...") are DoH, "tls://" prefixes and port 853 are DoT;
+// anything else falls back to the given default type.
+func TypeForAddress(address, fallback string) string {
+	switch {
+	case strings.HasPrefix(address, "https://"):
+		return "doh"
+	case strings.HasPrefix(address, "tls://"), hasPort(address, "853"):
+		return "dot"
+	default:
+		return fallback
+	}
 }
 
 // Pool manages a collection of DNS resolvers.
@@ -49,6 +152,11 @@ type Pool struct {
 	mu        sync.RWMutex
 	resolvers []*Resolver
 	current   int
+
+	cooldownBase time.Duration
+	cooldownMax  time.Duration
+	strategy     Strategy
+	family       string
 }
 
 // NewPool creates a new resolver pool.
@@ -56,11 +164,42 @@ func NewPool() *Pool {
 	return &Pool{
 		resolvers: make([]*Resolver, 0),
 		current:   0,
+		strategy:  roundRobin{},
 	}
 }
 
+// SetStrategy sets how Next and Select choose resolvers.
+func (p *Pool) SetStrategy(s Strategy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strategy = s
+}
+
+// SetFamily sets the address family Next and Select prefer. Resolvers of
+// the other family are only picked when no preferred one is usable.
+func (p *Pool) SetFamily(family string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.family = family
+}
+
+// StrategyName returns the name of the selection strategy.
+func (p *Pool) StrategyName() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.strategy.Name()
+}
+
 // Add adds a new resolver to the pool.
 func (p *Pool) Add(address, resolverType string) {
+	p.AddFrom(address, resolverType, "")
+}
+
+// AddFrom adds a new resolver to the pool, recording its origin. IPv6
+// addresses are stored as [ip]:port.
+func (p *Pool) AddFrom(address, resolverType, origin string) {
+	address = NormalizeAddress(address, resolverType)
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -75,6 +214,8 @@ func (p *Pool) Add(address, resolverType string) {
 		Address: address,
 		Type:    resolverType,
 		Status:  StatusUnknown,
+		Origin:  origin,
+		AddedAt: time.Now(),
 	})
 }
 
@@ -97,30 +238,74 @@ func (p *Pool) Get() *Resolver {
 	return p.resolvers[p.current]
 }
 
-// Next moves to the next available resolver.
+// Find returns a copy of the resolver with the given address.
+func (p *Pool) Find(address string) (Resolver, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			return *r.clone(), true
+		}
+	}
+	return Resolver{}, false
+}
+
+// Next moves to the resolver chosen by the selection strategy, skipping
+// the current one and unusable (blocked or incompatible) ones. If every
+// other resolver is unusable the current one is returned.
 func (p *Pool) Next() *Resolver {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if len(p.resolvers) == 0 {
+	return p.selectFrom(1)
+}
+
+// Select moves to the resolver chosen by the selection strategy, keeping
+// the current one eligible. Use it for the initial connection.
+func (p *Pool) Select() *Resolver {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.selectFrom(0)
+}
+
+// selectFrom picks among usable resolvers, of the preferred family when
+// possible, starting offset positions after the current one. Caller holds mu.
+func (p *Pool) selectFrom(offset int) *Resolver {
+	n := len(p.resolvers)
+	if n == 0 {
 		return nil
 	}
 
-	// Find next healthy or unknown resolver
-	startIdx := p.current
-	for {
-		p.current = (p.current + 1) % len(p.resolvers)
-
-		// If we've gone full circle, return current (even if blocked)
-		if p.current == startIdx {
-			return p.resolvers[p.current]
+	var candidates []*Resolver
+	var indexes []int
+	for i := offset; i < n; i++ {
+		j := (p.current + i) % n
+		if r := p.resolvers[j]; r.usable() {
+			candidates = append(candidates, r)
+			indexes = append(indexes, j)
 		}
+	}
+	if len(candidates) == 0 {
+		return p.resolvers[p.current]
+	}
 
-		r := p.resolvers[p.current]
-		if r.Status != StatusBlocked {
-			return r
+	// Narrow to the preferred family if any of it is usable
+	var kept []*Resolver
+	var keptIndexes []int
+	for i, r := range candidates {
+		if preferred(r.Address, p.family) {
+			kept = append(kept, r)
+			keptIndexes = append(keptIndexes, indexes[i])
 		}
 	}
+	if len(kept) > 0 {
+		candidates, indexes = kept, keptIndexes
+	}
+
+	p.current = indexes[p.strategy.Pick(candidates, time.Now())]
+	return p.resolvers[p.current]
 }
 
 // MarkBlocked marks a resolver as blocked.
@@ -130,24 +315,103 @@ func (p *Pool) MarkBlocked(address string) {
 
 	for _, r := range p.resolvers {
 		if r.Address == address {
-			r.Status = StatusBlocked
-			r.BlockedAt = time.Now()
+			p.block(r, time.Now())
+			return
+		}
+	}
+}
+
+// MarkCorrupting marks a resolver as blocked because it corrupts tunnel
+// traffic (e.g. rewrites query names so the server cannot decode them).
+func (p *Pool) MarkCorrupting(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			p.block(r, time.Now())
+			r.Corrupting = true
+			return
+		}
+	}
+}
+
+// MarkIncompatible marks a resolver that answers DNS but fails the tunnel
+// probe. It stays out of selection until a scan finds it compatible.
+func (p *Pool) MarkIncompatible(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			if r.Status != StatusBlocked {
+				r.Status = StatusIncompatible
+			}
+			r.MaxResponse = 0
+			r.LastCheck = time.Now()
+			r.recordProbe(false, 0)
+			return
+		}
+	}
+}
+
+// SetSource records the list a resolver was found in, if not yet known.
+func (p *Pool) SetSource(address, source string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			if r.Source == "" {
+				r.Source = source
+			}
+			return
+		}
+	}
+}
+
+// SetServerName records the TLS name to verify a DoH or DoT resolver's
+// certificate against when its address is an IP.
+func (p *Pool) SetServerName(address, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			r.ServerName = name
 			return
 		}
 	}
 }
 
-// MarkHealthy marks a resolver as healthy.
+// SetMaxResponse records the largest response size the tunnel probe got
+// through the resolver.
+func (p *Pool) SetMaxResponse(address string, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			r.MaxResponse = size
+			return
+		}
+	}
+}
+
+// MarkHealthy marks a resolver as healthy. Blocked resolvers stay
+// blocked until they are released from quarantine.
 func (p *Pool) MarkHealthy(address string, latency time.Duration) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	for _, r := range p.resolvers {
 		if r.Address == address {
-			r.Status = StatusHealthy
+			if r.Status != StatusBlocked {
+				r.Status = StatusHealthy
+				r.FailCount = 0
+			}
 			r.LastCheck = time.Now()
-			r.FailCount = 0
-			r.Latency = latency
+			r.recordProbe(true, latency)
 			return
 		}
 	}
@@ -162,6 +426,7 @@ func (p *Pool) MarkFailed(address string) {
 		if r.Address == address {
 			r.FailCount++
 			r.LastCheck = time.Now()
+			r.recordProbe(false, 0)
 			if r.FailCount >= 3 {
 				r.Status = StatusDegraded
 			}
@@ -170,7 +435,7 @@ func (p *Pool) MarkFailed(address string) {
 	}
 }
 
-// GetHealthy returns all healthy resolvers.
+// GetHealthy returns copies of all healthy resolvers.
 func (p *Pool) GetHealthy() []*Resolver {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -178,7 +443,7 @@ func (p *Pool) GetHealthy() []*Resolver {
 	healthy := make([]*Resolver, 0)
 	for _, r := range p.resolvers {
 		if r.Status == StatusHealthy {
-			healthy = append(healthy, r)
+			healthy = append(healthy, r.clone())
 		}
 	}
 	return healthy
@@ -205,19 +470,25 @@ func (p *Pool) CountHealthy() int {
 	return count
 }
 
-// IsExhausted returns true if all resolvers are blocked.
+// IsExhausted returns true if no resolver is usable (all are blocked or
+// incompatible).
 func (p *Pool) IsExhausted() bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	for _, r := range p.resolvers {
-		if r.Status != StatusBlocked {
+		if r.usable() {
 			return false
 		}
 	}
 	return true
 }
 
+// usable reports whether the resolver may be selected.
+func (r *Resolver) usable() bool {
+	return r.Status != StatusBlocked && r.Status != StatusIncompatible
+}
+
 // Clear removes all resolvers from the pool.
 func (p *Pool) Clear() {
 	p.mu.Lock()
@@ -227,12 +498,22 @@ func (p *Pool) Clear() {
 	p.current = 0
 }
 
-// All returns a copy of all resolvers.
+// All returns copies of all resolvers.
 func (p *Pool) All() []*Resolver {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	result := make([]*Resolver, len(p.resolvers))
-	copy(result, p.resolvers)
+	for i, r := range p.resolvers {
+		result[i] = r.clone()
+	}
 	return result
 }
+
+// clone returns a copy of r that shares no memory with it, so callers can
+// read it without holding mu. Caller holds mu.
+func (r *Resolver) clone() *Resolver {
+	c := *r
+	c.BlockHistory = slices.Clone(r.BlockHistory)
+	return &c
+}
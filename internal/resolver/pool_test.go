@@ -0,0 +1,35 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCopiesShareNothing(t *testing.T) {
+	p := NewPool()
+	p.SetCooldown(time.Minute, time.Hour)
+	p.Add("1.1.1.1", "udp")
+	p.Add("8.8.8.8", "udp")
+	p.MarkHealthy("8.8.8.8", 10*time.Millisecond)
+	p.MarkBlocked("1.1.1.1")
+
+	all := p.All()
+	healthy := p.GetHealthy()
+	found, _ := p.Find("1.1.1.1")
+	if len(all) != 2 || len(healthy) != 1 {
+		t.Fatalf("All returned %d, GetHealthy %d; want 2, 1", len(all), len(healthy))
+	}
+
+	all[0].Status = StatusHealthy
+	all[0].BlockHistory[0] = time.Time{}
+	healthy[0].Latency = time.Hour
+	found.BlockHistory[0] = time.Time{}
+
+	r, _ := p.Find("1.1.1.1")
+	if r.Status != StatusBlocked || r.BlockHistory[0].IsZero() {
+		t.Errorf("changing a copy changed the pool: %+v", r)
+	}
+	if r, _ := p.Find("8.8.8.8"); r.Latency != 10*time.Millisecond {
+		t.Errorf("changing a healthy copy changed the pool latency to %v", r.Latency)
+	}
+}
@@ -0,0 +1,117 @@
+package resolver
+
+import "time"
+
+// maxBlockHistory bounds Resolver.BlockHistory.
+const maxBlockHistory = 16
+
+// SetCooldown configures the quarantine policy: a blocked resolver becomes
+// due for a re-probe after base, doubling for each repeated block up to
+// max. A zero base blocks resolvers permanently.
+func (p *Pool) SetCooldown(base, max time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cooldownBase = base
+	p.cooldownMax = max
+}
+
+// block marks r blocked and starts its cooldown. Caller holds mu.
+func (p *Pool) block(r *Resolver, now time.Time) {
+	// Already quarantined (or blocked permanently); repeated reports
+	// don't extend the cooldown
+	if r.Status == StatusBlocked && (r.CooldownUntil.IsZero() || now.Before(r.CooldownUntil)) {
+		return
+	}
+
+	// A resolver that stayed usable for a full max cooldown since its
+	// last release starts over at the base cooldown
+	if !r.ReleasedAt.IsZero() && now.Sub(r.ReleasedAt) > p.cooldownMax {
+		r.BlockStreak = 0
+	}
+	r.BlockStreak++
+
+	r.Status = StatusBlocked
+	r.BlockedAt = now
+	r.BlockCount++
+	r.recordProbe(false, 0)
+	r.BlockHistory = append(r.BlockHistory, now)
+	if n := len(r.BlockHistory); n > maxBlockHistory {
+		r.BlockHistory = r.BlockHistory[n-maxBlockHistory:]
+	}
+
+	if p.cooldownBase > 0 {
+		r.CooldownUntil = now.Add(p.cooldownFor(r.BlockStreak))
+	} else {
+		r.CooldownUntil = time.Time{}
+	}
+}
+
+// cooldownFor returns base * 2^(streak-1), capped at max. Caller holds mu.
+func (p *Pool) cooldownFor(streak int) time.Duration {
+	d := p.cooldownBase
+	for i := 1; i < streak; i++ {
+		d *= 2
+		if p.cooldownMax > 0 && d >= p.cooldownMax {
+			return p.cooldownMax
+		}
+	}
+	if p.cooldownMax > 0 && d > p.cooldownMax {
+		return p.cooldownMax
+	}
+	return d
+}
+
+// CooldownExpired returns copies of blocked resolvers whose cooldown has
+// passed and that are due for a re-probe.
+func (p *Pool) CooldownExpired() []Resolver {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	var due []Resolver
+	for _, r := range p.resolvers {
+		if r.Status == StatusBlocked && !r.CooldownUntil.IsZero() && !now.Before(r.CooldownUntil) {
+			due = append(due, *r.clone())
+		}
+	}
+	return due
+}
+
+// ExtendCooldown keeps a resolver that failed its re-probe in quarantine
+// for the next, longer cooldown. It is not counted as a new block.
+func (p *Pool) ExtendCooldown(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			r.recordProbe(false, 0)
+			if r.Status == StatusBlocked && p.cooldownBase > 0 {
+				r.BlockStreak++
+				r.CooldownUntil = time.Now().Add(p.cooldownFor(r.BlockStreak))
+			}
+			return
+		}
+	}
+}
+
+// Release takes a resolver out of quarantine and marks it unknown so it
+// is eligible for selection again.
+func (p *Pool) Release(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.resolvers {
+		if r.Address == address {
+			if r.Status == StatusBlocked {
+				r.Status = StatusUnknown
+				r.FailCount = 0
+				r.Corrupting = false
+				r.CooldownUntil = time.Time{}
+				r.ReleasedAt = time.Now()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooldownFor(t *testing.T) {
+	tests := []struct {
+		base, max time.Duration
+		streak    int
+		want      time.Duration
+	}{
+		{time.Minute, time.Hour, 1, time.Minute},
+		{time.Minute, time.Hour, 2, 2 * time.Minute},
+		{time.Minute, time.Hour, 6, 32 * time.Minute},
+		{time.Minute, time.Hour, 7, time.Hour},
+		{time.Minute, time.Hour, 1000, time.Hour},
+		{2 * time.Hour, time.Hour, 1, time.Hour},
+		{time.Minute, 0, 4, 8 * time.Minute},
+		{time.Minute, time.Hour, 0, time.Minute},
+	}
+	for _, tt := range tests {
+		p := NewPool()
+		p.SetCooldown(tt.base, tt.max)
+		if got := p.cooldownFor(tt.streak); got != tt.want {
+			t.Errorf("cooldownFor(%d) with base %v, max %v = %v, want %v", tt.streak, tt.base, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestBlock(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		r          Resolver
+		at         time.Time
+		wantStreak int
+		wantUntil  time.Time
+		wantCount  int
+	}{
+		{
+			name:       "first block",
+			r:          Resolver{Status: StatusHealthy},
+			at:         now,
+			wantStreak: 1,
+			wantUntil:  now.Add(time.Minute),
+			wantCount:  1,
+		},
+		{
+			name:       "blocked again soon after release",
+			r:          Resolver{Status: StatusUnknown, BlockStreak: 2, BlockCount: 2, ReleasedAt: now.Add(-time.Minute)},
+			at:         now,
+			wantStreak: 3,
+			wantUntil:  now.Add(4 * time.Minute),
+			wantCount:  3,
+		},
+		{
+			name:       "blocked again after a long good run",
+			r:          Resolver{Status: StatusHealthy, BlockStreak: 5, BlockCount: 5, ReleasedAt: now.Add(-2 * time.Hour)},
+			at:         now,
+			wantStreak: 1,
+			wantUntil:  now.Add(time.Minute),
+			wantCount:  6,
+		},
+		{
+			name:       "already quarantined",
+			r:          Resolver{Status: StatusBlocked, BlockStreak: 1, BlockCount: 1, CooldownUntil: now.Add(time.Minute)},
+			at:         now.Add(30 * time.Second),
+			wantStreak: 1,
+			wantUntil:  now.Add(time.Minute),
+			wantCount:  1,
+		},
+		{
+			name:       "reported after the cooldown passed",
+			r:          Resolver{Status: StatusBlocked, BlockStreak: 1, BlockCount: 1, CooldownUntil: now.Add(-time.Second)},
+			at:         now,
+			wantStreak: 2,
+			wantUntil:  now.Add(2 * time.Minute),
+			wantCount:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool()
+			p.SetCooldown(time.Minute, time.Hour)
+			r := tt.r
+			p.block(&r, tt.at)
+			if r.Status != StatusBlocked {
+				t.Errorf("status %v, want blocked", r.Status)
+			}
+			if r.BlockStreak != tt.wantStreak {
+				t.Errorf("streak %d, want %d", r.BlockStreak, tt.wantStreak)
+			}
+			if !r.CooldownUntil.Equal(tt.wantUntil) {
+				t.Errorf("cooldown until %v, want %v", r.CooldownUntil, tt.wantUntil)
+			}
+			if r.BlockCount != tt.wantCount {
+				t.Errorf("block count %d, want %d", r.BlockCount, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestBlockPermanent(t *testing.T) {
+	p := NewPool()
+	p.Add("1.1.1.1", "udp")
+	p.MarkBlocked("1.1.1.1")
+
+	r, _ := p.Find("1.1.1.1")
+	if r.Status != StatusBlocked || !r.CooldownUntil.IsZero() {
+		t.Errorf("status %v, cooldown until %v; want blocked with no cooldown", r.Status, r.CooldownUntil)
+	}
+	if due := p.CooldownExpired(); len(due) != 0 {
+		t.Errorf("%d permanently blocked resolvers due for re-probe", len(due))
+	}
+}
+
+func TestBlockHistoryBounded(t *testing.T) {
+	p := NewPool()
+	p.SetCooldown(time.Minute, time.Hour)
+	r := &Resolver{}
+	now := time.Now()
+	for i := range maxBlockHistory + 5 {
+		r.Status = StatusUnknown
+		p.block(r, now.Add(time.Duration(i)*time.Hour))
+	}
+	if len(r.BlockHistory) != maxBlockHistory {
+		t.Fatalf("history of %d blocks, want %d", len(r.BlockHistory), maxBlockHistory)
+	}
+	if want := now.Add((maxBlockHistory + 4) * time.Hour); !r.BlockHistory[maxBlockHistory-1].Equal(want) {
+		t.Errorf("newest block %v, want %v", r.BlockHistory[maxBlockHistory-1], want)
+	}
+}
+
+func TestQuarantineCycle(t *testing.T) {
+	p := NewPool()
+	p.SetCooldown(time.Minute, time.Hour)
+	p.Add("1.1.1.1", "udp")
+	p.MarkBlocked("1.1.1.1")
+
+	if due := p.CooldownExpired(); len(due) != 0 {
+		t.Fatalf("%d resolvers due right after blocking", len(due))
+	}
+
+	// A failed re-probe extends the cooldown without counting a new block
+	p.ExtendCooldown("1.1.1.1")
+	r, _ := p.Find("1.1.1.1")
+	if r.BlockStreak != 2 || r.BlockCount != 1 {
+		t.Errorf("after failed re-probe: streak %d, count %d; want 2, 1", r.BlockStreak, r.BlockCount)
+	}
+	if left := time.Until(r.CooldownUntil); left < time.Minute || left > 2*time.Minute {
+		t.Errorf("cooldown %v left, want about 2m", left)
+	}
+
+	p.Release("1.1.1.1")
+	r, _ = p.Find("1.1.1.1")
+	if r.Status != StatusUnknown || !r.CooldownUntil.IsZero() || r.ReleasedAt.IsZero() {
+		t.Errorf("after release: status %v, cooldown until %v, released at %v", r.Status, r.CooldownUntil, r.ReleasedAt)
+	}
+	if got := p.Select(); got == nil || got.Address != "1.1.1.1" {
+		t.Errorf("released resolver not selectable: %v", got)
+	}
+}
@@ -0,0 +1,230 @@
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/atomicfile"
+)
+
+// stateVersion is the current on-disk pool state format.
+const stateVersion = 1
+
+// storedResolver is the on-disk form of a Resolver.
+type storedResolver struct {
+	Address    string    `json:"address"`
+	Type       string    `json:"type"`
+	ServerName string    `json:"server_name,omitempty"`
+	Status     string    `json:"status"`
+	LastCheck  time.Time `json:"last_check,omitzero"`
+	FailCount  int       `json:"fail_count,omitempty"`
+	LatencyMs  float64   `json:"latency_ms,omitempty"`
+	BlockedAt  time.Time `json:"blocked_at,omitzero"`
+	Corrupting bool      `json:"corrupting,omitempty"`
+	Origin     string    `json:"origin,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	AddedAt    time.Time `json:"added_at,omitzero"`
+
+	BlockCount    int         `json:"block_count,omitempty"`
+	BlockHistory  []time.Time `json:"block_history,omitempty"`
+	BlockStreak   int         `json:"block_streak,omitempty"`
+	CooldownUntil time.Time   `json:"cooldown_until,omitzero"`
+	ReleasedAt    time.Time   `json:"released_at,omitzero"`
+
+	Successes   int     `json:"successes,omitempty"`
+	Failures    int     `json:"failures,omitempty"`
+	Reliability float64 `json:"reliability,omitempty"`
+	MaxResponse int     `json:"max_response,omitempty"`
+
+	QPS           float64   `json:"qps,omitempty"`
+	Loss          float64   `json:"loss,omitempty"`
+	Truncation    string    `json:"truncation,omitempty"`
+	TCP           bool      `json:"tcp,omitempty"`
+	BenchmarkedAt time.Time `json:"benchmarked_at,omitzero"`
+}
+
+// stateFile is the on-disk pool state.
+type stateFile struct {
+	Version   int              `json:"version"`
+	SavedAt   time.Time        `json:"saved_at"`
+	Resolvers []storedResolver `json:"resolvers"`
+}
+
+// Save writes the pool state to path atomically.
+func (p *Pool) Save(path string) error {
+	p.mu.RLock()
+	state := stateFile{
+		Version:   stateVersion,
+		SavedAt:   time.Now(),
+		Resolvers: make([]storedResolver, 0, len(p.resolvers)),
+	}
+	for _, r := range p.resolvers {
+		state.Resolvers = append(state.Resolvers, storedResolver{
+			Address:    r.Address,
+			Type:       r.Type,
+			ServerName: r.ServerName,
+			Status:     r.Status.String(),
+			LastCheck:  r.LastCheck,
+			FailCount:  r.FailCount,
+			LatencyMs:  float64(r.Latency) / float64(time.Millisecond),
+			BlockedAt:  r.BlockedAt,
+			Corrupting: r.Corrupting,
+			Origin:     r.Origin,
+			Source:     r.Source,
+			AddedAt:    r.AddedAt,
+
+			BlockCount:    r.BlockCount,
+			BlockHistory:  append([]time.Time(nil), r.BlockHistory...),
+			BlockStreak:   r.BlockStreak,
+			CooldownUntil: r.CooldownUntil,
+			ReleasedAt:    r.ReleasedAt,
+
+			Successes:   r.Successes,
+			Failures:    r.Failures,
+			Reliability: r.Reliability,
+			MaxResponse: r.MaxResponse,
+
+			QPS:           r.Capacity.QPS,
+			Loss:          r.Capacity.Loss,
+			Truncation:    r.Capacity.Truncation,
+			TCP:           r.Capacity.TCP,
+			BenchmarkedAt: r.Capacity.MeasuredAt,
+		})
+	}
+	p.mu.RUnlock()
+
+	if err := atomicfile.WriteJSON(path, state); err != nil {
+		return fmt.Errorf("writing pool state: %w", err)
+	}
+	return nil
+}
+
+// Load restores pool state saved by Save. Entries not seen (added,
+// checked or blocked) within maxAge are dropped; maxAge 0 keeps all.
+// Resolvers already in the pool are left untouched. Restored entries are
+// ordered healthy first, then by latency. It returns the number restored.
+func (p *Pool) Load(path string, maxAge time.Duration) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("reading pool state: %w", err)
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, fmt.Errorf("parsing pool state: %w", err)
+	}
+	if state.Version != stateVersion {
+		return 0, fmt.Errorf("unsupported pool state version %d", state.Version)
+	}
+
+	now := time.Now()
+	restored := make([]*Resolver, 0, len(state.Resolvers))
+	for _, sr := range state.Resolvers {
+		r := &Resolver{
+			Address:    NormalizeAddress(sr.Address, sr.Type),
+			Type:       sr.Type,
+			ServerName: sr.ServerName,
+			Status:     ParseStatus(sr.Status),
+			LastCheck:  sr.LastCheck,
+			FailCount:  sr.FailCount,
+			Latency:    time.Duration(sr.LatencyMs * float64(time.Millisecond)),
+			BlockedAt:  sr.BlockedAt,
+			Corrupting: sr.Corrupting,
+			Origin:     sr.Origin,
+			Source:     sr.Source,
+			AddedAt:    sr.AddedAt,
+
+			BlockCount:    sr.BlockCount,
+			BlockHistory:  sr.BlockHistory,
+			BlockStreak:   sr.BlockStreak,
+			CooldownUntil: sr.CooldownUntil,
+			ReleasedAt:    sr.ReleasedAt,
+
+			Successes:   sr.Successes,
+			Failures:    sr.Failures,
+			Reliability: sr.Reliability,
+			MaxResponse: sr.MaxResponse,
+
+			Capacity: Capacity{
+				QPS:        sr.QPS,
+				Loss:       sr.Loss,
+				Truncation: sr.Truncation,
+				TCP:        sr.TCP,
+				MeasuredAt: sr.BenchmarkedAt,
+			},
+		}
+		if r.Address == "" {
+			continue
+		}
+		if maxAge > 0 && now.Sub(r.lastSeen()) > maxAge {
+			continue
+		}
+		restored = append(restored, r)
+	}
+
+	sort.SliceStable(restored, func(i, j int) bool {
+		a, b := restored[i], restored[j]
+		if ra, rb := loadRank(a.Status), loadRank(b.Status); ra != rb {
+			return ra < rb
+		}
+		return a.Latency < b.Latency
+	})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]bool, len(p.resolvers))
+	for _, r := range p.resolvers {
+		existing[r.Address] = true
+	}
+	n := 0
+	for _, r := range restored {
+		if existing[r.Address] {
+			continue
+		}
+		existing[r.Address] = true
+		// Blocks saved without a cooldown get one under the current policy
+		if r.Status == StatusBlocked && r.CooldownUntil.IsZero() && p.cooldownBase > 0 {
+			if r.BlockStreak == 0 {
+				r.BlockStreak = 1
+			}
+			r.CooldownUntil = r.BlockedAt.Add(p.cooldownFor(r.BlockStreak))
+		}
+		p.resolvers = append(p.resolvers, r)
+		n++
+	}
+	return n, nil
+}
+
+// loadRank orders restored resolvers: healthy, unknown, degraded, then
+// blocked and incompatible.
+func loadRank(s Status) int {
+	switch s {
+	case StatusHealthy:
+		return 0
+	case StatusUnknown:
+		return 1
+	case StatusDegraded:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// lastSeen returns the most recent time the resolver was added, checked or blocked.
+func (r *Resolver) lastSeen() time.Time {
+	t := r.AddedAt
+	if r.LastCheck.After(t) {
+		t = r.LastCheck
+	}
+	if r.BlockedAt.After(t) {
+		t = r.BlockedAt
+	}
+	return t
+}
@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "pool.json")
+
+	p := NewPool()
+	p.SetCooldown(time.Minute, time.Hour)
+	p.AddFrom("1.1.1.1", "udp", OriginSeed)
+	p.AddFrom("2001:db8::1", "udp", OriginScan)
+	p.AddFrom("https://dns.example/dns-query", "doh", OriginTXT)
+	p.MarkHealthy("1.1.1.1", 40*time.Millisecond)
+	p.MarkHealthy("[2001:db8::1]:53", 20*time.Millisecond)
+	p.MarkBlocked("https://dns.example/dns-query")
+	p.SetSource("[2001:db8::1]:53", "list.txt")
+	p.SetCapacity("1.1.1.1", Capacity{QPS: 50, Truncation: "tc", MeasuredAt: time.Now()})
+
+	if err := p.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(path + ".tmp*"); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+	q := NewPool()
+	n, err := q.Load(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("restored %d resolvers, want 3", n)
+	}
+
+	// Healthy first by latency, blocked last
+	want := []string{"[2001:db8::1]:53", "1.1.1.1", "https://dns.example/dns-query"}
+	for i, r := range q.All() {
+		if r.Address != want[i] {
+			t.Errorf("resolver %d = %s, want %s", i, r.Address, want[i])
+		}
+	}
+
+	for _, addr := range want {
+		saved, _ := p.Find(addr)
+		got, ok := q.Find(addr)
+		if !ok {
+			t.Fatalf("%s not restored", addr)
+		}
+		if got.Type != saved.Type || got.Status != saved.Status || got.Origin != saved.Origin ||
+			got.Source != saved.Source || got.Latency != saved.Latency || got.BlockCount != saved.BlockCount ||
+			!got.CooldownUntil.Equal(saved.CooldownUntil) || got.Capacity.QPS != saved.Capacity.QPS ||
+			got.Capacity.Truncation != saved.Capacity.Truncation {
+			t.Errorf("%s restored as %+v, saved as %+v", addr, got, saved)
+		}
+	}
+}
+
+func TestLoadKeepsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.json")
+
+	p := NewPool()
+	p.Add("1.1.1.1", "udp")
+	p.Add("8.8.8.8", "udp")
+	p.MarkBlocked("1.1.1.1")
+	if err := p.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewPool()
+	q.Add("1.1.1.1", "udp")
+	n, err := q.Load(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("restored %d resolvers, want 1", n)
+	}
+	if r, _ := q.Find("1.1.1.1"); r.Status != StatusUnknown {
+		t.Errorf("existing resolver overwritten with status %v", r.Status)
+	}
+}
+
+func TestLoadMaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.json")
+	state := `{"version": 1, "resolvers": [
+		{"address": "1.1.1.1", "type": "udp", "status": "healthy", "added_at": "2020-01-01T00:00:00Z"},
+		{"address": "8.8.8.8", "type": "udp", "status": "healthy", "added_at": "2020-01-01T00:00:00Z",
+		 "last_check": "` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `"},
+		{"address": "", "type": "udp", "status": "healthy"}
+	]}`
+	if err := os.WriteFile(path, []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		maxAge time.Duration
+		want   int
+	}{
+		{0, 2},
+		{2 * time.Hour, 1},
+		{time.Minute, 0},
+	}
+	for _, tt := range tests {
+		n, err := NewPool().Load(path, tt.maxAge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("Load with max age %v restored %d, want %d", tt.maxAge, n, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if n, err := NewPool().Load(filepath.Join(dir, "missing.json"), 0); n != 0 || err != nil {
+		t.Errorf("missing file: %d, %v; want 0, nil", n, err)
+	}
+
+	for name, content := range map[string]string{
+		"version": `{"version": 2, "resolvers": []}`,
+		"syntax":  `{"version": 1,`,
+	} {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewPool().Load(path, 0); err == nil {
+			t.Errorf("%s: loaded a bad state file", name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package resolver
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Selection strategy names.
+const (
+	StrategyRoundRobin     = "round-robin"
+	StrategyLowestLatency  = "lowest-latency"
+	StrategyWeightedRandom = "weighted-random"
+	StrategyEWMA           = "ewma"
+)
+
+// Scoring parameters.
+const (
+	// ewmaAlpha weights the newest sample in latency and reliability averages
+	ewmaAlpha = 0.3
+
+	// latencyRef is the latency that scores 0.5
+	latencyRef = 250 * time.Millisecond
+
+	// blockRecovery is the time constant for forgetting a past block
+	blockRecovery = time.Hour
+)
+
+// Strategy picks the resolver to use from a list of candidates.
+type Strategy interface {
+	// Name returns the strategy name used in config and the API
+	Name() string
+
+	// Pick returns the index of the chosen candidate. Candidates are
+	// never blocked and are ordered starting after the current resolver.
+	Pick(candidates []*Resolver, now time.Time) int
+}
+
+// NewStrategy returns the strategy with the given name.
+func NewStrategy(name string) (Strategy, error) {
+	switch name {
+	case StrategyRoundRobin:
+		return roundRobin{}, nil
+	case StrategyLowestLatency:
+		return lowestLatency{}, nil
+	case StrategyWeightedRandom:
+		return weightedRandom{}, nil
+	case StrategyEWMA:
+		return ewmaStrategy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown selection strategy %q", name)
+	}
+}
+
+// roundRobin walks the pool in order.
+type roundRobin struct{}
+
+func (roundRobin) Name() string { return StrategyRoundRobin }
+
+func (roundRobin) Pick(candidates []*Resolver, now time.Time) int { return 0 }
+
+// lowestLatency picks the fastest resolver; untested ones come last.
+type lowestLatency struct{}
+
+func (lowestLatency) Name() string { return StrategyLowestLatency }
+
+func (lowestLatency) Pick(candidates []*Resolver, now time.Time) int {
+	best := 0
+	for i, r := range candidates {
+		b := candidates[best]
+		if r.Latency > 0 && (b.Latency <= 0 || r.Latency < b.Latency) {
+			best = i
+		}
+	}
+	return best
+}
+
+// weightedRandom picks randomly, weighted by Score.
+type weightedRandom struct{}
+
+func (weightedRandom) Name() string { return StrategyWeightedRandom }
+
+func (weightedRandom) Pick(candidates []*Resolver, now time.Time) int {
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, r := range candidates {
+		weights[i] = r.Score(now)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return 0
+	}
+	x := rand.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	return len(candidates) - 1
+}
+
+// ewmaStrategy picks the resolver with the best EWMA reliability score.
+type ewmaStrategy struct{}
+
+func (ewmaStrategy) Name() string { return StrategyEWMA }
+
+func (ewmaStrategy) Pick(candidates []*Resolver, now time.Time) int {
+	best, bestScore := 0, -1.0
+	for i, r := range candidates {
+		if s := r.EWMAScore(now); s > bestScore {
+			best, bestScore = i, s
+		}
+	}
+	return best
+}
+
+// Score rates a resolver from 0 to 1 by probe latency, lifetime success
+// ratio, time since it was last blocked and benchmarked capacity.
+func (r *Resolver) Score(now time.Time) float64 {
+	ratio := 0.5
+	if total := r.Successes + r.Failures; total > 0 {
+		ratio = float64(r.Successes) / float64(total)
+	}
+	return combineScore(r.latencyScore(), ratio, r.blockScore(now), r.capacityScore())
+}
+
+// EWMAScore is like Score but uses the exponentially weighted success
+// rate, so recent probes count more than old ones.
+func (r *Resolver) EWMAScore(now time.Time) float64 {
+	reliability := 0.5
+	if r.Successes+r.Failures > 0 {
+		reliability = r.Reliability
+	}
+	return combineScore(r.latencyScore(), reliability, r.blockScore(now), r.capacityScore())
+}
+
+// combineScore weights the score components.
+func combineScore(latency, success, block, capacity float64) float64 {
+	return 0.3*latency + 0.4*success + 0.15*block + 0.15*capacity
+}
+
+// latencyScore maps latency to (0, 1]; untested resolvers score 0.5.
+func (r *Resolver) latencyScore() float64 {
+	if r.Latency <= 0 {
+		return 0.5
+	}
+	return 1 / (1 + float64(r.Latency)/float64(latencyRef))
+}
+
+// blockScore rises from 0 right after a block towards 1.
+func (r *Resolver) blockScore(now time.Time) float64 {
+	if r.BlockedAt.IsZero() {
+		return 1
+	}
+	since := now.Sub(r.BlockedAt)
+	if since < 0 {
+		return 0
+	}
+	return 1 - math.Exp(-float64(since)/float64(blockRecovery))
+}
+
+// recordProbe updates success counters and averages. Caller holds the pool lock.
+func (r *Resolver) recordProbe(ok bool, latency time.Duration) {
+	sample := 0.0
+	if ok {
+		sample = 1
+	}
+	if r.Successes+r.Failures == 0 {
+		r.Reliability = sample
+	} else {
+		r.Reliability = ewmaAlpha*sample + (1-ewmaAlpha)*r.Reliability
+	}
+
+	if ok {
+		r.Successes++
+		if r.Latency <= 0 {
+			r.Latency = latency
+		} else {
+			r.Latency = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(r.Latency))
+		}
+	} else {
+		r.Failures++
+	}
+}
@@ -0,0 +1,189 @@
+package resolver
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range []string{StrategyRoundRobin, StrategyLowestLatency, StrategyWeightedRandom, StrategyEWMA} {
+		s, err := NewStrategy(name)
+		if err != nil {
+			t.Errorf("NewStrategy(%q): %v", name, err)
+			continue
+		}
+		if s.Name() != name {
+			t.Errorf("NewStrategy(%q).Name() = %q", name, s.Name())
+		}
+	}
+	if _, err := NewStrategy("fastest"); err == nil {
+		t.Error("NewStrategy accepted an unknown name")
+	}
+}
+
+func TestPick(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+	tests := []struct {
+		name       string
+		strategy   Strategy
+		candidates []*Resolver
+		want       int
+	}{
+		{
+			name:       "round-robin takes the next",
+			strategy:   roundRobin{},
+			candidates: []*Resolver{{Latency: 500 * ms}, {Latency: 10 * ms}},
+			want:       0,
+		},
+		{
+			name:       "lowest latency",
+			strategy:   lowestLatency{},
+			candidates: []*Resolver{{Latency: 80 * ms}, {Latency: 20 * ms}, {Latency: 40 * ms}},
+			want:       1,
+		},
+		{
+			name:       "lowest latency skips untested",
+			strategy:   lowestLatency{},
+			candidates: []*Resolver{{}, {Latency: 300 * ms}, {}},
+			want:       1,
+		},
+		{
+			name:       "lowest latency with none tested",
+			strategy:   lowestLatency{},
+			candidates: []*Resolver{{}, {}},
+			want:       0,
+		},
+		{
+			name:     "ewma prefers recent reliability",
+			strategy: ewmaStrategy{},
+			candidates: []*Resolver{
+				{Latency: 50 * ms, Successes: 90, Failures: 10, Reliability: 0.2},
+				{Latency: 50 * ms, Successes: 50, Failures: 50, Reliability: 0.9},
+			},
+			want: 1,
+		},
+		{
+			name:     "ewma avoids a fresh block",
+			strategy: ewmaStrategy{},
+			candidates: []*Resolver{
+				{Latency: 50 * ms, Successes: 10, Reliability: 1, BlockedAt: now.Add(-time.Minute)},
+				{Latency: 50 * ms, Successes: 10, Reliability: 1},
+			},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.strategy.Pick(tt.candidates, now)
+			if got != tt.want {
+				t.Errorf("picked %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRandomFollowsScore(t *testing.T) {
+	now := time.Now()
+	good := &Resolver{Latency: 20 * time.Millisecond, Successes: 20}
+	bad := &Resolver{Latency: 2 * time.Second, Failures: 20, BlockedAt: now}
+	candidates := []*Resolver{bad, good}
+
+	counts := make([]int, 2)
+	const n = 2000
+	for range n {
+		counts[weightedRandom{}.Pick(candidates, now)]++
+	}
+	wantGood := good.Score(now) / (good.Score(now) + bad.Score(now))
+	if got := float64(counts[1]) / n; math.Abs(got-wantGood) > 0.05 {
+		t.Errorf("good resolver picked %.2f of the time, want about %.2f", got, wantGood)
+	}
+}
+
+func TestScoreComponents(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		r    Resolver
+		want func(r *Resolver) float64
+		exp  float64
+	}{
+		{"untested latency", Resolver{}, (*Resolver).latencyScore, 0.5},
+		{"reference latency", Resolver{Latency: latencyRef}, (*Resolver).latencyScore, 0.5},
+		{"fast latency", Resolver{Latency: latencyRef / 4}, (*Resolver).latencyScore, 0.8},
+		{"never blocked", Resolver{}, func(r *Resolver) float64 { return r.blockScore(now) }, 1},
+		{"just blocked", Resolver{BlockedAt: now}, func(r *Resolver) float64 { return r.blockScore(now) }, 0},
+		{"blocked in the future", Resolver{BlockedAt: now.Add(time.Minute)}, func(r *Resolver) float64 { return r.blockScore(now) }, 0},
+		{"blocked an hour ago", Resolver{BlockedAt: now.Add(-blockRecovery)}, func(r *Resolver) float64 { return r.blockScore(now) }, 1 - math.Exp(-1)},
+		{"untested score", Resolver{}, func(r *Resolver) float64 { return r.Score(now) }, combineScore(0.5, 0.5, 1, 0.5)},
+		{"untested ewma score", Resolver{}, func(r *Resolver) float64 { return r.EWMAScore(now) }, combineScore(0.5, 0.5, 1, 0.5)},
+		{"success ratio", Resolver{Successes: 3, Failures: 1, Latency: latencyRef}, func(r *Resolver) float64 { return r.Score(now) }, combineScore(0.5, 0.75, 1, 0.5)},
+		{"ewma reliability", Resolver{Successes: 3, Failures: 1, Reliability: 0.25, Latency: latencyRef}, func(r *Resolver) float64 { return r.EWMAScore(now) }, combineScore(0.5, 0.25, 1, 0.5)},
+	}
+	for _, tt := range tests {
+		if got := tt.want(&tt.r); math.Abs(got-tt.exp) > 1e-9 {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.exp)
+		}
+	}
+}
+
+func TestRecordProbe(t *testing.T) {
+	r := &Resolver{}
+	r.recordProbe(true, 100*time.Millisecond)
+	if r.Reliability != 1 || r.Latency != 100*time.Millisecond || r.Successes != 1 {
+		t.Fatalf("after first success: %+v", r)
+	}
+	r.recordProbe(false, 0)
+	if want := 1 - ewmaAlpha; math.Abs(r.Reliability-want) > 1e-9 || r.Failures != 1 {
+		t.Errorf("after a failure: reliability %v, failures %d; want %v, 1", r.Reliability, r.Failures, want)
+	}
+	if r.Latency != 100*time.Millisecond {
+		t.Errorf("failure changed latency to %v", r.Latency)
+	}
+	r.recordProbe(true, 200*time.Millisecond)
+	if want := 130 * time.Millisecond; r.Latency != want {
+		t.Errorf("latency %v, want %v", r.Latency, want)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		family   string
+		want     []string
+	}{
+		{"round-robin", roundRobin{}, FamilyBoth, []string{"1.1.1.1", "[2001:db8::1]:53", "8.8.8.8", "1.1.1.1"}},
+		{"lowest latency", lowestLatency{}, FamilyBoth, []string{"[2001:db8::1]:53", "8.8.8.8", "[2001:db8::1]:53", "8.8.8.8"}},
+		// Next skips the current resolver, so it falls back to v4 when the
+		// only v6 one is in use
+		{"prefer v6", roundRobin{}, FamilyPreferV6, []string{"[2001:db8::1]:53", "8.8.8.8", "[2001:db8::1]:53"}},
+		{"prefer v4", roundRobin{}, FamilyPreferV4, []string{"1.1.1.1", "8.8.8.8", "1.1.1.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool()
+			p.SetStrategy(tt.strategy)
+			p.SetFamily(tt.family)
+			p.Add("1.1.1.1", "udp")
+			p.Add("2001:db8::1", "udp")
+			p.Add("8.8.8.8", "udp")
+			p.Add("9.9.9.9", "udp")
+			p.MarkHealthy("1.1.1.1", 90*time.Millisecond)
+			p.MarkHealthy("[2001:db8::1]:53", 10*time.Millisecond)
+			p.MarkHealthy("8.8.8.8", 50*time.Millisecond)
+			p.MarkBlocked("9.9.9.9")
+
+			got := []string{p.Select().Address}
+			for len(got) < len(tt.want) {
+				got = append(got, p.Next().Address)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("picked %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -2,13 +2,11 @@
 package scanner
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 )
@@ -45,11 +43,15 @@ func (s *Scanner) StartBackground(ctx context.Context, interval time.Duration) {
 	}
 }
 
-// fetchCountryIPRanges fetches IP ranges for a country from ipdeny.com.
-// The endpoint returns CIDR blocks, one per line.
-func (s *Scanner) fetchCountryIPRanges(ctx context.Context, countryCode string) ([]string, error) {
+// fetchCountryIPRanges fetches a country's IPv4 or IPv6 ranges from
+// ipdeny.com. The endpoint returns CIDR blocks, one per line.
+func (s *Scanner) fetchCountryIPRanges(ctx context.Context, countryCode string, ipv6 bool) ([]netip.Prefix, error) {
 	url := fmt.Sprintf("https://www.ipdeny.com/ipblocks/data/countries/%s.zone",
 		strings.ToLower(countryCode))
+	if ipv6 {
+		url = fmt.Sprintf("https://www.ipdeny.com/ipv6/ipaddresses/blocks/%s.zone",
+			strings.ToLower(countryCode))
+	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -68,81 +70,5 @@ func (s *Scanner) fetchCountryIPRanges(ctx context.Context, countryCode string)
 		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 
-	return s.parseCIDRList(resp.Body)
-}
-
-// parseCIDRList parses a list of CIDR ranges and extracts the first IP from each.
-// Returns addresses in format "ip:53" ready for DNS scanning.
-func (s *Scanner) parseCIDRList(r io.Reader) ([]string, error) {
-	var candidates []string
-	scanner := bufio.NewScanner(r)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		ip := s.extractFirstIP(line)
-		if ip != "" {
-			candidates = append(candidates, ip+":53")
-		}
-
-		// Early exit if we have enough candidates (default 100 if not set)
-		maxCandidates := s.config.MaxCandidates
-		if maxCandidates <= 0 {
-			maxCandidates = 100
-		}
-		if len(candidates) >= maxCandidates {
-			break
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading CIDR list: %w", err)
-	}
-
-	return candidates, nil
-}
-
-// extractFirstIP extracts the first usable IP from a CIDR range.
-// For example, "2.144.0.0/14" returns "2.144.0.1" (first host address).
-func (s *Scanner) extractFirstIP(cidr string) string {
-	_, ipNet, err := net.ParseCIDR(cidr)
-	if err != nil {
-		// Try parsing as plain IP
-		if ip := net.ParseIP(cidr); ip != nil {
-			return ip.String()
-		}
-		return ""
-	}
-
-	// Get the network address and convert to IPv4
-	ip := ipNet.IP.To4()
-	if ip == nil {
-		return "" // Skip IPv6 for now
-	}
-
-	// Increment to get first host (network address + 1)
-	// Handle overflow properly
-	ip = incrementIP(ip)
-	if ip == nil {
-		return ""
-	}
-
-	return ip.String()
-}
-
-// incrementIP adds 1 to an IP address.
-func incrementIP(ip net.IP) net.IP {
-	result := make(net.IP, len(ip))
-	copy(result, ip)
-
-	for i := len(result) - 1; i >= 0; i-- {
-		result[i]++
-		if result[i] != 0 {
-			return result
-		}
-	}
-	return nil // Overflow
+	return parseCIDRBlocks(resp.Body)
 }
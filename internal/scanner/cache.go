@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/atomicfile"
+)
+
+// Responsive cache limits.
+const (
+	// responsiveMaxAge drops addresses not heard from within this age
+	responsiveMaxAge = 30 * 24 * time.Hour
+
+	// responsiveMaxMisses drops addresses after this many silent scans in a row
+	responsiveMaxMisses = 3
+
+	// responsiveMaxEntries caps the cache, keeping the most recently seen
+	responsiveMaxEntries = 5000
+)
+
+// responsiveEntry is an address that answered DNS in an earlier scan.
+type responsiveEntry struct {
+	Address  string    `json:"address"`
+	Type     string    `json:"type"`
+	Source   string    `json:"source,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+	Misses   int       `json:"misses,omitempty"`
+}
+
+// loadCache reads the responsive cache on first use. Caller holds cacheMu.
+func (s *Scanner) loadCache() {
+	if s.cache != nil {
+		return
+	}
+	s.cache = make(map[string]*responsiveEntry)
+	if s.config.ResponsiveCache == "" {
+		return
+	}
+
+	data, err := os.ReadFile(s.config.ResponsiveCache)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read responsive cache: %v", err)
+		}
+		return
+	}
+	var entries []responsiveEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("Failed to parse responsive cache: %v", err)
+		return
+	}
+	for i := range entries {
+		e := &entries[i]
+		if e.Address != "" && time.Since(e.LastSeen) <= responsiveMaxAge {
+			s.cache[e.Address] = e
+		}
+	}
+}
+
+// cachedCandidates returns addresses that answered in earlier scans, most
+// recently seen first.
+func (s *Scanner) cachedCandidates() []Candidate {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.loadCache()
+
+	entries := s.sortedCache()
+	candidates := make([]Candidate, 0, len(entries))
+	for _, e := range entries {
+		candidates = append(candidates, Candidate{Address: e.Address, Type: e.Type, Source: e.Source})
+	}
+	return candidates
+}
+
+// noteResponsive records whether a scanned address answered. An address
+// counts as responsive if it sent back any DNS response.
+func (s *Scanner) noteResponsive(r ScanResult) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.loadCache()
+
+	responsive := r.Working || r.Verdict != "" || r.Incompatible
+	e, ok := s.cache[r.Address]
+	switch {
+	case responsive && ok:
+		e.LastSeen = time.Now()
+		e.Misses = 0
+	case responsive:
+		s.cache[r.Address] = &responsiveEntry{
+			Address:  r.Address,
+			Type:     r.Type,
+			Source:   r.Source,
+			LastSeen: time.Now(),
+		}
+	case ok:
+		if e.Misses++; e.Misses >= responsiveMaxMisses {
+			delete(s.cache, r.Address)
+		}
+	}
+}
+
+// saveCache trims the cache to responsiveMaxEntries and writes it out.
+func (s *Scanner) saveCache() {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.loadCache()
+
+	entries := s.sortedCache()
+	if len(entries) > responsiveMaxEntries {
+		for _, e := range entries[responsiveMaxEntries:] {
+			delete(s.cache, e.Address)
+		}
+		entries = entries[:responsiveMaxEntries]
+	}
+
+	if s.config.ResponsiveCache == "" {
+		return
+	}
+	out := make([]responsiveEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, *e)
+	}
+	if err := atomicfile.WriteJSON(s.config.ResponsiveCache, out); err != nil {
+		log.Printf("Failed to save responsive cache: %v", err)
+	}
+}
+
+// sortedCache returns cache entries, most recently seen first. Caller holds cacheMu.
+func (s *Scanner) sortedCache() []*responsiveEntry {
+	entries := make([]*responsiveEntry, 0, len(s.cache))
+	for _, e := range s.cache {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].LastSeen.Equal(entries[j].LastSeen) {
+			return entries[i].LastSeen.After(entries[j].LastSeen)
+		}
+		return entries[i].Address < entries[j].Address
+	})
+	return entries
+}
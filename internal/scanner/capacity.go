@@ -0,0 +1,257 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnsmsg"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// Capacity benchmark parameters.
+var (
+	// benchmarkRates are the query rates tried, lowest first
+	benchmarkRates = []int{10, 25, 50, 100, 200}
+
+	// benchmarkSizes are the EDNS0 buffer sizes tried, each asking for a
+	// response that fills it
+	benchmarkSizes = []int{512, 1232, 2048, 4096}
+)
+
+const (
+	// benchmarkBurst is how long each rate is held
+	benchmarkBurst = time.Second
+
+	// benchmarkMaxLoss is the highest loss rate a rate counts as sustained at
+	benchmarkMaxLoss = 0.1
+
+	// benchmarkQuerySize is the response size asked for during bursts
+	benchmarkQuerySize = 512
+)
+
+// Benchmark measures a UDP resolver's tunnel capacity through the echo
+// responder: the largest response it delivers intact as the EDNS0 buffer
+// grows from 512 to 4096 and what happens beyond that, the highest query
+// rate it forwards with at most 10% loss, and whether it answers over
+// TCP. It returns the capacity and the largest intact response size.
+// Queries bypass rate_limit: the point is to load the resolver.
+func (s *Scanner) Benchmark(ctx context.Context, address string) (resolver.Capacity, int, error) {
+	if s.domain == "" {
+		return resolver.Capacity{}, 0, fmt.Errorf("benchmark needs the echo responder (scanner.tunnel_probe)")
+	}
+
+	c := resolver.Capacity{}
+	maxResponse := 0
+	for i, size := range benchmarkSizes {
+		n, err := s.echoSize(ctx, address, size)
+		if err != nil && i == 0 && ctx.Err() == nil {
+			n, err = s.echoSize(ctx, address, size)
+		}
+		if ctx.Err() != nil {
+			return c, 0, ctx.Err()
+		}
+		if err != nil {
+			if i == 0 {
+				return c, 0, fmt.Errorf("echo probe failed: %w", err)
+			}
+			c.Truncation = resolver.TruncationDrop
+			if errors.Is(err, errTruncated) {
+				c.Truncation = resolver.TruncationTC
+			}
+			break
+		}
+		maxResponse = n
+	}
+
+	for i, rate := range benchmarkRates {
+		delivered, err := s.burst(ctx, address, rate)
+		if err != nil {
+			return c, maxResponse, err
+		}
+		loss := 1 - delivered
+		if loss > benchmarkMaxLoss {
+			if i == 0 {
+				c.Loss = loss
+			}
+			break
+		}
+		c.QPS, c.Loss = float64(rate), loss
+	}
+
+	c.TCP = s.answersTCP(ctx, address)
+	c.MeasuredAt = time.Now()
+	return c, maxResponse, nil
+}
+
+// echoSize asks for a response filling an ednsSize buffer and returns
+// the size of the verified response.
+func (s *Scanner) echoSize(ctx context.Context, address string, ednsSize int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	id := uint16(rand.Uint32())
+	name, query, err := s.echoQuery(id, ednsSize, ednsSize)
+	if err != nil {
+		return 0, err
+	}
+	response, err := s.exchangeUDP(ctx, address, query)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyEcho(response, id, name); err != nil {
+		return 0, err
+	}
+	return len(response), nil
+}
+
+// burst sends echo probes at rate per second for benchmarkBurst over one
+// socket and returns the fraction answered correctly.
+func (s *Scanner) burst(ctx context.Context, address string, rate int) (float64, error) {
+	dialer := net.Dialer{Timeout: s.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "udp", resolver.HostPort(address, "53"))
+	if err != nil {
+		return 0, fmt.Errorf("dial failed: %w", err)
+	}
+	defer conn.Close()
+
+	var mu sync.Mutex
+	pending := make(map[uint16]string)
+	answered := 0
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, maxResponse)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			m, err := dnsmsg.Parse(buf[:n])
+			if err != nil {
+				continue
+			}
+			mu.Lock()
+			name, ok := pending[m.ID]
+			if ok && verifyEcho(buf[:n], m.ID, name) == nil {
+				delete(pending, m.ID)
+				answered++
+			}
+			mu.Unlock()
+		}
+	}()
+
+	total := max(int(float64(rate)*benchmarkBurst.Seconds()), 1)
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	id := uint16(rand.Uint32())
+	sent := 0
+	for sent < total {
+		name, query, err := s.echoQuery(id, benchmarkQuerySize, 1232)
+		if err != nil {
+			return 0, err
+		}
+		mu.Lock()
+		pending[id] = name
+		mu.Unlock()
+		if _, err := conn.Write(query); err != nil {
+			return 0, fmt.Errorf("write failed: %w", err)
+		}
+		sent++
+		id++
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	// Give the last queries the usual timeout to come back
+	conn.SetReadDeadline(time.Now().Add(s.config.Timeout))
+	<-readDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	return float64(answered) / float64(sent), nil
+}
+
+// answersTCP reports whether the resolver answers controlDomain over TCP.
+func (s *Scanner) answersTCP(ctx context.Context, address string) bool {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	id := uint16(rand.Uint32())
+	query, err := dnsmsg.NewQuery(id, controlDomain, dnsmsg.TypeA, 0)
+	if err != nil {
+		return false
+	}
+	response, err := s.exchangeTCP(ctx, address, query)
+	if err != nil {
+		return false
+	}
+	m, err := dnsmsg.Parse(response)
+	return err == nil && m.Response() && m.ID == id
+}
+
+// BenchmarkPool benchmarks usable UDP resolvers not measured within
+// maxAge, one at a time so bursts don't compete, and records the results.
+// It returns the number benchmarked.
+func (s *Scanner) BenchmarkPool(ctx context.Context, maxAge time.Duration) int {
+	measured := 0
+	for _, r := range s.pool.BenchmarkDue("udp", maxAge) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		c, maxResponse, err := s.Benchmark(ctx, r.Address)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			// Record the attempt so the resolver ranks low until next time
+			log.Printf("Benchmark of %s failed: %v", r.Address, err)
+			s.pool.SetCapacity(r.Address, resolver.Capacity{Loss: 1, MeasuredAt: time.Now()})
+			continue
+		}
+		s.pool.SetCapacity(r.Address, c)
+		if maxResponse > 0 {
+			s.pool.SetMaxResponse(r.Address, maxResponse)
+		}
+		log.Printf("Benchmarked %s: %.0f qps (%.0f%% loss), max response %d bytes, truncation %s, tcp %v",
+			r.Address, c.QPS, c.Loss*100, maxResponse, truncationLabel(c.Truncation), c.TCP)
+		measured++
+	}
+	return measured
+}
+
+// truncationLabel describes a Truncation value for logs.
+func truncationLabel(t string) string {
+	if t == "" {
+		return "none up to 4096 bytes"
+	}
+	return t
+}
+
+// StartBenchmark benchmarks pool resolvers at the given interval until ctx
+// is cancelled, re-measuring each once per interval.
+func (s *Scanner) StartBenchmark(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.BenchmarkPool(ctx, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnsmsg"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/echo"
+)
+
+// probeSizes are the response sizes the tunnel probe asks for, smallest
+// first. A resolver that can't deliver the first is incompatible.
+var probeSizes = []int{512, 768, 1024, 1232}
+
+// probeEDNSSize is the UDP payload size advertised in probe queries.
+const probeEDNSSize = 4096
+
+// SetTunnelDomain enables the tunnel-compatibility probe: resolvers must
+// also carry long random TXT queries to the echo responder under domain.
+// key is the tunnel public key, which lets benchmark probes ask for
+// responses above echo.OpenSize.
+func (s *Scanner) SetTunnelDomain(domain, key string) {
+	s.domain = domain
+	s.echoKey = key
+}
+
+// testTunnel checks that tunnel-like queries reach the echo responder
+// intact and returns the largest response size delivered intact.
+func (s *Scanner) testTunnel(ctx context.Context, address, resolverType string) (int, error) {
+	best := 0
+	for i, size := range probeSizes {
+		n, err := s.probeEcho(ctx, address, resolverType, size, probeEDNSSize)
+		if err != nil && i == 0 && ctx.Err() == nil {
+			// One retry so a single lost packet doesn't condemn the resolver
+			n, err = s.probeEcho(ctx, address, resolverType, size, probeEDNSSize)
+		}
+		if err != nil {
+			if i == 0 {
+				return 0, err
+			}
+			break
+		}
+		best = n
+	}
+	return best, nil
+}
+
+// errTruncated marks echo responses that came back with the TC bit set.
+var errTruncated = errors.New("response truncated")
+
+// probeEcho sends one probe asking for a response of size bytes and
+// returns the size of the verified response.
+func (s *Scanner) probeEcho(ctx context.Context, address, resolverType string, size, ednsSize int) (int, error) {
+	if err := s.pacer.wait(ctx, address); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	id := uint16(rand.Uint32())
+	name, query, err := s.echoQuery(id, size, ednsSize)
+	if err != nil {
+		return 0, err
+	}
+	response, err := s.exchange(ctx, address, resolverType, query)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyEcho(response, id, name); err != nil {
+		if errors.Is(err, errTruncated) {
+			return 0, fmt.Errorf("%d-byte %w", size, err)
+		}
+		return 0, err
+	}
+	return len(response), nil
+}
+
+// echoQuery builds a TXT query for a fresh probe name asking the echo
+// responder for a size-byte response, advertising ednsSize.
+func (s *Scanner) echoQuery(id uint16, size, ednsSize int) (string, []byte, error) {
+	name, err := echo.ProbeName(s.domain, size, s.echoKey)
+	if err != nil {
+		return "", nil, err
+	}
+	query, err := dnsmsg.NewQuery(id, name, dnsmsg.TypeTXT, ednsSize)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, query, nil
+}
+
+// verifyEcho checks that response answers probe name with the payload the
+// echo responder derives from it.
+func verifyEcho(response []byte, id uint16, name string) error {
+	m, err := dnsmsg.Parse(response)
+	if err != nil {
+		return fmt.Errorf("malformed response: %w", err)
+	}
+
+	switch {
+	case m.ID != id:
+		return fmt.Errorf("response ID mismatch")
+	case !m.Response():
+		return fmt.Errorf("not a DNS response")
+	case m.Truncated():
+		return errTruncated
+	case m.Rcode() != dnsmsg.RcodeSuccess:
+		return fmt.Errorf("probe answered with rcode %d", m.Rcode())
+	case len(m.Questions) != 1 || !strings.EqualFold(m.Questions[0].Name, name):
+		return fmt.Errorf("question rewritten")
+	}
+
+	var payload []byte
+	found := false
+	for _, rr := range m.Answers {
+		if rr.Type != dnsmsg.TypeTXT || !strings.EqualFold(rr.Name, name) {
+			continue
+		}
+		strs, err := dnsmsg.TXT(rr.Data)
+		if err != nil {
+			return fmt.Errorf("malformed TXT answer: %w", err)
+		}
+		for _, str := range strs {
+			payload = append(payload, str...)
+		}
+		found = true
+		break
+	}
+	if !found {
+		return fmt.Errorf("no TXT answer from the echo responder")
+	}
+	if len(payload) < 64 || string(payload) != string(echo.Payload(name, len(payload))) {
+		return fmt.Errorf("echo mismatch: query or response mangled")
+	}
+	return nil
+}
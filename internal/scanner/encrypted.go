@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/fingerprint"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// SourceCurated marks candidates from curatedEncrypted.
+const SourceCurated = "curated"
+
+// curatedEncrypted are well-known public DoH and DoT resolvers.
+var curatedEncrypted = []string{
+	"https://cloudflare-dns.com/dns-query",
+	"https://1.1.1.1/dns-query",
+	"https://dns.google/dns-query",
+	"https://8.8.8.8/dns-query",
+	"https://dns.quad9.net/dns-query",
+	"https://doh.opendns.com/dns-query",
+	"https://dns.adguard-dns.com/dns-query",
+	"https://doh.mullvad.net/dns-query",
+	"https://dns.alidns.com/dns-query",
+	"https://doh.pub/dns-query",
+	"tls://1.1.1.1:853",
+	"tls://dns.google:853",
+	"tls://dns.quad9.net:853",
+	"tls://dns.adguard-dns.com:853",
+	"tls://dns.alidns.com:853",
+	"tls://dot.pub:853",
+}
+
+// encryptedCandidates returns the DoH and DoT endpoints to try on the
+// host of a plain UDP candidate, or nil if its host isn't an IP.
+func encryptedCandidates(c Candidate) []Candidate {
+	ip, err := netip.ParseAddr(resolver.Host(c.Address))
+	if err != nil {
+		return nil
+	}
+	host := ip.String()
+	if ip.Is6() {
+		host = "[" + host + "]"
+	}
+	return []Candidate{
+		{Address: "https://" + host + "/dns-query", Type: "doh", Source: c.Source},
+		{Address: "tls://" + net.JoinHostPort(ip.String(), "853"), Type: "dot", Source: c.Source},
+	}
+}
+
+// SetFingerprints sets the uTLS fingerprint distribution TLS probes
+// follow, in dnstt-client's "4*random,3*Firefox_120" format. An invalid
+// distribution leaves probes on Go's own ClientHello.
+func (s *Scanner) SetFingerprints(distribution string) {
+	fingerprints, err := fingerprint.Parse(distribution)
+	if err != nil {
+		log.Printf("Ignoring uTLS fingerprints: %v", err)
+	}
+	s.fingerprints = fingerprints
+}
+
+// serverName returns the TLS name recorded for an encrypted resolver
+// whose address is an IP, or "" to use the address's host.
+func (s *Scanner) serverName(address string) string {
+	if name, ok := s.serverNames.Load(address); ok {
+		return name.(string)
+	}
+	if r, ok := s.pool.Find(address); ok {
+		return r.ServerName
+	}
+	return ""
+}
+
+// tlsEndpoint checks an encrypted candidate whose host is an IP: the IP
+// must complete a TLS handshake on the endpoint's port, and unless its
+// certificate covers the IP, a server name is guessed from the certificate.
+// The IP stays the endpoint; the name is returned, and remembered for the
+// probes that follow, to be sent as SNI and verified against. Other
+// addresses need no name.
+func (s *Scanner) tlsEndpoint(ctx context.Context, address, resolverType string) (string, error) {
+	host := resolver.Host(address)
+	if _, err := netip.ParseAddr(host); err != nil {
+		return "", nil
+	}
+
+	port := "853"
+	if resolverType == "doh" {
+		u, err := url.Parse(address)
+		if err != nil {
+			return "", fmt.Errorf("parsing DoH URL: %w", err)
+		}
+		port = u.Port()
+		if port == "" {
+			port = "443"
+		}
+	} else if _, p, err := net.SplitHostPort(resolver.HostPort(address, "853")); err == nil {
+		port = p
+	}
+
+	if err := s.pacer.wait(ctx, address); err != nil {
+		return "", err
+	}
+	// The certificate is inspected below
+	cfg := &utls.Config{ServerName: host, InsecureSkipVerify: true}
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	conn, err := fingerprint.Dial(ctx, dialer, "tcp", net.JoinHostPort(host, port), cfg, s.fingerprints.Pick())
+	if err != nil {
+		return "", fmt.Errorf("no TLS on port %s: %w", port, err)
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	conn.Close()
+	if len(certs) == 0 {
+		return "", fmt.Errorf("no certificate on port %s", port)
+	}
+	if certs[0].VerifyHostname(host) == nil {
+		s.serverNames.Delete(address)
+		return "", nil
+	}
+
+	name := guessServerName(certs[0])
+	if name == "" {
+		return "", fmt.Errorf("certificate on port %s names no usable host", port)
+	}
+	s.serverNames.Store(address, name)
+	return name, nil
+}
+
+// guessServerName picks the certificate name most likely to be the
+// resolver's: DNS-looking names first, wildcards as dns.<domain>.
+func guessServerName(cert *x509.Certificate) string {
+	names := cert.DNSNames
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = []string{cert.Subject.CommonName}
+	}
+
+	var plain, wildcard string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if rest, ok := strings.CutPrefix(name, "*."); ok {
+			if wildcard == "" && strings.Contains(rest, ".") {
+				wildcard = "dns." + rest
+			}
+			continue
+		}
+		if strings.Contains(name, "dns") || strings.Contains(name, "doh") || strings.Contains(name, "dot") {
+			return name
+		}
+		if plain == "" {
+			plain = name
+		}
+	}
+	if plain != "" {
+		return plain
+	}
+	return wildcard
+}
@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// pacerMaxSubnets is how many subnet slots are kept before expired ones
+// are pruned.
+const pacerMaxSubnets = 4096
+
+// pacer spaces out scan queries: globally to a packets-per-second limit,
+// and per /24 (/48 for IPv6) to a minimum interval.
+type pacer struct {
+	mu             sync.Mutex
+	interval       time.Duration // between any two queries; 0 is unlimited
+	subnetInterval time.Duration // between queries to one subnet
+	next           time.Time     // next free global slot
+	subnets        map[string]time.Time
+}
+
+// newPacer creates a pacer for rate queries per second.
+func newPacer(rate int, subnetInterval time.Duration) *pacer {
+	p := &pacer{
+		subnetInterval: subnetInterval,
+		subnets:        make(map[string]time.Time),
+	}
+	if rate > 0 {
+		p.interval = time.Second / time.Duration(rate)
+	}
+	return p
+}
+
+// wait blocks until a query to address may be sent.
+func (p *pacer) wait(ctx context.Context, address string) error {
+	if p.interval <= 0 && p.subnetInterval <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	at := now
+	if p.interval > 0 {
+		at = later(now, p.next)
+		p.next = at.Add(p.interval)
+	}
+	if p.subnetInterval > 0 {
+		key := subnetKey(address)
+		at = later(at, p.subnets[key])
+		p.subnets[key] = at.Add(p.subnetInterval)
+		if len(p.subnets) > pacerMaxSubnets {
+			for k, t := range p.subnets {
+				if t.Before(now) {
+					delete(p.subnets, k)
+				}
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// later returns the later of two times.
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// subnetKey groups resolver addresses (ip:port, DoH URL, tls://) by /24
+// or /48; hostnames are their own group.
+func subnetKey(address string) string {
+	host := address
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		host = u.Hostname()
+	} else if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return answerPrefix(ip).String()
+	}
+	return host
+}
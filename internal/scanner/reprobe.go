@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ReprobeBlocked re-tests blocked resolvers whose quarantine cooldown has
+// expired. Working resolvers are released back into the pool; the rest
+// stay quarantined for a longer cooldown. It returns the number released.
+func (s *Scanner) ReprobeBlocked(ctx context.Context) int {
+	released := 0
+	for _, r := range s.pool.CooldownExpired() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := s.testResolver(ctx, r.Address, r.Type)
+		if result.Working {
+			s.pool.Release(r.Address)
+			s.pool.MarkHealthy(r.Address, result.Latency)
+			if result.MaxResponse > 0 {
+				s.pool.SetMaxResponse(r.Address, result.MaxResponse)
+			}
+			log.Printf("Released %s from quarantine (latency: %v, blocked %d times)",
+				r.Address, result.Latency, r.BlockCount)
+			released++
+		} else {
+			s.pool.ExtendCooldown(r.Address)
+			log.Printf("%s still failing after cooldown: %v", r.Address, result.Error)
+		}
+	}
+	return released
+}
+
+// StartReprobe re-tests quarantined resolvers at the given interval until
+// ctx is cancelled.
+func (s *Scanner) StartReprobe(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.ReprobeBlocked(ctx)
+		}
+	}
+}
@@ -4,150 +4,163 @@ package scanner
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"time"
+
+	utls "github.com/refraction-networking/utls"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/fingerprint"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
 )
 
-// dnsQuery is a minimal DNS query for "example.com" A record.
-var dnsQuery = []byte{
-	0x00, 0x01, // Transaction ID
-	0x01, 0x00, // Standard query
-	0x00, 0x01, // Questions: 1
-	0x00, 0x00, // Answer RRs: 0
-	0x00, 0x00, // Authority RRs: 0
-	0x00, 0x00, // Additional RRs: 0
-	// Query: example.com
-	0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
-	0x03, 'c', 'o', 'm',
-	0x00,       // null terminator
-	0x00, 0x01, // Type A
-	0x00, 0x01, // Class IN
+// maxResponse caps the size of a DNS response read from a resolver.
+const maxResponse = 65535
+
+// exchange sends a raw DNS query over the resolver's transport and returns
+// the raw response.
+func (s *Scanner) exchange(ctx context.Context, address, resolverType string, query []byte) ([]byte, error) {
+	switch resolverType {
+	case "udp":
+		return s.exchangeUDP(ctx, address, query)
+	case "doh":
+		return s.exchangeDoH(ctx, address, query)
+	case "dot":
+		return s.exchangeDoT(ctx, address, query)
+	default:
+		return nil, fmt.Errorf("unknown resolver type: %s", resolverType)
+	}
+}
+
+// Exchange sends a raw DNS query to a resolver over its transport, outside
+// the scan pacing, and returns the raw response.
+func (s *Scanner) Exchange(ctx context.Context, address, resolverType string, query []byte) ([]byte, error) {
+	return s.exchange(ctx, address, resolverType, query)
+}
+
+// readDeadline returns the ctx deadline, or the scan timeout from now.
+func (s *Scanner) readDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(s.config.Timeout)
 }
 
-// testUDPResolver tests a UDP DNS resolver.
-func (s *Scanner) testUDPResolver(ctx context.Context, address string) error {
+// exchangeUDP sends a query to a UDP resolver.
+func (s *Scanner) exchangeUDP(ctx context.Context, address string, query []byte) ([]byte, error) {
 	dialer := net.Dialer{Timeout: s.config.Timeout}
-	conn, err := dialer.DialContext(ctx, "udp", address)
+	conn, err := dialer.DialContext(ctx, "udp", resolver.HostPort(address, "53"))
 	if err != nil {
-		return fmt.Errorf("dial failed: %w", err)
+		return nil, fmt.Errorf("dial failed: %w", err)
 	}
 	defer conn.Close()
 
-	if _, err := conn.Write(dnsQuery); err != nil {
-		return fmt.Errorf("write failed: %w", err)
+	if _, err := conn.Write(query); err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
 	}
 
-	conn.SetReadDeadline(time.Now().Add(s.config.Timeout))
-	response := make([]byte, 512)
+	conn.SetReadDeadline(s.readDeadline(ctx))
+	response := make([]byte, maxResponse)
 	n, err := conn.Read(response)
 	if err != nil {
-		return fmt.Errorf("read failed: %w", err)
+		return nil, fmt.Errorf("read failed: %w", err)
 	}
-
-	if n < 12 {
-		return fmt.Errorf("response too short: %d bytes", n)
-	}
-
-	if response[2]&0x80 == 0 {
-		return fmt.Errorf("not a DNS response")
-	}
-
-	return nil
+	return response[:n], nil
 }
 
-// testDoHResolver tests a DNS-over-HTTPS resolver.
-func (s *Scanner) testDoHResolver(ctx context.Context, url string) error {
+// exchangeDoH sends a query to a DNS-over-HTTPS resolver.
+func (s *Scanner) exchangeDoH(ctx context.Context, url string, query []byte) ([]byte, error) {
 	if url == "" {
-		return fmt.Errorf("empty DoH URL")
+		return nil, fmt.Errorf("empty DoH URL")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(dnsQuery))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(query))
 	if err != nil {
-		return fmt.Errorf("create request failed: %w", err)
+		return nil, fmt.Errorf("create request failed: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/dns-message")
 	req.Header.Set("Accept", "application/dns-message")
 
-	client := &http.Client{Timeout: s.config.Timeout}
+	transport := &fingerprint.Transport{
+		Dialer: &net.Dialer{Timeout: s.config.Timeout},
+		Config: &utls.Config{ServerName: s.serverName(url)},
+		ID:     s.fingerprints.Pick(),
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Timeout: s.config.Timeout, Transport: transport}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
 	if err != nil {
-		return fmt.Errorf("read response failed: %w", err)
+		return nil, fmt.Errorf("read response failed: %w", err)
 	}
-
-	if len(body) < 12 {
-		return fmt.Errorf("response too short: %d bytes", len(body))
-	}
-
-	if body[2]&0x80 == 0 {
-		return fmt.Errorf("not a DNS response")
-	}
-
-	return nil
+	return body, nil
 }
 
-// testDoTResolver tests a DNS-over-TLS resolver.
-func (s *Scanner) testDoTResolver(ctx context.Context, address string) error {
+// exchangeDoT sends a query to a DNS-over-TLS resolver.
+func (s *Scanner) exchangeDoT(ctx context.Context, address string, query []byte) ([]byte, error) {
 	if address == "" {
-		return fmt.Errorf("empty DoT address")
+		return nil, fmt.Errorf("empty DoT address")
 	}
 
-	dialer := &tls.Dialer{
-		NetDialer: &net.Dialer{Timeout: s.config.Timeout},
-		Config:    &tls.Config{MinVersion: tls.VersionTLS12},
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	cfg := &utls.Config{ServerName: s.serverName(address)}
+	conn, err := fingerprint.Dial(ctx, dialer, "tcp", resolver.HostPort(address, "853"), cfg, s.fingerprints.Pick())
+	if err != nil {
+		return nil, fmt.Errorf("TLS dial failed: %w", err)
 	}
+	defer conn.Close()
+
+	return s.exchangeStream(ctx, conn, query)
+}
 
-	conn, err := dialer.DialContext(ctx, "tcp", address)
+// exchangeTCP sends a query to a resolver over plain TCP.
+func (s *Scanner) exchangeTCP(ctx context.Context, address string, query []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: s.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", resolver.HostPort(address, "53"))
 	if err != nil {
-		return fmt.Errorf("TLS dial failed: %w", err)
+		return nil, fmt.Errorf("dial failed: %w", err)
 	}
 	defer conn.Close()
 
-	// DNS over TLS uses TCP framing: 2-byte length prefix
-	msgLen := uint16(len(dnsQuery))
-	lenBuf := make([]byte, 2)
-	binary.BigEndian.PutUint16(lenBuf, msgLen)
+	return s.exchangeStream(ctx, conn, query)
+}
 
-	if _, err := conn.Write(lenBuf); err != nil {
-		return fmt.Errorf("write length failed: %w", err)
-	}
-	if _, err := conn.Write(dnsQuery); err != nil {
-		return fmt.Errorf("write query failed: %w", err)
+// exchangeStream sends a query over a TCP or TLS connection.
+func (s *Scanner) exchangeStream(ctx context.Context, conn net.Conn, query []byte) ([]byte, error) {
+	// DNS over TCP and TLS uses a 2-byte length prefix
+	msg := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	msg = append(msg, query...)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, fmt.Errorf("write query failed: %w", err)
 	}
 
-	conn.SetReadDeadline(time.Now().Add(s.config.Timeout))
+	conn.SetReadDeadline(s.readDeadline(ctx))
 	respLenBuf := make([]byte, 2)
 	if _, err := io.ReadFull(conn, respLenBuf); err != nil {
-		return fmt.Errorf("read response length failed: %w", err)
+		return nil, fmt.Errorf("read response length failed: %w", err)
 	}
 
 	respLen := binary.BigEndian.Uint16(respLenBuf)
-	if respLen < 12 || respLen > 4096 {
-		return fmt.Errorf("invalid response length: %d", respLen)
+	if respLen < 12 {
+		return nil, fmt.Errorf("invalid response length: %d", respLen)
 	}
 
 	response := make([]byte, respLen)
 	if _, err := io.ReadFull(conn, response); err != nil {
-		return fmt.Errorf("read response failed: %w", err)
+		return nil, fmt.Errorf("read response failed: %w", err)
 	}
-
-	if response[2]&0x80 == 0 {
-		return fmt.Errorf("not a DNS response")
-	}
-
-	return nil
+	return response, nil
 }
@@ -0,0 +1,283 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// CIDR sampling strategy names.
+const (
+	SamplingFirst    = "first"
+	SamplingRandom   = "random"
+	SamplingOffsets  = "offsets"
+	SamplingWeighted = "weighted"
+)
+
+// parseCIDRBlocks parses a list of CIDR ranges (or plain IPs), one per line.
+func parseCIDRBlocks(r io.Reader) ([]netip.Prefix, error) {
+	var blocks []netip.Prefix
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if p, err := netip.ParsePrefix(line); err == nil {
+			blocks = append(blocks, p.Masked())
+		} else if ip, err := netip.ParseAddr(line); err == nil {
+			blocks = append(blocks, netip.PrefixFrom(ip, ip.BitLen()))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading CIDR list: %w", err)
+	}
+
+	return blocks, nil
+}
+
+// sampleBlocks yields up to budget addresses ("ip:53") from blocks using
+// the configured sampling strategy. Except for "first", blocks are visited
+// in random order so repeated scans cover different ranges; rng makes the
+// order replayable when a scan resumes.
+func (s *Scanner) sampleBlocks(blocks []netip.Prefix, budget int, rng *rand.Rand) iter.Seq[string] {
+	cfg := s.config.CIDRSampling
+	perBlock := max(cfg.PerBlock, 1)
+
+	hosts := func(yield func(netip.Addr) bool) {
+		switch cfg.Strategy {
+		case SamplingWeighted:
+			for ip := range sampleWeighted(blocks, budget, rng) {
+				if !yield(ip) {
+					return
+				}
+			}
+			// IPv6 blocks aren't weighted; they get their low addresses
+			for _, i := range rng.Perm(len(blocks)) {
+				if !blocks[i].Addr().Is6() {
+					continue
+				}
+				for _, ip := range randomHosts(blocks[i], perBlock, rng) {
+					if !yield(ip) {
+						return
+					}
+				}
+			}
+		case SamplingRandom:
+			for _, i := range rng.Perm(len(blocks)) {
+				for _, ip := range randomHosts(blocks[i], perBlock, rng) {
+					if !yield(ip) {
+						return
+					}
+				}
+			}
+		case SamplingOffsets:
+			for _, i := range rng.Perm(len(blocks)) {
+				for _, ip := range offsetHosts(blocks[i], cfg.Offsets, perBlock, rng) {
+					if !yield(ip) {
+						return
+					}
+				}
+			}
+		default:
+			for _, b := range blocks {
+				if ip, ok := hostAt(b, 1); ok && !yield(ip) {
+					return
+				}
+			}
+		}
+	}
+
+	return func(yield func(string) bool) {
+		seen := make(map[netip.Addr]bool)
+		for ip := range hosts {
+			if len(seen) >= budget {
+				return
+			}
+			if seen[ip] {
+				continue
+			}
+			seen[ip] = true
+			if !yield(net.JoinHostPort(ip.String(), "53")) {
+				return
+			}
+		}
+	}
+}
+
+// hostAt returns the address offset positions into the block if it is a
+// usable host (not the network or broadcast address of blocks larger than /31).
+func hostAt(b netip.Prefix, offset uint64) (netip.Addr, bool) {
+	if b.Bits() == b.Addr().BitLen() {
+		return b.Addr(), offset == 0 || offset == 1
+	}
+	size, ok := blockSize(b)
+	if ok && offset >= size {
+		return netip.Addr{}, false
+	}
+	if ok && size > 2 && (offset == 0 || offset == size-1) {
+		return netip.Addr{}, false
+	}
+	return addOffset(b.Addr(), offset), true
+}
+
+// blockSize returns the number of addresses in b, or false if it doesn't
+// fit in 64 bits.
+func blockSize(b netip.Prefix) (uint64, bool) {
+	hostBits := b.Addr().BitLen() - b.Bits()
+	if hostBits >= 64 {
+		return 0, false
+	}
+	return 1 << hostBits, true
+}
+
+// addOffset adds offset to the low 64 bits of ip.
+func addOffset(ip netip.Addr, offset uint64) netip.Addr {
+	b := ip.AsSlice()
+	carry := offset
+	for i := len(b) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(b[i]) + carry&0xff
+		b[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	out, _ := netip.AddrFromSlice(b)
+	return out
+}
+
+// randomOffset returns a random host offset in a block of the given size
+// (size 0 means at least 2^64).
+func randomOffset(size uint64, rng *rand.Rand) uint64 {
+	if size == 0 {
+		return rng.Uint64()
+	}
+	if size <= 2 {
+		return rng.Uint64() % size
+	}
+	return 1 + rng.Uint64()%(size-2)
+}
+
+// randomHosts returns up to n distinct random hosts in b. IPv6 blocks are
+// too sparse to guess in, so they get the low addresses instead.
+func randomHosts(b netip.Prefix, n int, rng *rand.Rand) []netip.Addr {
+	if b.Addr().Is6() {
+		return offsetHosts(b, []int{1, 2, 53}, 1, rng)
+	}
+	size, _ := blockSize(b)
+	if size <= uint64(n)+2 {
+		var hosts []netip.Addr
+		for off := uint64(0); off < size; off++ {
+			if ip, ok := hostAt(b, off); ok {
+				hosts = append(hosts, ip)
+			}
+		}
+		return hosts
+	}
+
+	picked := make(map[uint64]bool, n)
+	var hosts []netip.Addr
+	for len(hosts) < n {
+		off := randomOffset(size, rng)
+		if picked[off] {
+			continue
+		}
+		picked[off] = true
+		hosts = append(hosts, addOffset(b.Addr(), off))
+	}
+	return hosts
+}
+
+// offsetHosts applies last-octet offsets (.1, .53, ...) to up to n random
+// /24 subnets of b. For IPv6 the offsets are applied to the block start.
+func offsetHosts(b netip.Prefix, offsets []int, n int, rng *rand.Rand) []netip.Addr {
+	if b.IsSingleIP() {
+		return []netip.Addr{b.Addr()}
+	}
+
+	var bases []netip.Addr
+	switch {
+	case b.Addr().Is6():
+		bases = append(bases, b.Addr())
+	case b.Bits() >= 24:
+		base, _ := b.Addr().Prefix(24)
+		bases = append(bases, base.Addr())
+	default:
+		subnets := uint64(1) << (24 - b.Bits())
+		if subnets <= uint64(n) {
+			for i := uint64(0); i < subnets; i++ {
+				bases = append(bases, addOffset(b.Addr(), i<<8))
+			}
+			break
+		}
+		picked := make(map[uint64]bool, n)
+		for len(bases) < n {
+			i := rng.Uint64() % subnets
+			if picked[i] {
+				continue
+			}
+			picked[i] = true
+			bases = append(bases, addOffset(b.Addr(), i<<8))
+		}
+	}
+
+	var hosts []netip.Addr
+	for _, base := range bases {
+		for _, off := range offsets {
+			ip := addOffset(base, uint64(off))
+			if !b.Contains(ip) {
+				continue
+			}
+			if size, ok := blockSize(b); ok && size > 2 && (ip == b.Addr() || ip == addOffset(b.Addr(), size-1)) {
+				continue
+			}
+			hosts = append(hosts, ip)
+		}
+	}
+	return hosts
+}
+
+// sampleWeighted yields up to budget random hosts, picking each block with
+// probability proportional to its size.
+func sampleWeighted(blocks []netip.Prefix, budget int, rng *rand.Rand) iter.Seq[netip.Addr] {
+	var v4 []netip.Prefix
+	var weights []float64
+	total := 0.0
+	for _, b := range blocks {
+		// IPv6 sizes would drown out every IPv4 block
+		if !b.Addr().Is4() {
+			continue
+		}
+		size, _ := blockSize(b)
+		v4 = append(v4, b)
+		weights = append(weights, float64(size))
+		total += float64(size)
+	}
+
+	return func(yield func(netip.Addr) bool) {
+		if total == 0 {
+			return
+		}
+		picked := 0
+		for attempts := 0; picked < budget && attempts < budget*4; attempts++ {
+			x := rng.Float64() * total
+			i := 0
+			for ; i < len(weights)-1 && x >= weights[i]; i++ {
+				x -= weights[i]
+			}
+			size, _ := blockSize(v4[i])
+			if ip, ok := hostAt(v4[i], randomOffset(size, rng)); ok {
+				picked++
+				if !yield(ip) {
+					return
+				}
+			}
+		}
+	}
+}
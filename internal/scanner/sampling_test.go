@@ -0,0 +1,243 @@
+package scanner
+
+import (
+	"math/rand"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+)
+
+func prefixes(ss ...string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, s := range ss {
+		out = append(out, netip.MustParsePrefix(s))
+	}
+	return out
+}
+
+func addrs(ss ...string) []netip.Addr {
+	var out []netip.Addr
+	for _, s := range ss {
+		out = append(out, netip.MustParseAddr(s))
+	}
+	return out
+}
+
+func TestParseCIDRBlocks(t *testing.T) {
+	data := "# ranges\n5.160.0.0/16\n\n  2.144.3.7/22 \n2001:db8::/32\n185.1.2.3\nnot a range\n"
+	got, err := parseCIDRBlocks(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := prefixes("5.160.0.0/16", "2.144.0.0/22", "2001:db8::/32", "185.1.2.3/32")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHostAt(t *testing.T) {
+	tests := []struct {
+		block  string
+		offset uint64
+		want   string
+		ok     bool
+	}{
+		{"10.0.0.0/24", 1, "10.0.0.1", true},
+		{"10.0.0.0/24", 254, "10.0.0.254", true},
+		{"10.0.0.0/24", 0, "", false},
+		{"10.0.0.0/24", 255, "", false},
+		{"10.0.0.0/24", 256, "", false},
+		{"10.0.0.0/16", 300, "10.0.1.44", true},
+		{"10.0.0.0/31", 0, "10.0.0.0", true},
+		{"10.0.0.0/31", 1, "10.0.0.1", true},
+		{"10.0.0.0/31", 2, "", false},
+		{"10.0.0.7/32", 0, "10.0.0.7", true},
+		{"10.0.0.7/32", 1, "10.0.0.7", true},
+		{"10.0.0.7/32", 2, "", false},
+		{"2001:db8::/32", 1, "2001:db8::1", true},
+	}
+	for _, tt := range tests {
+		got, ok := hostAt(netip.MustParsePrefix(tt.block), tt.offset)
+		if ok != tt.ok || (ok && got != netip.MustParseAddr(tt.want)) {
+			t.Errorf("hostAt(%s, %d) = %v, %v; want %s, %v", tt.block, tt.offset, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAddOffset(t *testing.T) {
+	tests := []struct {
+		ip     string
+		offset uint64
+		want   string
+	}{
+		{"10.0.0.0", 0, "10.0.0.0"},
+		{"10.0.0.255", 1, "10.0.1.0"},
+		{"10.0.255.255", 1, "10.1.0.0"},
+		{"10.0.0.0", 1 << 16, "10.1.0.0"},
+		{"2001:db8::ffff", 1, "2001:db8::1:0"},
+	}
+	for _, tt := range tests {
+		if got := addOffset(netip.MustParseAddr(tt.ip), tt.offset); got != netip.MustParseAddr(tt.want) {
+			t.Errorf("addOffset(%s, %d) = %s, want %s", tt.ip, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestOffsetHosts(t *testing.T) {
+	offsets := []int{1, 53, 255}
+	tests := []struct {
+		block string
+		n     int
+		want  []netip.Addr
+	}{
+		{"10.0.0.0/24", 2, addrs("10.0.0.1", "10.0.0.53")},
+		{"10.0.0.128/25", 2, nil},
+		{"10.0.0.0/23", 2, addrs("10.0.0.1", "10.0.0.53", "10.0.0.255", "10.0.1.1", "10.0.1.53")},
+		{"10.0.0.7/32", 2, addrs("10.0.0.7")},
+		{"2001:db8::/32", 2, addrs("2001:db8::1", "2001:db8::35", "2001:db8::ff")},
+	}
+	for _, tt := range tests {
+		got := offsetHosts(netip.MustParsePrefix(tt.block), offsets, tt.n, rand.New(rand.NewSource(1)))
+		slices.SortFunc(got, netip.Addr.Compare)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("offsetHosts(%s) = %v, want %v", tt.block, got, tt.want)
+		}
+	}
+
+	// Large blocks get offsets in n distinct /24s
+	b := netip.MustParsePrefix("10.0.0.0/16")
+	got := offsetHosts(b, []int{1}, 3, rand.New(rand.NewSource(1)))
+	subnets := make(map[netip.Prefix]bool)
+	for _, ip := range got {
+		p, _ := ip.Prefix(24)
+		if !b.Contains(ip) || ip.As4()[3] != 1 {
+			t.Errorf("host %s is not a .1 in %s", ip, b)
+		}
+		subnets[p] = true
+	}
+	if len(got) != 3 || len(subnets) != 3 {
+		t.Errorf("got %v, want .1 in 3 distinct /24s", got)
+	}
+}
+
+func TestRandomHosts(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// Small blocks give every usable host
+	got := randomHosts(netip.MustParsePrefix("10.0.0.0/30"), 4, rng)
+	if want := addrs("10.0.0.1", "10.0.0.2"); !slices.Equal(got, want) {
+		t.Errorf("/30: got %v, want %v", got, want)
+	}
+
+	b := netip.MustParsePrefix("10.0.0.0/16")
+	got = randomHosts(b, 50, rng)
+	seen := make(map[netip.Addr]bool)
+	for _, ip := range got {
+		if !b.Contains(ip) || ip == b.Addr() || ip == netip.MustParseAddr("10.0.255.255") {
+			t.Errorf("%s is not a usable host of %s", ip, b)
+		}
+		seen[ip] = true
+	}
+	if len(got) != 50 || len(seen) != 50 {
+		t.Errorf("got %d hosts (%d distinct), want 50", len(got), len(seen))
+	}
+
+	// IPv6 blocks get their low addresses
+	got = randomHosts(netip.MustParsePrefix("2001:db8::/32"), 5, rng)
+	if want := addrs("2001:db8::1", "2001:db8::2", "2001:db8::35"); !slices.Equal(got, want) {
+		t.Errorf("IPv6: got %v, want %v", got, want)
+	}
+}
+
+func TestSampleWeighted(t *testing.T) {
+	blocks := prefixes("10.0.0.0/16", "10.1.0.0/24", "2001:db8::/32")
+	big, small := 0, 0
+	for ip := range sampleWeighted(blocks, 2000, rand.New(rand.NewSource(1))) {
+		switch {
+		case blocks[0].Contains(ip):
+			big++
+		case blocks[1].Contains(ip):
+			small++
+		default:
+			t.Fatalf("%s is not in a weighted IPv4 block", ip)
+		}
+	}
+	if big+small != 2000 {
+		t.Errorf("got %d hosts, want 2000", big+small)
+	}
+	// The /16 is 256 times the /24
+	if small == 0 || small > 30 {
+		t.Errorf("%d of 2000 hosts in the /24, want about 8", small)
+	}
+
+	if n := len(slices.Collect(sampleWeighted(prefixes("2001:db8::/32"), 10, rand.New(rand.NewSource(1))))); n != 0 {
+		t.Errorf("got %d hosts from IPv6 blocks only, want none", n)
+	}
+}
+
+func TestSampleBlocks(t *testing.T) {
+	blocks := prefixes("10.0.0.0/24", "10.1.0.0/16", "10.2.0.0/24", "10.3.0.7/32", "2001:db8::/32")
+	offsets := []int{1, 53}
+
+	tests := []struct {
+		strategy string
+		budget   int
+		want     int
+	}{
+		{SamplingFirst, 100, 5},
+		{SamplingFirst, 2, 2},
+		{SamplingRandom, 100, 10},
+		{SamplingOffsets, 100, 11},
+		{SamplingOffsets, 3, 3},
+		{SamplingWeighted, 20, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			s := New(&config.ScannerConfig{CIDRSampling: config.CIDRSamplingConfig{
+				Strategy: tt.strategy,
+				PerBlock: 2,
+				Offsets:  offsets,
+			}}, nil)
+			var got []string
+			seen := make(map[string]bool)
+			for addr := range s.sampleBlocks(blocks, tt.budget, rand.New(rand.NewSource(1))) {
+				host, port, err := net.SplitHostPort(addr)
+				if err != nil || port != "53" {
+					t.Fatalf("bad address %q", addr)
+				}
+				ip := netip.MustParseAddr(host)
+				if !slices.ContainsFunc(blocks, func(b netip.Prefix) bool { return b.Contains(ip) }) {
+					t.Errorf("%s is outside every block", ip)
+				}
+				if seen[addr] {
+					t.Errorf("%s yielded twice", addr)
+				}
+				seen[addr] = true
+				got = append(got, addr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("got %d addresses %v, want %d", len(got), got, tt.want)
+			}
+		})
+	}
+
+	// "first" keeps the list order and takes network+1
+	s := New(&config.ScannerConfig{CIDRSampling: config.CIDRSamplingConfig{Strategy: SamplingFirst}}, nil)
+	got := slices.Collect(s.sampleBlocks(blocks, 100, rand.New(rand.NewSource(1))))
+	want := []string{"10.0.0.1:53", "10.1.0.1:53", "10.2.0.1:53", "10.3.0.7:53", "[2001:db8::1]:53"}
+	if !slices.Equal(got, want) {
+		t.Errorf("first: got %v, want %v", got, want)
+	}
+
+	// The same seed replays the same order
+	s.config.CIDRSampling = config.CIDRSamplingConfig{Strategy: SamplingRandom, PerBlock: 2}
+	a := slices.Collect(s.sampleBlocks(blocks, 100, rand.New(rand.NewSource(7))))
+	b := slices.Collect(s.sampleBlocks(blocks, 100, rand.New(rand.NewSource(7))))
+	if !slices.Equal(a, b) {
+		t.Errorf("same seed gave %v and %v", a, b)
+	}
+}
@@ -3,12 +3,19 @@ package scanner
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
 	"log"
+	"math/rand"
+	"net/netip"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/fingerprint"
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
 )
 
@@ -16,6 +23,39 @@ import (
 type Scanner struct {
 	config *config.ScannerConfig
 	pool   *resolver.Pool
+
+	// domain enables the tunnel-compatibility probe when set
+	domain string
+
+	// echoKey signs echo probes (the tunnel public key)
+	echoKey string
+
+	// family orders IPv4 and IPv6 country ranges (resolver.Family*)
+	family string
+
+	// fingerprints are the tunnel's uTLS ClientHellos, which TLS probes
+	// present too
+	fingerprints fingerprint.Distribution
+
+	// serverNames holds the TLS names guessed for encrypted candidates
+	// on IPs their certificates don't cover, by address
+	serverNames sync.Map
+
+	// pacer enforces rate_limit and subnet_interval
+	pacer *pacer
+
+	// control caches the control resolvers' answers
+	controlMu sync.Mutex
+	control   map[netip.Prefix]bool
+	controlAt time.Time
+
+	// cache holds addresses that answered in earlier scans
+	cacheMu sync.Mutex
+	cache   map[string]*responsiveEntry
+
+	// scanning is the ScanFromSources call in progress, if any
+	scanMu   sync.Mutex
+	scanning *scanCall
 }
 
 // New creates a new Scanner instance.
@@ -23,68 +63,88 @@ func New(cfg *config.ScannerConfig, pool *resolver.Pool) *Scanner {
 	return &Scanner{
 		config: cfg,
 		pool:   pool,
+		pacer:  newPacer(cfg.RateLimit, cfg.SubnetInterval),
 	}
 }
 
+// SetFamily sets which country ranges are scanned first: IPv4 for
+// prefer-v4, IPv6 for prefer-v6, or both interleaved.
+func (s *Scanner) SetFamily(family string) {
+	s.family = family
+}
+
 // ScanResult represents the result of scanning a single resolver.
 type ScanResult struct {
-	Address  string
-	Type     string
-	Working  bool
-	Latency  time.Duration
-	Error    error
+	Address string
+	Type    string
+	Source  string
+	Working bool
+	Latency time.Duration
+	Error   error
+
+	// ServerName is the TLS name guessed for an encrypted resolver on an
+	// IP its certificate doesn't cover
+	ServerName string
+
+	// Verdict classifies the resolver's answers; empty if it didn't answer
+	Verdict Verdict
+
+	// Filtered lists the filter_domains the resolver blocks
+	Filtered []string
+
+	// Incompatible is set when the resolver answers DNS but fails the
+	// tunnel probe
+	Incompatible bool
+
+	// MaxResponse is the largest response the tunnel probe got through
+	MaxResponse int
 }
 
 // Scan performs a scan of all provided resolver addresses.
 func (s *Scanner) Scan(ctx context.Context, addresses []string, resolverType string) []ScanResult {
-	results := make([]ScanResult, 0, len(addresses))
-	resultCh := make(chan ScanResult, len(addresses))
-
-	// Create worker pool
-	sem := make(chan struct{}, s.config.ConcurrentScans)
-	var wg sync.WaitGroup
-
+	candidates := make([]Candidate, 0, len(addresses))
 	for _, addr := range addresses {
-		wg.Add(1)
-		go func(address string) {
-			defer wg.Done()
-
-			// Acquire semaphore
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-ctx.Done():
-				resultCh <- ScanResult{
-					Address: address,
-					Type:    resolverType,
-					Working: false,
-					Error:   ctx.Err(),
-				}
-				return
-			}
-
-			result := s.testResolver(ctx, address, resolverType)
-			resultCh <- result
-		}(addr)
+		candidates = append(candidates, Candidate{Address: addr, Type: resolverType})
 	}
+	return s.ScanCandidates(ctx, candidates)
+}
 
-	// Close result channel when all workers done
-	go func() {
-		wg.Wait()
-		close(resultCh)
-	}()
+// ScanCandidates scans candidates of any type, recording each working
+// resolver's source list in the pool.
+func (s *Scanner) ScanCandidates(ctx context.Context, candidates []Candidate) []ScanResult {
+	results := make([]ScanResult, 0, len(candidates))
+	s.scanStream(ctx, slices.Values(candidates), 0, func(r ScanResult, _ int) {
+		results = append(results, r)
+	})
+	return results
+}
 
-	// Collect results
-	for result := range resultCh {
-		results = append(results, result)
-		if result.Working {
-			s.pool.Add(result.Address, result.Type)
-			s.pool.MarkHealthy(result.Address, result.Latency)
-			log.Printf("Found working resolver: %s (latency: %v)", result.Address, result.Latency)
+// record adds a working or incompatible resolver to the pool.
+func (s *Scanner) record(result ScanResult) {
+	if result.Working {
+		s.pool.AddFrom(result.Address, result.Type, resolver.OriginScan)
+		s.pool.SetSource(result.Address, result.Source)
+		s.pool.SetServerName(result.Address, result.ServerName)
+		s.pool.MarkHealthy(result.Address, result.Latency)
+		details := []string{fmt.Sprintf("latency: %v", result.Latency)}
+		if result.ServerName != "" {
+			details = append(details, "TLS name: "+result.ServerName)
 		}
+		if result.MaxResponse > 0 {
+			s.pool.SetMaxResponse(result.Address, result.MaxResponse)
+			details = append(details, fmt.Sprintf("max response: %d bytes", result.MaxResponse))
+		}
+		if result.Verdict == VerdictFiltering {
+			details = append(details, "filters "+strings.Join(result.Filtered, ", "))
+		}
+		log.Printf("Found working resolver: %s (%s)", result.Address, strings.Join(details, ", "))
+	} else if result.Incompatible {
+		s.pool.AddFrom(result.Address, result.Type, resolver.OriginScan)
+		s.pool.SetSource(result.Address, result.Source)
+		s.pool.SetServerName(result.Address, result.ServerName)
+		s.pool.MarkIncompatible(result.Address)
+		log.Printf("Incompatible resolver: %s (%v)", result.Address, result.Error)
 	}
-
-	return results
 }
 
 // testResolver tests if a DNS resolver works for tunnel traffic.
@@ -94,73 +154,282 @@ func (s *Scanner) testResolver(ctx context.Context, address, resolverType string
 		Type:    resolverType,
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
-	defer cancel()
+	// Encrypted candidates on bare IPs need a TLS server and a name
+	if resolverType == "doh" || resolverType == "dot" {
+		serverName, err := s.tlsEndpoint(ctx, address, resolverType)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		result.ServerName = serverName
+	}
 
 	start := time.Now()
-
-	switch resolverType {
-	case "udp":
-		result.Error = s.testUDPResolver(ctx, address)
-	case "doh":
-		result.Error = s.testDoHResolver(ctx, address)
-	case "dot":
-		result.Error = s.testDoTResolver(ctx, address)
-	default:
-		result.Error = fmt.Errorf("unknown resolver type: %s", resolverType)
+	ans, err := s.query(ctx, address, resolverType, controlDomain)
+	result.Latency = time.Since(start)
+	if err != nil {
+		if errors.Is(err, errForged) {
+			result.Verdict = VerdictHijacked
+		}
+		result.Error = err
+		return result
 	}
 
-	result.Latency = time.Since(start)
+	result.Verdict, result.Filtered, result.Error = s.classify(ctx, address, resolverType, ans)
 	result.Working = result.Error == nil
 
+	// Answering example.com isn't enough: hijacking or label-mangling
+	// resolvers pass that but break the tunnel
+	if result.Working && s.domain != "" {
+		maxResponse, err := s.testTunnel(ctx, address, resolverType)
+		if err != nil {
+			result.Working = false
+			result.Incompatible = ctx.Err() == nil
+			result.Error = fmt.Errorf("tunnel probe failed: %w", err)
+		}
+		result.MaxResponse = maxResponse
+	}
+
 	return result
 }
 
-// ScanFromSources fetches resolver lists from configured sources and scans them.
-func (s *Scanner) ScanFromSources(ctx context.Context) (int, error) {
-	// Start with default public DNS resolvers
-	candidates := []string{
-		"8.8.8.8:53",
-		"8.8.4.4:53",
-		"1.1.1.1:53",
-		"1.0.0.1:53",
-		"9.9.9.9:53",
-		"208.67.222.222:53",
-		"208.67.220.220:53",
-	}
+// builtinResolvers are scanned first, before any configured source.
+var builtinResolvers = []string{
+	"8.8.8.8:53",
+	"8.8.4.4:53",
+	"1.1.1.1:53",
+	"1.0.0.1:53",
+	"9.9.9.9:53",
+	"208.67.222.222:53",
+	"208.67.220.220:53",
+}
 
-	// Fetch country IP ranges if configured
-	if s.config.CountryCode != "" {
-		log.Printf("Fetching IP ranges for country: %s", s.config.CountryCode)
-		countryIPs, err := s.fetchCountryIPRanges(ctx, s.config.CountryCode)
-		if err != nil {
-			log.Printf("Failed to fetch country IP ranges: %v", err)
-		} else {
-			log.Printf("Fetched %d IP candidates from country ranges", len(countryIPs))
-			candidates = append(candidates, countryIPs...)
+// ScanFromSources fetches resolver lists from configured sources and scans
+// them as a stream, adding resolvers to the pool as they are found. An
+// interrupted scan is checkpointed and resumed by the next call. Calls
+// made while a scan is running wait for it and share its result, since
+// they would scan the same candidates and share its checkpoint.
+func (s *Scanner) ScanFromSources(ctx context.Context) (int, error) {
+	s.scanMu.Lock()
+	if call := s.scanning; call != nil {
+		s.scanMu.Unlock()
+		log.Printf("Scan already running; waiting for it")
+		select {
+		case <-call.done:
+			return call.working, call.err
+		case <-ctx.Done():
+			return 0, ctx.Err()
 		}
 	}
+	call := &scanCall{done: make(chan struct{})}
+	s.scanning = call
+	s.scanMu.Unlock()
+
+	call.working, call.err = s.scanFromSources(ctx)
 
+	s.scanMu.Lock()
+	s.scanning = nil
+	s.scanMu.Unlock()
+	close(call.done)
+	return call.working, call.err
+}
+
+// scanFromSources runs one ScanFromSources scan.
+func (s *Scanner) scanFromSources(ctx context.Context) (int, error) {
 	// Limit candidates to MaxCandidates (default 100 if not set)
 	maxCandidates := s.config.MaxCandidates
 	if maxCandidates <= 0 {
 		maxCandidates = 100 // Safe default - never scan unlimited IPs
 	}
-	if len(candidates) > maxCandidates {
-		log.Printf("Limiting scan from %d to %d candidates", len(candidates), maxCandidates)
-		candidates = candidates[:maxCandidates]
-	}
 
-	log.Printf("Scanning %d resolver candidates", len(candidates))
-	results := s.Scan(ctx, candidates, "udp")
+	// The remote lists are fetched up front: resuming skips candidates by
+	// position, which is only valid if the lists are unchanged
+	lists := s.fetchLists(ctx)
+	key := s.checkpointKey(maxCandidates)
+	cp := s.loadCheckpoint(key, lists.hash())
+	if cp != nil {
+		log.Printf("Resuming scan from candidate %d (%d working found so far, started %s)",
+			cp.Done, cp.Working, cp.StartedAt.Format(time.RFC3339))
+	} else {
+		cp = &checkpoint{Key: key, Lists: lists.hash(), Seed: time.Now().UnixNano(), StartedAt: time.Now()}
+		// Addresses that answered in earlier scans come right after the builtins
+		cp.Cached = s.cachedCandidates()
+		if len(cp.Cached) > 0 {
+			log.Printf("Starting from %d previously responsive addresses", len(cp.Cached))
+		}
+	}
 
-	working := 0
-	for _, r := range results {
+	log.Printf("Scanning up to %d resolver candidates", maxCandidates)
+	working, scanned := 0, 0
+	verdicts := make(map[Verdict]int)
+	lastSave := time.Now()
+	s.scanStream(ctx, s.candidates(ctx, cp, lists, maxCandidates), cp.Done, func(r ScanResult, done int) {
+		scanned++
 		if r.Working {
 			working++
+			cp.Working++
 		}
+		if r.Verdict != "" {
+			verdicts[r.Verdict]++
+		}
+		s.noteResponsive(r)
+
+		cp.Done = done
+		if time.Since(lastSave) >= checkpointInterval {
+			s.saveCheckpoint(cp)
+			lastSave = time.Now()
+		}
+	})
+	s.saveCache()
+
+	if ctx.Err() != nil {
+		s.saveCheckpoint(cp)
+		log.Printf("Scan interrupted after %d candidates; it will resume from there", cp.Done)
+	} else {
+		s.clearCheckpoint()
 	}
 
+	log.Printf("Scanned %d candidates: %d clean, %d filtering, %d hijacked, %d lying",
+		scanned, verdicts[VerdictClean], verdicts[VerdictFiltering], verdicts[VerdictHijacked], verdicts[VerdictLying])
+
 	return working, nil
 }
+
+// candidates yields the scan order: builtin resolvers, curated encrypted
+// resolvers, the responsive cache snapshot in cp, the resolver lists and
+// then samples of the country's IPv4 and IPv6 ranges, without duplicates
+// and up to limit in total. With probe_encrypted each IP from the lists
+// and ranges is followed by its DoH and DoT endpoints.
+func (s *Scanner) candidates(ctx context.Context, cp *checkpoint, lists *scanLists, limit int) iter.Seq[Candidate] {
+	return func(yield func(Candidate) bool) {
+		seen := make(map[string]bool)
+		emit := func(c Candidate) bool {
+			if seen[c.Address] {
+				return true
+			}
+			if len(seen) >= limit {
+				log.Printf("Reached max_candidates (%d)", limit)
+				return false
+			}
+			seen[c.Address] = true
+			return yield(c)
+		}
+		// emitProbed adds the encrypted endpoints on c's host
+		emitProbed := func(c Candidate) bool {
+			if !emit(c) {
+				return false
+			}
+			if !s.config.ProbeEncrypted || c.Type != "udp" {
+				return true
+			}
+			for _, e := range encryptedCandidates(c) {
+				if !emit(e) {
+					return false
+				}
+			}
+			return true
+		}
+
+		for _, addr := range builtinResolvers {
+			if !emit(Candidate{Address: addr, Type: "udp", Source: SourceBuiltin}) {
+				return
+			}
+		}
+		if s.config.CuratedEncrypted {
+			for _, addr := range curatedEncrypted {
+				c := Candidate{Address: addr, Type: resolver.TypeForAddress(addr, "udp"), Source: SourceCurated}
+				if !emit(c) {
+					return
+				}
+			}
+		}
+		for _, c := range cp.Cached {
+			if !emit(c) {
+				return
+			}
+		}
+		for _, c := range lists.sources {
+			if !emitProbed(c) {
+				return
+			}
+		}
+
+		if s.config.CountryCode == "" || ctx.Err() != nil {
+			return
+		}
+		v4 := s.countrySample(ctx, lists.v4, "IPv4", limit, rand.New(rand.NewSource(cp.Seed)))
+		v6 := s.countrySample(ctx, lists.v6, "IPv6", limit, rand.New(rand.NewSource(cp.Seed+1)))
+		var sample iter.Seq[string]
+		switch s.family {
+		case resolver.FamilyBoth:
+			sample = interleave(v4, v6)
+		case resolver.FamilyPreferV6:
+			sample = concat(v6, v4)
+		default:
+			sample = concat(v4, v6)
+		}
+
+		source := SourceCountry + strings.ToLower(s.config.CountryCode)
+		for addr := range sample {
+			if !emitProbed(Candidate{Address: addr, Type: "udp", Source: source}) {
+				return
+			}
+		}
+	}
+}
+
+// countrySample yields addresses sampled from one family's country blocks.
+func (s *Scanner) countrySample(ctx context.Context, blocks []netip.Prefix, family string, limit int, rng *rand.Rand) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		if ctx.Err() != nil || len(blocks) == 0 {
+			return
+		}
+		log.Printf("Sampling %d country %s ranges (%s)", len(blocks), family, s.config.CIDRSampling.Strategy)
+		for addr := range s.sampleBlocks(blocks, limit, rng) {
+			if !yield(addr) {
+				return
+			}
+		}
+	}
+}
+
+// concat yields all of a, then all of b.
+func concat[T any](a, b iter.Seq[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range a {
+			if !yield(v) {
+				return
+			}
+		}
+		for v := range b {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// interleave alternates between a and b, finishing whichever lasts longer.
+func interleave[T any](a, b iter.Seq[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		nextA, stopA := iter.Pull(a)
+		defer stopA()
+		nextB, stopB := iter.Pull(b)
+		defer stopB()
+
+		okA, okB := true, true
+		for okA || okB {
+			var v T
+			if okA {
+				if v, okA = nextA(); okA && !yield(v) {
+					return
+				}
+			}
+			if okB {
+				if v, okB = nextB(); okB && !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
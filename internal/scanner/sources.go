@@ -0,0 +1,308 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// maxSourceSize caps how much of a resolver list is read.
+const maxSourceSize = 16 << 20
+
+// Sources for candidates that don't come from resolver_sources.
+const (
+	SourceBuiltin = "builtin"
+	SourceCountry = "country:"
+)
+
+// Candidate is an address to scan and the list it came from.
+type Candidate struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Source  string `json:"source,omitempty"`
+}
+
+// sourceEntry is one parsed list entry before normalization.
+type sourceEntry struct {
+	address     string
+	reliability float64 // -1 if the list has no reliability column
+}
+
+// fetchSources downloads and parses every configured resolver source.
+// Sources that fail are logged and skipped.
+func (s *Scanner) fetchSources(ctx context.Context) []Candidate {
+	var candidates []Candidate
+	for _, src := range s.config.ResolverSources {
+		found, err := s.fetchSource(ctx, src)
+		if err != nil {
+			log.Printf("Resolver source %s failed: %v", src, err)
+			continue
+		}
+		log.Printf("Fetched %d candidates from %s", len(found), src)
+		candidates = append(candidates, found...)
+	}
+	return candidates
+}
+
+// fetchSource reads one source (http(s) URL, file:// URL or path) and
+// parses it as JSON, CSV or a plain list depending on its content.
+func (s *Scanner) fetchSource(ctx context.Context, src string) ([]Candidate, error) {
+	data, err := s.readSource(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseSource(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Most reliable first, so MaxCandidates keeps the best of large lists
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].reliability > entries[j].reliability
+	})
+
+	var candidates []Candidate
+	skipped := 0
+	for _, e := range entries {
+		if e.reliability >= 0 && e.reliability < s.config.MinSourceReliability {
+			skipped++
+			continue
+		}
+		addr, ok := normalizeAddress(e.address)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, Candidate{
+			Address: addr,
+			Type:    resolver.TypeForAddress(addr, "udp"),
+			Source:  src,
+		})
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d entries from %s below reliability %.2f",
+			skipped, src, s.config.MinSourceReliability)
+	}
+	return candidates, nil
+}
+
+// readSource returns the raw content of a source.
+func (s *Scanner) readSource(ctx context.Context, src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		f, err := os.Open(strings.TrimPrefix(src, "file://"))
+		if err != nil {
+			return nil, fmt.Errorf("opening list: %w", err)
+		}
+		defer f.Close()
+		return io.ReadAll(io.LimitReader(f, maxSourceSize))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", "dns-tunnel-scanner/1.0")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSourceSize))
+}
+
+// parseSource detects the list format: JSON if it starts with [ or {,
+// CSV if the first line has commas, otherwise one address per line.
+func parseSource(data []byte) ([]sourceEntry, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	switch {
+	case trimmed[0] == '[' || trimmed[0] == '{':
+		return parseJSONList(trimmed)
+	case bytes.ContainsRune(firstLine(trimmed), ','):
+		return parseCSVList(trimmed)
+	default:
+		return parsePlainList(trimmed), nil
+	}
+}
+
+// firstLine returns data up to the first newline.
+func firstLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
+// parsePlainList reads one address per line; # starts a comment and only
+// the first field of a line is used.
+func parsePlainList(data []byte) []sourceEntry {
+	var entries []sourceEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entries = append(entries, sourceEntry{address: fields[0], reliability: -1})
+	}
+	return entries
+}
+
+// parseCSVList reads a CSV list such as public-dns.info's
+// (ip_address,name,...,reliability,...). Without a recognized header the
+// first column is the address.
+func parseCSVList(data []byte) ([]sourceEntry, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parsing CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	addrCol, relCol, errCol := -1, -1, -1
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "ip_address", "ip", "address", "resolver":
+			addrCol = i
+		case "reliability":
+			relCol = i
+		case "error":
+			errCol = i
+		}
+	}
+	if addrCol < 0 {
+		addrCol = 0
+	} else {
+		records = records[1:]
+	}
+
+	var entries []sourceEntry
+	for _, rec := range records {
+		if addrCol >= len(rec) {
+			continue
+		}
+		// public-dns.info keeps failing servers with an error message
+		if errCol >= 0 && errCol < len(rec) && strings.TrimSpace(rec[errCol]) != "" {
+			continue
+		}
+		e := sourceEntry{address: strings.TrimSpace(rec[addrCol]), reliability: -1}
+		if relCol >= 0 && relCol < len(rec) {
+			if rel, err := strconv.ParseFloat(strings.TrimSpace(rec[relCol]), 64); err == nil {
+				e.reliability = rel
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// jsonEntry is an object entry in a JSON list.
+type jsonEntry struct {
+	IP          string   `json:"ip"`
+	IPAddress   string   `json:"ip_address"`
+	Address     string   `json:"address"`
+	Reliability *float64 `json:"reliability"`
+	Error       string   `json:"error"`
+}
+
+// parseJSONList reads a JSON array of address strings or objects with
+// ip/ip_address/address and optional reliability, or an object holding
+// such an array under "resolvers" or "nameservers".
+func parseJSONList(data []byte) ([]sourceEntry, error) {
+	if data[0] == '{' {
+		var wrapper map[string]json.RawMessage
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, fmt.Errorf("parsing JSON: %w", err)
+		}
+		list, ok := wrapper["resolvers"]
+		if !ok {
+			list, ok = wrapper["nameservers"]
+		}
+		if !ok {
+			return nil, fmt.Errorf("JSON object has no resolvers or nameservers list")
+		}
+		data = list
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+
+	var entries []sourceEntry
+	for _, item := range items {
+		var addr string
+		if err := json.Unmarshal(item, &addr); err == nil {
+			entries = append(entries, sourceEntry{address: addr, reliability: -1})
+			continue
+		}
+		var obj jsonEntry
+		if err := json.Unmarshal(item, &obj); err != nil || obj.Error != "" {
+			continue
+		}
+		e := sourceEntry{address: obj.IP, reliability: -1}
+		if e.address == "" {
+			e.address = obj.IPAddress
+		}
+		if e.address == "" {
+			e.address = obj.Address
+		}
+		if obj.Reliability != nil {
+			e.reliability = *obj.Reliability
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// normalizeAddress turns a list entry into a scannable address: DoH URLs
+// and tls:// entries are kept, bare IPs get port 53 and IPv6 is bracketed.
+func normalizeAddress(entry string) (string, bool) {
+	entry = strings.TrimSpace(entry)
+	if strings.HasPrefix(entry, "https://") || strings.HasPrefix(entry, "tls://") {
+		return entry, true
+	}
+
+	if ap, err := netip.ParseAddrPort(entry); err == nil {
+		if ap.Addr().Zone() != "" {
+			return "", false
+		}
+		return net.JoinHostPort(ap.Addr().Unmap().String(), strconv.Itoa(int(ap.Port()))), true
+	}
+	if ip, err := netip.ParseAddr(entry); err == nil {
+		if ip.Zone() != "" {
+			return "", false
+		}
+		return net.JoinHostPort(ip.Unmap().String(), "53"), true
+	}
+	return "", false
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []sourceEntry
+		wantErr bool
+	}{
+		{name: "empty", data: " \n\n"},
+		{
+			name: "plain list",
+			data: "# resolvers\n1.1.1.1\n\n  8.8.8.8 google # primary\n2001:4860:4860::8888\n",
+			want: []sourceEntry{{"1.1.1.1", -1}, {"8.8.8.8", -1}, {"2001:4860:4860::8888", -1}},
+		},
+		{
+			name: "public-dns.info CSV",
+			data: "ip_address,name,as_number,as_org,country_code,city,version,error,dnssec,reliability,checked_at,created_at\n" +
+				"1.1.1.1,one.one.one.one,13335,Cloudflare,US,,,,true,1.00,2024-01-01,2020-01-01\n" +
+				"9.9.9.9,dns.quad9.net,19281,Quad9,US,,,timeout,true,0.10,2024-01-01,2020-01-01\n" +
+				"8.8.4.4,dns.google,15169,Google,US,,,,true,0.75,2024-01-01,2020-01-01\n",
+			want: []sourceEntry{{"1.1.1.1", 1}, {"8.8.4.4", 0.75}},
+		},
+		{
+			name: "CSV without header",
+			data: "1.1.1.1,cloudflare\n# comment\n8.8.8.8,google\n",
+			want: []sourceEntry{{"1.1.1.1", -1}, {"8.8.8.8", -1}},
+		},
+		{
+			name: "CSV with unparsable reliability",
+			data: "address,reliability\n1.1.1.1,n/a\n",
+			want: []sourceEntry{{"1.1.1.1", -1}},
+		},
+		{
+			name: "JSON strings",
+			data: `["1.1.1.1", "https://dns.google/dns-query"]`,
+			want: []sourceEntry{{"1.1.1.1", -1}, {"https://dns.google/dns-query", -1}},
+		},
+		{
+			name: "JSON objects",
+			data: `[{"ip": "1.1.1.1", "reliability": 0.9}, {"ip_address": "8.8.8.8"},
+				{"address": "9.9.9.9", "reliability": 0}, {"ip": "4.4.4.4", "error": "refused"}, 42]`,
+			want: []sourceEntry{{"1.1.1.1", 0.9}, {"8.8.8.8", -1}, {"9.9.9.9", 0}},
+		},
+		{
+			name: "JSON resolvers object",
+			data: `{"updated": "today", "resolvers": ["1.1.1.1"]}`,
+			want: []sourceEntry{{"1.1.1.1", -1}},
+		},
+		{
+			name: "JSON nameservers object",
+			data: `{"nameservers": [{"ip": "8.8.8.8"}]}`,
+			want: []sourceEntry{{"8.8.8.8", -1}},
+		},
+		{name: "JSON object without a list", data: `{"servers": []}`, wantErr: true},
+		{name: "broken JSON", data: `["1.1.1.1"`, wantErr: true},
+		{name: "broken CSV", data: "address,name\n\"1.1.1.1,x\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSource([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+		ok    bool
+	}{
+		{"1.1.1.1", "1.1.1.1:53", true},
+		{" 1.1.1.1:5353 ", "1.1.1.1:5353", true},
+		{"::ffff:1.1.1.1", "1.1.1.1:53", true},
+		{"2001:4860:4860::8888", "[2001:4860:4860::8888]:53", true},
+		{"[2001:4860:4860::8888]:853", "[2001:4860:4860::8888]:853", true},
+		{"https://dns.google/dns-query", "https://dns.google/dns-query", true},
+		{"tls://1.1.1.1:853", "tls://1.1.1.1:853", true},
+		{"fe80::1%eth0", "", false},
+		{"dns.google", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeAddress(tt.entry)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeAddress(%q) = %q, %v; want %q, %v", tt.entry, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFetchSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.csv")
+	data := "ip_address,reliability\n" +
+		"9.9.9.9,0.6\n" +
+		"1.1.1.1,0.99\n" +
+		"8.8.8.8,0.2\n" +
+		"2001:4860:4860::8888,0.8\n" +
+		"not-an-ip,1\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(&config.ScannerConfig{MinSourceReliability: 0.5}, nil)
+	for _, src := range []string{path, "file://" + path} {
+		got, err := s.fetchSource(context.Background(), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Most reliable first, unreliable and unparsable entries dropped
+		want := []Candidate{
+			{Address: "1.1.1.1:53", Type: "udp", Source: src},
+			{Address: "[2001:4860:4860::8888]:53", Type: "udp", Source: src},
+			{Address: "9.9.9.9:53", Type: "udp", Source: src},
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", src, got, want)
+		}
+	}
+
+	if _, err := s.fetchSource(context.Background(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("fetched a missing file")
+	}
+}
@@ -0,0 +1,237 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/atomicfile"
+)
+
+// checkpointInterval is how often scan progress is saved.
+const checkpointInterval = 5 * time.Second
+
+// checkpoint is the saved progress of an interrupted ScanFromSources.
+type checkpoint struct {
+	// Key identifies the settings the candidate sequence was built from
+	Key string `json:"key"`
+
+	// Lists identifies the fetched resolver lists and country ranges
+	Lists string `json:"lists"`
+
+	// Seed replays the same country-range sample
+	Seed int64 `json:"seed"`
+
+	// Cached is the responsive cache as it was when the scan started
+	Cached []Candidate `json:"cached,omitempty"`
+
+	// Done is how many leading candidates have been scanned
+	Done int `json:"done"`
+
+	// Working counts the working resolvers found so far
+	Working int `json:"working"`
+
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// scanCall is a running ScanFromSources that later callers wait for.
+type scanCall struct {
+	done    chan struct{}
+	working int
+	err     error
+}
+
+// scanLists are the remote lists a scan draws candidates from.
+type scanLists struct {
+	sources []Candidate
+	v4, v6  []netip.Prefix
+}
+
+// fetchLists fetches the configured resolver sources and, with a country
+// code, the country's IPv4 and IPv6 ranges.
+func (s *Scanner) fetchLists(ctx context.Context) *scanLists {
+	lists := &scanLists{sources: s.fetchSources(ctx)}
+	if s.config.CountryCode == "" {
+		return lists
+	}
+	for _, ipv6 := range []bool{false, true} {
+		if ctx.Err() != nil {
+			break
+		}
+		family := "IPv4"
+		if ipv6 {
+			family = "IPv6"
+		}
+		log.Printf("Fetching %s ranges for country: %s", family, s.config.CountryCode)
+		blocks, err := s.fetchCountryIPRanges(ctx, s.config.CountryCode, ipv6)
+		if err != nil {
+			log.Printf("Failed to fetch country %s ranges: %v", family, err)
+			continue
+		}
+		if ipv6 {
+			lists.v6 = blocks
+		} else {
+			lists.v4 = blocks
+		}
+	}
+	return lists
+}
+
+// hash identifies the list contents, so a checkpoint is only resumed
+// against the lists its candidate positions refer to.
+func (l *scanLists) hash() string {
+	h := sha256.New()
+	for _, c := range l.sources {
+		fmt.Fprintf(h, "%s %s %s\n", c.Address, c.Type, c.Source)
+	}
+	for _, blocks := range [][]netip.Prefix{l.v4, l.v6} {
+		fmt.Fprintf(h, "--\n")
+		for _, b := range blocks {
+			fmt.Fprintf(h, "%s\n", b)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// scanJob is a candidate and its position in the scan.
+type scanJob struct {
+	index     int
+	candidate Candidate
+}
+
+// scanDone is a finished scanJob.
+type scanDone struct {
+	index  int
+	result ScanResult
+}
+
+// scanStream tests candidates from seq on ConcurrentScans workers and
+// records each result in the pool as it arrives. The first skip
+// candidates are consumed without testing. onResult runs on the calling
+// goroutine with each result and the number of leading candidates now
+// finished, which is where a resumed scan picks up. Results cut short by
+// ctx are dropped.
+func (s *Scanner) scanStream(ctx context.Context, seq iter.Seq[Candidate], skip int, onResult func(r ScanResult, done int)) {
+	jobs := make(chan scanJob)
+	results := make(chan scanDone)
+
+	go func() {
+		defer close(jobs)
+		index := 0
+		for c := range seq {
+			if index < skip {
+				index++
+				continue
+			}
+			select {
+			case jobs <- scanJob{index: index, candidate: c}:
+			case <-ctx.Done():
+				return
+			}
+			index++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range max(s.config.ConcurrentScans, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result := s.testResolver(ctx, job.candidate.Address, job.candidate.Type)
+				result.Source = job.candidate.Source
+				if ctx.Err() != nil {
+					continue
+				}
+				results <- scanDone{index: job.index, result: result}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// done is the count of leading candidates finished; finished holds
+	// those completed out of order beyond it
+	done := skip
+	finished := make(map[int]bool)
+	for d := range results {
+		s.record(d.result)
+		finished[d.index] = true
+		for finished[done] {
+			delete(finished, done)
+			done++
+		}
+		onResult(d.result, done)
+	}
+}
+
+// checkpointKey identifies the settings that determine ScanFromSources'
+// candidate sequence.
+func (s *Scanner) checkpointKey(maxCandidates int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %d %+v %q %v %v", s.config.ResolverSources, s.config.CountryCode,
+		maxCandidates, s.config.CIDRSampling, s.family, s.config.CuratedEncrypted, s.config.ProbeEncrypted)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// loadCheckpoint returns the saved progress for key and lists, or nil if
+// there is none or it belongs to different settings or list contents.
+func (s *Scanner) loadCheckpoint(key, lists string) *checkpoint {
+	if s.config.CheckpointFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.config.CheckpointFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read scan checkpoint: %v", err)
+		}
+		return nil
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		log.Printf("Failed to parse scan checkpoint: %v", err)
+		return nil
+	}
+	if cp.Key != key {
+		log.Printf("Scan settings changed since the last checkpoint; starting over")
+		return nil
+	}
+	if cp.Lists != lists {
+		log.Printf("Resolver lists changed since the last checkpoint; starting over")
+		return nil
+	}
+	return &cp
+}
+
+// saveCheckpoint writes scan progress.
+func (s *Scanner) saveCheckpoint(cp *checkpoint) {
+	if s.config.CheckpointFile == "" {
+		return
+	}
+	cp.UpdatedAt = time.Now()
+	if err := atomicfile.WriteJSON(s.config.CheckpointFile, cp); err != nil {
+		log.Printf("Failed to save scan checkpoint: %v", err)
+	}
+}
+
+// clearCheckpoint removes the checkpoint of a completed scan.
+func (s *Scanner) clearCheckpoint() {
+	if s.config.CheckpointFile == "" {
+		return
+	}
+	if err := os.Remove(s.config.CheckpointFile); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove scan checkpoint: %v", err)
+	}
+}
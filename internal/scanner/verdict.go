@@ -0,0 +1,262 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnsmsg"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// Verdict classifies how a resolver treats queries.
+type Verdict string
+
+const (
+	// VerdictClean means answers are well-formed and agree with the control set.
+	VerdictClean Verdict = "clean"
+	// VerdictHijacked means responses are forged: wrong transaction ID or
+	// question, or bogon addresses in the answer.
+	VerdictHijacked Verdict = "hijacked"
+	// VerdictFiltering means the resolver answers honestly but blocks
+	// some of the filter_domains.
+	VerdictFiltering Verdict = "filtering"
+	// VerdictLying means responses are well-formed but false: NXDOMAIN
+	// rewriting or answers that disagree with the control set.
+	VerdictLying Verdict = "lying"
+)
+
+// controlDomain is the name every candidate is asked to resolve.
+const controlDomain = "example.com"
+
+// controlTTL is how long control set answers are reused.
+const controlTTL = time.Hour
+
+// controlRetry is how long to wait before asking the control resolvers
+// again after none of them answered.
+const controlRetry = time.Minute
+
+// errForged marks responses that can't be genuine replies to our query.
+var errForged = errors.New("forged response")
+
+// answer is the outcome of one A query.
+type answer struct {
+	rcode int
+	ips   []netip.Addr
+}
+
+// bogons are ranges a public name never legitimately resolves to.
+// Censors commonly answer with private addresses such as 10.10.34.36.
+var bogons = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/3"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// isBogon reports whether ip is in a bogon range.
+func isBogon(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range bogons {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// query sends an A query for name, once the pacer allows, and checks the
+// response envelope: transaction ID, QR bit and question echo. Envelope
+// failures wrap errForged.
+func (s *Scanner) query(ctx context.Context, address, resolverType, name string) (*answer, error) {
+	if err := s.pacer.wait(ctx, address); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	id := uint16(rand.Uint32())
+	q, err := dnsmsg.NewQuery(id, name, dnsmsg.TypeA, 0)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.exchange(ctx, address, resolverType, q)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := dnsmsg.Parse(response)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", errForged, err)
+	case !m.Response():
+		return nil, fmt.Errorf("%w: not a DNS response", errForged)
+	case m.ID != id:
+		return nil, fmt.Errorf("%w: transaction ID mismatch", errForged)
+	case len(m.Questions) != 1 || !strings.EqualFold(m.Questions[0].Name, name) ||
+		m.Questions[0].Type != dnsmsg.TypeA:
+		return nil, fmt.Errorf("%w: question not echoed", errForged)
+	}
+
+	ans := &answer{rcode: m.Rcode()}
+	for _, rr := range m.Answers {
+		if ip, ok := rr.IP(); ok {
+			ans.ips = append(ans.ips, ip)
+		}
+	}
+	return ans, nil
+}
+
+// classify judges a resolver from its answer for controlDomain, a query
+// for a name that doesn't exist, the control set and the filter domains.
+// Filtering resolvers are still usable; the other failures return an error.
+func (s *Scanner) classify(ctx context.Context, address, resolverType string, ans *answer) (Verdict, []string, error) {
+	switch {
+	case ans.rcode == dnsmsg.RcodeNXDomain:
+		return VerdictLying, nil, fmt.Errorf("NXDOMAIN for %s", controlDomain)
+	case ans.rcode != dnsmsg.RcodeSuccess:
+		return "", nil, fmt.Errorf("query answered with rcode %d", ans.rcode)
+	case len(ans.ips) == 0:
+		return "", nil, fmt.Errorf("no address for %s", controlDomain)
+	}
+	for _, ip := range ans.ips {
+		if isBogon(ip) {
+			return VerdictHijacked, nil, fmt.Errorf("bogon answer %s for %s", ip, controlDomain)
+		}
+	}
+
+	if control := s.controlSet(ctx); len(control) > 0 && !overlaps(ans.ips, control) {
+		return VerdictLying, nil, fmt.Errorf("answer %v disagrees with control set", ans.ips)
+	}
+
+	// A name that doesn't exist must not resolve
+	nx := randomLabel(12) + "." + controlDomain
+	if nxAns, err := s.query(ctx, address, resolverType, nx); errors.Is(err, errForged) {
+		return VerdictHijacked, nil, err
+	} else if err == nil && len(nxAns.ips) > 0 {
+		return VerdictLying, nil, fmt.Errorf("NXDOMAIN rewritten to %s", nxAns.ips[0])
+	}
+
+	var filtered []string
+	for _, domain := range s.config.FilterDomains {
+		if ctx.Err() != nil {
+			break
+		}
+		if s.filters(ctx, address, resolverType, domain) {
+			filtered = append(filtered, domain)
+		}
+	}
+	if len(filtered) > 0 {
+		return VerdictFiltering, filtered, nil
+	}
+	return VerdictClean, nil, nil
+}
+
+// filters reports whether the resolver blocks domain: no answer, an
+// error rcode, a forged response or a bogon address.
+func (s *Scanner) filters(ctx context.Context, address, resolverType, domain string) bool {
+	ans, err := s.query(ctx, address, resolverType, domain)
+	if err != nil || ans.rcode != dnsmsg.RcodeSuccess || len(ans.ips) == 0 {
+		return true
+	}
+	for _, ip := range ans.ips {
+		if isBogon(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// controlSet returns the addresses the control resolvers give for
+// controlDomain, as /24 (IPv4) or /48 (IPv6) prefixes. It is refreshed
+// at most every controlTTL. An empty set disables the comparison; it is
+// not kept, so the control resolvers are asked again after controlRetry.
+func (s *Scanner) controlSet(ctx context.Context) map[netip.Prefix]bool {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	if len(s.config.ControlResolvers) == 0 {
+		return nil
+	}
+	if len(s.control) > 0 && time.Since(s.controlAt) < controlTTL {
+		return s.control
+	}
+	if len(s.control) == 0 && time.Since(s.controlAt) < controlRetry {
+		return nil
+	}
+
+	control := make(map[netip.Prefix]bool)
+	for _, addr := range s.config.ControlResolvers {
+		ans, err := s.query(ctx, addr, resolver.TypeForAddress(addr, "udp"), controlDomain)
+		if err != nil {
+			log.Printf("Control resolver %s failed: %v", addr, err)
+			continue
+		}
+		for _, ip := range ans.ips {
+			if !isBogon(ip) {
+				control[answerPrefix(ip)] = true
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return control
+	}
+	if len(control) == 0 {
+		log.Printf("No control answers for %s; skipping answer comparison for %v", controlDomain, controlRetry)
+	}
+
+	s.control = control
+	s.controlAt = time.Now()
+	return control
+}
+
+// overlaps reports whether any address falls in the control set.
+func overlaps(ips []netip.Addr, control map[netip.Prefix]bool) bool {
+	for _, ip := range ips {
+		if control[answerPrefix(ip)] {
+			return true
+		}
+	}
+	return false
+}
+
+// answerPrefix groups addresses loosely enough to tolerate CDN rotation.
+func answerPrefix(ip netip.Addr) netip.Prefix {
+	ip = ip.Unmap()
+	bits := 24
+	if ip.Is6() {
+		bits = 48
+	}
+	p, _ := ip.Prefix(bits)
+	return p
+}
+
+// randomLabel returns n random lowercase letters and digits.
+func randomLabel(n int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[rand.Intn(len(chars))]
+	}
+	return string(b)
+}
@@ -0,0 +1,310 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnsmsg"
+)
+
+// reply is how a fake resolver answers one name.
+type reply struct {
+	rcode  int
+	ips    []string
+	forged bool // wrong transaction ID
+}
+
+// fakeResolver serves A queries on a local UDP port, answering each name
+// with answers(name), and returns its address.
+func fakeResolver(t *testing.T, answers func(name string) reply) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q, err := dnsmsg.Parse(buf[:n])
+			if err != nil || len(q.Questions) != 1 {
+				continue
+			}
+			name := q.Questions[0].Name
+			r := answers(strings.ToLower(strings.TrimSuffix(name, ".")))
+			resp := &dnsmsg.Message{
+				ID:        q.ID,
+				Flags:     dnsmsg.FlagResponse | dnsmsg.FlagRecursion | dnsmsg.FlagAvailable | uint16(r.rcode),
+				Questions: q.Questions,
+			}
+			if r.forged {
+				resp.ID++
+			}
+			for _, s := range r.ips {
+				ip := netip.MustParseAddr(s)
+				resp.Answers = append(resp.Answers, dnsmsg.RR{
+					Name: name, Type: dnsmsg.TypeA, Class: dnsmsg.ClassINET, TTL: 60, Data: ip.AsSlice(),
+				})
+			}
+			b, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			pc.WriteTo(b, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// honest answers like a clean resolver.
+func honest(name string) reply {
+	switch name {
+	case controlDomain:
+		return reply{ips: []string{"93.184.215.14"}}
+	case "blocked.example":
+		return reply{ips: []string{"151.101.1.1"}}
+	default:
+		return reply{rcode: dnsmsg.RcodeNXDomain}
+	}
+}
+
+// with overrides honest answers for some names; "*" stands for the
+// random names under controlDomain.
+func with(overrides map[string]reply) func(string) reply {
+	return func(name string) reply {
+		if r, ok := overrides[name]; ok {
+			return r
+		}
+		if r, ok := overrides["*"]; ok && strings.HasSuffix(name, "."+controlDomain) {
+			return r
+		}
+		return honest(name)
+	}
+}
+
+func testScanner(control []string, filter []string) *Scanner {
+	return New(&config.ScannerConfig{
+		Timeout:          500 * time.Millisecond,
+		ControlResolvers: control,
+		FilterDomains:    filter,
+	}, nil)
+}
+
+func TestClassify(t *testing.T) {
+	control := fakeResolver(t, func(name string) reply {
+		return reply{ips: []string{"93.184.215.34"}}
+	})
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	tests := []struct {
+		name     string
+		answers  func(string) reply
+		control  []string
+		filter   []string
+		want     Verdict
+		filtered []string
+		wantErr  bool
+	}{
+		{
+			name:    "clean",
+			answers: honest,
+			control: []string{control},
+			filter:  []string{"blocked.example"},
+			want:    VerdictClean,
+		},
+		{
+			name:    "NXDOMAIN for the control domain",
+			answers: with(map[string]reply{controlDomain: {rcode: dnsmsg.RcodeNXDomain}}),
+			want:    VerdictLying,
+			wantErr: true,
+		},
+		{
+			name:    "SERVFAIL",
+			answers: with(map[string]reply{controlDomain: {rcode: dnsmsg.RcodeServFail}}),
+			wantErr: true,
+		},
+		{
+			name:    "no address",
+			answers: with(map[string]reply{controlDomain: {}}),
+			wantErr: true,
+		},
+		{
+			name:    "bogon answer",
+			answers: with(map[string]reply{controlDomain: {ips: []string{"10.10.34.36"}}}),
+			want:    VerdictHijacked,
+			wantErr: true,
+		},
+		{
+			name:    "disagrees with control",
+			answers: with(map[string]reply{controlDomain: {ips: []string{"198.41.0.4"}}}),
+			control: []string{control},
+			want:    VerdictLying,
+			wantErr: true,
+		},
+		{
+			name:    "disagreement ignored without control resolvers",
+			answers: with(map[string]reply{controlDomain: {ips: []string{"198.41.0.4"}}}),
+			want:    VerdictClean,
+		},
+		{
+			name:    "disagreement ignored when control resolvers fail",
+			answers: with(map[string]reply{controlDomain: {ips: []string{"198.41.0.4"}}}),
+			control: []string{silent.LocalAddr().String()},
+			want:    VerdictClean,
+		},
+		{
+			name:    "NXDOMAIN rewriting",
+			answers: with(map[string]reply{"*": {ips: []string{"93.184.215.200"}}}),
+			want:    VerdictLying,
+			wantErr: true,
+		},
+		{
+			name:    "forged NXDOMAIN",
+			answers: with(map[string]reply{"*": {rcode: dnsmsg.RcodeNXDomain, forged: true}}),
+			want:    VerdictHijacked,
+			wantErr: true,
+		},
+		{
+			name:     "filtering with a bogon",
+			answers:  with(map[string]reply{"blocked.example": {ips: []string{"10.10.34.36"}}}),
+			filter:   []string{"blocked.example", "other.example"},
+			want:     VerdictFiltering,
+			filtered: []string{"blocked.example", "other.example"},
+		},
+		{
+			name:     "filtering with an empty answer",
+			answers:  with(map[string]reply{"blocked.example": {}}),
+			filter:   []string{"blocked.example"},
+			want:     VerdictFiltering,
+			filtered: []string{"blocked.example"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testScanner(tt.control, tt.filter)
+			addr := fakeResolver(t, tt.answers)
+			ctx := context.Background()
+
+			ans, err := s.query(ctx, addr, "udp", controlDomain)
+			if err != nil {
+				t.Fatalf("control domain query: %v", err)
+			}
+			verdict, filtered, err := s.classify(ctx, addr, "udp", ans)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+			if verdict != tt.want {
+				t.Errorf("verdict %q, want %q", verdict, tt.want)
+			}
+			if !slices.Equal(filtered, tt.filtered) {
+				t.Errorf("filtered %v, want %v", filtered, tt.filtered)
+			}
+		})
+	}
+}
+
+func TestQueryForged(t *testing.T) {
+	addr := fakeResolver(t, func(name string) reply {
+		return reply{ips: []string{"93.184.215.14"}, forged: true}
+	})
+	_, err := testScanner(nil, nil).query(context.Background(), addr, "udp", controlDomain)
+	if !errors.Is(err, errForged) {
+		t.Errorf("error %v, want a forged response", err)
+	}
+}
+
+func TestControlSetRetry(t *testing.T) {
+	s := testScanner([]string{"192.0.2.1:53"}, nil)
+
+	// A failed lookup is retried after controlRetry, not kept for controlTTL
+	s.control, s.controlAt = map[netip.Prefix]bool{}, time.Now().Add(-2*controlRetry)
+	addr := fakeResolver(t, func(name string) reply { return reply{ips: []string{"93.184.215.34"}} })
+	s.config.ControlResolvers = []string{addr}
+	if got := s.controlSet(context.Background()); len(got) != 1 {
+		t.Fatalf("control set %v after retry, want one prefix", got)
+	}
+
+	// A good set is kept for controlTTL
+	s.config.ControlResolvers = []string{"192.0.2.1:53"}
+	if got := s.controlSet(context.Background()); len(got) != 1 {
+		t.Errorf("control set %v, want the cached prefix", got)
+	}
+
+	// A recent failure skips the comparison without asking again
+	s.control, s.controlAt = map[netip.Prefix]bool{}, time.Now()
+	start := time.Now()
+	if got := s.controlSet(context.Background()); len(got) != 0 {
+		t.Errorf("control set %v, want none", got)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("asked the control resolvers again within controlRetry")
+	}
+}
+
+func TestIsBogon(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.10.34.36", true},
+		{"127.0.0.1", true},
+		{"192.168.1.1", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::ffff:10.0.0.1", true},
+		{"fd00::1", true},
+		{"::1", true},
+		{"93.184.215.14", false},
+		{"1.1.1.1", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := isBogon(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("isBogon(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	control := map[netip.Prefix]bool{
+		answerPrefix(netip.MustParseAddr("93.184.215.14")):    true,
+		answerPrefix(netip.MustParseAddr("2606:2800:21f::1")): true,
+	}
+	tests := []struct {
+		ips  []string
+		want bool
+	}{
+		{[]string{"93.184.215.200"}, true},
+		{[]string{"93.184.216.14"}, false},
+		{[]string{"1.1.1.1", "93.184.215.1"}, true},
+		{[]string{"::ffff:93.184.215.9"}, true},
+		{[]string{"2606:2800:21f:cb07::1"}, true},
+		{[]string{"2606:2800:220::1"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		var ips []netip.Addr
+		for _, s := range tt.ips {
+			ips = append(ips, netip.MustParseAddr(s))
+		}
+		if got := overlaps(ips, control); got != tt.want {
+			t.Errorf("overlaps(%v) = %v, want %v", tt.ips, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/keys"
+)
+
+// EnsureKeys generates the tunnel keypair if neither key file exists (or
+// derives a missing public key), and returns the hex public key.
+func EnsureKeys(cfg *config.ServerConfig) (string, error) {
+	_, privErr := os.Stat(cfg.PrivKeyFile)
+	_, pubErr := os.Stat(cfg.PubKeyFile)
+
+	switch {
+	case privErr == nil && pubErr == nil:
+		// Both present
+	case os.IsNotExist(privErr) && os.IsNotExist(pubErr):
+		log.Printf("[server] Generating keypair: %s, %s", cfg.PrivKeyFile, cfg.PubKeyFile)
+		priv, pub, err := keys.Generate()
+		if err != nil {
+			return "", err
+		}
+		if err := keys.WriteFiles(cfg.PrivKeyFile, cfg.PubKeyFile, priv, pub, false); err != nil {
+			return "", err
+		}
+	case privErr == nil && os.IsNotExist(pubErr):
+		log.Printf("[server] Deriving missing public key %s", cfg.PubKeyFile)
+		priv, err := keys.ReadPrivKeyFile(cfg.PrivKeyFile)
+		if err != nil {
+			return "", err
+		}
+		pub, err := keys.PubKey(priv)
+		if err != nil {
+			return "", err
+		}
+		if err := keys.WritePubKeyFile(cfg.PubKeyFile, pub); err != nil {
+			return "", err
+		}
+	case privErr == nil:
+		return "", fmt.Errorf("checking public key: %w", pubErr)
+	default:
+		return "", fmt.Errorf("private key %s is missing but public key %s exists", cfg.PrivKeyFile, cfg.PubKeyFile)
+	}
+
+	return config.ReadPubKeyFile(cfg.PubKeyFile)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxEndedSessions bounds how many finished sessions are kept for reporting.
+const maxEndedSessions = 256
+
+// dnstt-server log lines that describe the session lifecycle, e.g.
+// "begin session 1a2b3c4d", "end stream 1a2b3c4d:3" and
+// "stream 1a2b3c4d:3 connect upstream: ...".
+var (
+	sessionLineRe = regexp.MustCompile(`\b(begin|end) session ([0-9a-f]{8})\b`)
+	streamLineRe  = regexp.MustCompile(`\b(begin|end) stream ([0-9a-f]{8}):\d+\b`)
+	errorLineRe   = regexp.MustCompile(`\b(?:session|stream) ([0-9a-f]{8})(?::\d+)? .*: `)
+)
+
+// SessionStats holds counters for one dnstt session (one client).
+type SessionStats struct {
+	ID            string    `json:"id"`
+	Started       time.Time `json:"started"`
+	Ended         time.Time `json:"ended,omitzero"`
+	Active        bool      `json:"active"`
+	StreamsOpened int64     `json:"streams_opened"`
+	StreamsActive int64     `json:"streams_active"`
+	Errors        int64     `json:"errors"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// sessionTable tracks sessions reported in dnstt-server's log output.
+type sessionTable struct {
+	mu       sync.RWMutex
+	sessions map[string]*SessionStats
+	ended    []string
+	total    int64
+}
+
+func newSessionTable() *sessionTable {
+	return &sessionTable{sessions: make(map[string]*SessionStats)}
+}
+
+// handleLine updates counters from one log line.
+func (t *sessionTable) handleLine(line string) {
+	now := time.Now()
+
+	if m := sessionLineRe.FindStringSubmatch(line); m != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		s := t.get(m[2], now)
+		if m[1] == "end" && s.Active {
+			s.Active = false
+			s.Ended = now
+			s.StreamsActive = 0
+			t.retire(s.ID)
+		}
+		return
+	}
+
+	if m := streamLineRe.FindStringSubmatch(line); m != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		s := t.get(m[2], now)
+		if m[1] == "begin" {
+			s.StreamsOpened++
+			s.StreamsActive++
+		} else if s.StreamsActive > 0 {
+			s.StreamsActive--
+		}
+		return
+	}
+
+	if m := errorLineRe.FindStringSubmatch(line); m != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.get(m[1], now).Errors++
+	}
+}
+
+// get returns the session with id, creating it if needed. Caller holds mu.
+func (t *sessionTable) get(id string, now time.Time) *SessionStats {
+	s, ok := t.sessions[id]
+	if !ok {
+		s = &SessionStats{ID: id, Started: now, Active: true}
+		t.sessions[id] = s
+		t.total++
+	}
+	s.LastSeen = now
+	return s
+}
+
+// retire records an ended session and drops the oldest ended ones. Caller holds mu.
+func (t *sessionTable) retire(id string) {
+	t.ended = append(t.ended, id)
+	for len(t.ended) > maxEndedSessions {
+		delete(t.sessions, t.ended[0])
+		t.ended = t.ended[1:]
+	}
+}
+
+// endAll marks every active session ended (dnstt-server exited).
+func (t *sessionTable) endAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range t.sessions {
+		if s.Active {
+			s.Active = false
+			s.Ended = now
+			s.StreamsActive = 0
+			t.retire(s.ID)
+		}
+	}
+}
+
+// snapshot returns a copy of all sessions, newest first, plus the active and total counts.
+func (t *sessionTable) snapshot() (sessions []SessionStats, active int, total int64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	sessions = make([]SessionStats, 0, len(t.sessions))
+	for _, s := range t.sessions {
+		sessions = append(sessions, *s)
+		if s.Active {
+			active++
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Started.After(sessions[j].Started)
+	})
+	return sessions, active, t.total
+}
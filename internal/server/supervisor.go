@@ -0,0 +1,176 @@
+// Package server runs the server side of the tunnel: it supervises
+// dnstt-server, manages its keypair and tracks per-session counters.
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/logline"
+)
+
+// Status is a point-in-time view of the supervised dnstt-server.
+type Status struct {
+	Running        bool      `json:"running"`
+	PID            int       `json:"pid,omitempty"`
+	Since          time.Time `json:"since,omitzero"`
+	Restarts       int       `json:"restarts"`
+	LastExit       string    `json:"last_exit,omitempty"`
+	Domain         string    `json:"domain"`
+	Listen         string    `json:"listen"`
+	Upstream       string    `json:"upstream"`
+	PubKey         string    `json:"pubkey"`
+	ActiveSessions int       `json:"active_sessions"`
+	TotalSessions  int64     `json:"total_sessions"`
+}
+
+// Supervisor keeps dnstt-server running and restarts it when it exits.
+type Supervisor struct {
+	config   *config.ServerConfig
+	pubKey   string
+	sessions *sessionTable
+
+	mu       sync.RWMutex
+	cmd      *exec.Cmd
+	since    time.Time
+	restarts int
+	lastExit string
+}
+
+// New creates a Supervisor for the given server configuration and public key.
+func New(cfg *config.ServerConfig, pubKey string) *Supervisor {
+	return &Supervisor{
+		config:   cfg,
+		pubKey:   pubKey,
+		sessions: newSessionTable(),
+	}
+}
+
+// Run starts dnstt-server and restarts it after RestartDelay whenever it
+// exits, until ctx is cancelled.
+func (s *Supervisor) Run(ctx context.Context) error {
+	log.Printf("[server] Public key: %s", s.pubKey)
+
+	for {
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		msg := "exited normally"
+		if err != nil {
+			msg = err.Error()
+		}
+		s.mu.Lock()
+		s.lastExit = msg
+		s.restarts++
+		s.mu.Unlock()
+
+		log.Printf("[server] dnstt-server %s, restarting in %v", msg, s.config.RestartDelay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.config.RestartDelay):
+		}
+	}
+}
+
+// runOnce runs dnstt-server until it exits or ctx is cancelled.
+func (s *Supervisor) runOnce(ctx context.Context) error {
+	args := s.buildArgs()
+	log.Printf("[server] Starting: %s %v", s.config.DnsttServerPath, args)
+
+	stdout := logline.New("dnstt-server stdout", s.sessions.handleLine)
+	stderr := logline.New("dnstt-server stderr", s.sessions.handleLine)
+
+	cmd := exec.Command(s.config.DnsttServerPath, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Don't let a child holding the output pipes block Wait after exit
+	cmd.WaitDelay = 2 * time.Second
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start dnstt-server: %w", err)
+	}
+
+	s.mu.Lock()
+	s.cmd = cmd
+	s.since = time.Now()
+	s.mu.Unlock()
+	log.Printf("[server] Process started with PID: %d", cmd.Process.Pid)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		cmd.Process.Signal(os.Interrupt)
+		select {
+		case err = <-done:
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			err = <-done
+		}
+	}
+	stdout.Flush()
+	stderr.Flush()
+
+	s.mu.Lock()
+	s.cmd = nil
+	s.mu.Unlock()
+	s.sessions.endAll()
+
+	return err
+}
+
+// buildArgs constructs the command line arguments for dnstt-server
+func (s *Supervisor) buildArgs() []string {
+	listen := s.config.Listen
+	if s.config.Echo.Enabled {
+		listen = s.config.Echo.DnsttListen
+	}
+	args := []string{"-udp", listen, "-privkey-file", s.config.PrivKeyFile}
+	if s.config.MTU > 0 {
+		args = append(args, "-mtu", strconv.Itoa(s.config.MTU))
+	}
+	return append(args, s.config.Domain, s.config.Upstream)
+}
+
+// Status returns the current process state and session totals.
+func (s *Supervisor) Status() Status {
+	_, active, total := s.sessions.snapshot()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := Status{
+		Restarts:       s.restarts,
+		LastExit:       s.lastExit,
+		Domain:         s.config.Domain,
+		Listen:         s.config.Listen,
+		Upstream:       s.config.Upstream,
+		PubKey:         s.pubKey,
+		ActiveSessions: active,
+		TotalSessions:  total,
+	}
+	if s.cmd != nil && s.cmd.Process != nil {
+		st.Running = true
+		st.PID = s.cmd.Process.Pid
+		st.Since = s.since
+	}
+	return st
+}
+
+// Sessions returns per-session counters, newest first.
+func (s *Supervisor) Sessions() []SessionStats {
+	sessions, _, _ := s.sessions.snapshot()
+	return sessions
+}
@@ -0,0 +1,112 @@
+package socks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ReplyError is returned by UpstreamDialer when the upstream proxy
+// rejects a request.
+type ReplyError struct {
+	Code byte
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("upstream SOCKS5 reply code %d", e.Code)
+}
+
+// UpstreamDialer dials through a SOCKS5 proxy, typically the one on the
+// server side reached via the tunnel's local address.
+type UpstreamDialer struct {
+	// ProxyAddr returns the current upstream proxy address. It is called
+	// per dial so the tunnel can switch resolvers underneath.
+	ProxyAddr func() string
+
+	// Username and Password authenticate to the upstream proxy (optional)
+	Username string
+	Password string
+}
+
+// DialContext connects to address through the upstream proxy. Only TCP
+// is supported; the tunnel carries a single byte stream, so there is no
+// path for the upstream proxy's UDP relay.
+func (d *UpstreamDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("network %s not supported over the tunnel", network)
+	}
+
+	var nd net.Dialer
+	conn, err := nd.DialContext(ctx, "tcp", d.ProxyAddr())
+	if err != nil {
+		return nil, fmt.Errorf("dialing upstream proxy: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := d.handshake(conn, address); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// handshake negotiates auth and sends a CONNECT request.
+func (d *UpstreamDialer) handshake(conn net.Conn, address string) error {
+	method := byte(methodNoAuth)
+	if d.Username != "" {
+		method = methodUserPass
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return fmt.Errorf("upstream greeting: %w", err)
+	}
+
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return fmt.Errorf("upstream greeting reply: %w", err)
+	}
+	if resp[0] != socksVersion || resp[1] != method {
+		return fmt.Errorf("upstream proxy refused auth method %d", method)
+	}
+
+	if method == methodUserPass {
+		req := []byte{authVersion, byte(len(d.Username))}
+		req = append(req, d.Username...)
+		req = append(req, byte(len(d.Password)))
+		req = append(req, d.Password...)
+		if _, err := conn.Write(req); err != nil {
+			return fmt.Errorf("upstream auth: %w", err)
+		}
+		if _, err := io.ReadFull(conn, resp[:]); err != nil {
+			return fmt.Errorf("upstream auth reply: %w", err)
+		}
+		if resp[1] != 0x00 {
+			return fmt.Errorf("upstream authentication failed")
+		}
+	}
+
+	req, err := appendAddr([]byte{socksVersion, cmdConnect, 0x00}, address)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("upstream connect: %w", err)
+	}
+
+	var hdr [3]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return fmt.Errorf("upstream connect reply: %w", err)
+	}
+	if hdr[1] != repSucceeded {
+		return &ReplyError{Code: hdr[1]}
+	}
+	if _, err := readAddr(conn); err != nil {
+		return fmt.Errorf("upstream bound address: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+// Package socks provides a SOCKS5 proxy server that carries streams over the tunnel.
+package socks
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+)
+
+// Dialer opens outbound connections for proxied requests.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Server is a SOCKS5 server supporting CONNECT and, with a server-side
+// UDP relay, UDP ASSOCIATE, with optional username/password
+// authentication.
+type Server struct {
+	config *config.SOCKSConfig
+	dialer Dialer
+	users  map[string]string
+	stats  *Stats
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates a SOCKS5 server that dials through dialer.
+func New(cfg *config.SOCKSConfig, dialer Dialer) *Server {
+	users := make(map[string]string, len(cfg.Users))
+	for _, u := range cfg.Users {
+		users[u.Username] = u.Password
+	}
+	return &Server{
+		config: cfg,
+		dialer: dialer,
+		users:  users,
+		stats:  newStats(),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Start listens on the configured address and serves until Stop is called.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return fmt.Errorf("socks listen: %w", err)
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+
+	auth := "no auth"
+	if len(s.users) > 0 {
+		auth = fmt.Sprintf("%d users", len(s.users))
+	}
+	log.Printf("[socks] Listening on %s (%s)", ln.Addr(), auth)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			if err := s.handle(conn); err != nil {
+				log.Printf("[socks] %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// Stop closes the listener and all client connections.
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	ln := s.listener
+	s.listener = nil
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	var err error
+	if ln != nil {
+		err = ln.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// Stats returns the per-user traffic counters.
+func (s *Server) Stats() *Stats {
+	return s.stats
+}
+
+// handle serves a single client connection.
+func (s *Server) handle(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(s.config.HandshakeTimeout))
+
+	user, err := s.negotiate(conn)
+	if err != nil {
+		return err
+	}
+
+	var hdr [3]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return fmt.Errorf("reading request: %w", err)
+	}
+	if hdr[0] != socksVersion {
+		return fmt.Errorf("invalid request version: %d", hdr[0])
+	}
+
+	dest, err := readAddr(conn)
+	if err != nil {
+		if errors.Is(err, errAddrType) {
+			writeReply(conn, repAddrTypeNotSupp, nil)
+		}
+		return fmt.Errorf("reading destination: %w", err)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	switch hdr[1] {
+	case cmdConnect:
+		return s.handleConnect(conn, user, dest)
+	case cmdUDPAssociate:
+		return s.handleUDPAssociate(conn, user)
+	default:
+		writeReply(conn, repCommandNotSupp, nil)
+		return fmt.Errorf("unsupported command: %d", hdr[1])
+	}
+}
+
+// negotiate performs method selection and authentication and returns
+// the authenticated username ("" when auth is disabled).
+func (s *Server) negotiate(conn net.Conn) (string, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return "", fmt.Errorf("reading greeting: %w", err)
+	}
+	if hdr[0] != socksVersion {
+		return "", fmt.Errorf("invalid SOCKS version: %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("reading methods: %w", err)
+	}
+
+	want := byte(methodNoAuth)
+	if len(s.users) > 0 {
+		want = methodUserPass
+	}
+	offered := false
+	for _, m := range methods {
+		if m == want {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socksVersion, methodNoAcceptable})
+		return "", fmt.Errorf("no acceptable auth method offered")
+	}
+	if _, err := conn.Write([]byte{socksVersion, want}); err != nil {
+		return "", err
+	}
+
+	if want == methodNoAuth {
+		return "", nil
+	}
+	return s.authenticate(conn)
+}
+
+// authenticate performs RFC 1929 username/password authentication.
+func (s *Server) authenticate(conn net.Conn) (string, error) {
+	var ver [1]byte
+	if _, err := io.ReadFull(conn, ver[:]); err != nil {
+		return "", fmt.Errorf("reading auth: %w", err)
+	}
+	if ver[0] != authVersion {
+		return "", fmt.Errorf("invalid auth version: %d", ver[0])
+	}
+
+	user, err := readString(conn)
+	if err != nil {
+		return "", fmt.Errorf("reading username: %w", err)
+	}
+	pass, err := readString(conn)
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+
+	expected, ok := s.users[user]
+	if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(pass)) != 1 {
+		conn.Write([]byte{authVersion, 0x01})
+		return "", fmt.Errorf("authentication failed for user %q", user)
+	}
+	if _, err := conn.Write([]byte{authVersion, 0x00}); err != nil {
+		return "", err
+	}
+	return user, nil
+}
+
+// handleConnect dials the destination and relays data.
+func (s *Server) handleConnect(conn net.Conn, user, dest string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DialTimeout)
+	upstream, err := s.dialer.DialContext(ctx, "tcp", dest)
+	cancel()
+	if err != nil {
+		writeReply(conn, replyForError(err), nil)
+		return fmt.Errorf("connect %s: %w", dest, err)
+	}
+	defer upstream.Close()
+
+	if err := writeReply(conn, repSucceeded, upstream.LocalAddr()); err != nil {
+		return err
+	}
+
+	counter := s.stats.open(user)
+	defer s.stats.close(counter)
+
+	relay(conn, upstream, counter)
+	return nil
+}
+
+// readString reads a one-byte length-prefixed string.
+func readString(r io.Reader) (string, error) {
+	var l [1]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return "", err
+	}
+	b := make([]byte, l[0])
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// replyForError maps a dial error to a SOCKS reply code.
+func replyForError(err error) byte {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return repConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return repNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return repHostUnreachable
+	case errors.Is(err, context.DeadlineExceeded):
+		return repHostUnreachable
+	}
+	var re *ReplyError
+	if errors.As(err, &re) {
+		return re.Code
+	}
+	return repGeneralFailure
+}
+
+// relay copies data in both directions, counting bytes for the user.
+func relay(client, upstream net.Conn, c *userCounter) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn, n *int64) {
+		io.Copy(&countingWriter{w: dst, n: n}, src)
+		if tc, ok := dst.(interface{ CloseWrite() error }); ok {
+			tc.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go cp(upstream, client, &c.up)
+	go cp(client, upstream, &c.down)
+	<-done
+	<-done
+}
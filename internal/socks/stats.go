@@ -0,0 +1,93 @@
+package socks
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// anonymousUser is the accounting name used when authentication is off.
+const anonymousUser = "anonymous"
+
+// UserStats holds traffic counters for one user.
+type UserStats struct {
+	Username    string `json:"username"`
+	BytesUp     int64  `json:"bytes_up"`
+	BytesDown   int64  `json:"bytes_down"`
+	Connections int64  `json:"connections"`
+	Active      int64  `json:"active"`
+}
+
+// userCounter holds live counters for one user.
+type userCounter struct {
+	up, down    int64
+	connections int64
+	active      int64
+}
+
+// Stats tracks per-user traffic.
+type Stats struct {
+	mu    sync.RWMutex
+	users map[string]*userCounter
+}
+
+// newStats creates an empty Stats.
+func newStats() *Stats {
+	return &Stats{users: make(map[string]*userCounter)}
+}
+
+// open records a new connection for user and returns its counter.
+func (s *Stats) open(user string) *userCounter {
+	if user == "" {
+		user = anonymousUser
+	}
+
+	s.mu.Lock()
+	c, ok := s.users[user]
+	if !ok {
+		c = &userCounter{}
+		s.users[user] = c
+	}
+	s.mu.Unlock()
+
+	atomic.AddInt64(&c.connections, 1)
+	atomic.AddInt64(&c.active, 1)
+	return c
+}
+
+// close records the end of a connection.
+func (s *Stats) close(c *userCounter) {
+	atomic.AddInt64(&c.active, -1)
+}
+
+// Snapshot returns the current counters of all users, sorted by name.
+func (s *Stats) Snapshot() []UserStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]UserStats, 0, len(s.users))
+	for name, c := range s.users {
+		result = append(result, UserStats{
+			Username:    name,
+			BytesUp:     atomic.LoadInt64(&c.up),
+			BytesDown:   atomic.LoadInt64(&c.down),
+			Connections: atomic.LoadInt64(&c.connections),
+			Active:      atomic.LoadInt64(&c.active),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Username < result[j].Username })
+	return result
+}
+
+// countingWriter adds the number of bytes written to n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,155 @@
+package socks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/uot"
+)
+
+// udpAssociation relays datagrams for one UDP ASSOCIATE request. The
+// tunnel only carries streams, so all datagrams travel on one stream to
+// the UDP relay on the server side (`server.udp_relay`), each framed
+// with its destination address.
+type udpAssociation struct {
+	relay    net.PacketConn
+	stream   net.Conn
+	clientIP net.IP
+	counter  *userCounter
+
+	mu         sync.Mutex
+	clientAddr net.Addr
+}
+
+// handleUDPAssociate opens a UDP relay for the client. The association
+// lasts as long as the control connection stays open. Without a
+// configured server-side relay the command is not supported.
+func (s *Server) handleUDPAssociate(conn net.Conn, user string) error {
+	if s.config.UDPRelay == "" {
+		writeReply(conn, repCommandNotSupp, nil)
+		return fmt.Errorf("UDP ASSOCIATE requires socks.udp_relay")
+	}
+
+	host, _, err := net.SplitHostPort(conn.LocalAddr().String())
+	if err != nil {
+		writeReply(conn, repGeneralFailure, nil)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.DialTimeout)
+	stream, err := s.dialer.DialContext(ctx, "tcp", s.config.UDPRelay)
+	cancel()
+	if err != nil {
+		writeReply(conn, replyForError(err), nil)
+		return fmt.Errorf("UDP relay %s: %w", s.config.UDPRelay, err)
+	}
+	defer stream.Close()
+
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		writeReply(conn, repGeneralFailure, nil)
+		return err
+	}
+	defer pc.Close()
+
+	if err := writeReply(conn, repSucceeded, pc.LocalAddr()); err != nil {
+		return err
+	}
+
+	counter := s.stats.open(user)
+	defer s.stats.close(counter)
+
+	a := &udpAssociation{
+		relay:   pc,
+		stream:  stream,
+		counter: counter,
+	}
+	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		a.clientIP = tcp.IP
+	}
+
+	// The association ends when the client closes the control connection
+	// or the relay stream breaks
+	go func() {
+		io.Copy(io.Discard, conn)
+		pc.Close()
+		stream.Close()
+	}()
+	go func() {
+		a.readBack()
+		pc.Close()
+		conn.Close()
+	}()
+
+	a.serve()
+	return nil
+}
+
+// serve reads datagrams from the client and sends them to the relay.
+func (a *udpAssociation) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := a.relay.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		// Only accept datagrams from the client that opened the association
+		if udp, ok := from.(*net.UDPAddr); !ok || (a.clientIP != nil && !udp.IP.Equal(a.clientIP)) {
+			continue
+		}
+
+		// Header: RSV(2) FRAG(1) ATYP DST.ADDR DST.PORT
+		if n < 4 || buf[2] != 0 {
+			continue // fragmentation is not supported
+		}
+		r := bytes.NewReader(buf[3:n])
+		dest, err := readAddr(r)
+		if err != nil {
+			continue
+		}
+		payload := buf[n-r.Len() : n]
+
+		a.mu.Lock()
+		a.clientAddr = from
+		a.mu.Unlock()
+
+		if err := uot.WriteAddrFrame(a.stream, dest, payload); err != nil {
+			log.Printf("[socks] UDP relay to %s: %v", dest, err)
+			return
+		}
+		atomic.AddInt64(&a.counter.up, int64(len(payload)))
+	}
+}
+
+// readBack forwards datagrams from the relay back to the client.
+func (a *udpAssociation) readBack() {
+	buf := make([]byte, uot.MaxDatagram)
+	for {
+		from, p, err := uot.ReadAddrFrame(a.stream, buf)
+		if err != nil {
+			return
+		}
+		pkt, err := appendAddr([]byte{0, 0, 0}, from)
+		if err != nil {
+			continue
+		}
+
+		a.mu.Lock()
+		client := a.clientAddr
+		a.mu.Unlock()
+		if client == nil {
+			continue
+		}
+
+		if _, err := a.relay.WriteTo(append(pkt, p...), client); err == nil {
+			atomic.AddInt64(&a.counter.down, int64(len(p)))
+		}
+	}
+}
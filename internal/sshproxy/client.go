@@ -0,0 +1,266 @@
+// Package sshproxy provides an SSH connection over the tunnel that serves
+// as a dynamic-forward (ssh -D) dialer.
+package sshproxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+)
+
+// TunnelSource is the part of tunnel.Manager the SSH client depends on.
+type TunnelSource interface {
+	LocalAddr() string
+	OnSwitch() <-chan struct{}
+}
+
+// Client keeps an SSH connection open through the tunnel and reconnects
+// whenever it drops or the tunnel switches resolvers.
+type Client struct {
+	config *config.SSHConfig
+	tunnel TunnelSource
+
+	mu     sync.RWMutex
+	client *ssh.Client
+	ready  chan struct{}
+}
+
+// New creates a new SSH Client.
+func New(cfg *config.SSHConfig, tunnelSrc TunnelSource) *Client {
+	return &Client{
+		config: cfg,
+		tunnel: tunnelSrc,
+		ready:  make(chan struct{}),
+	}
+}
+
+// Run maintains the SSH connection until ctx is cancelled.
+func (c *Client) Run(ctx context.Context) error {
+	clientCfg, err := c.clientConfig()
+	if err != nil {
+		return err
+	}
+	switched := c.tunnel.OnSwitch()
+
+	backoff := time.Second
+	for {
+		client, err := c.connect(ctx, clientCfg)
+		if err != nil {
+			log.Printf("[ssh] Connect failed: %v (retry in %v)", err, backoff)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+			continue
+		}
+		backoff = time.Second
+
+		log.Printf("[ssh] Connected to %s@%s", c.config.User, c.tunnel.LocalAddr())
+		c.setClient(client)
+
+		reason := c.waitDisconnect(ctx, client, switched)
+		c.setClient(nil)
+		client.Close()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("[ssh] Connection lost (%s), reconnecting", reason)
+	}
+}
+
+// connect dials the tunnel's local port and performs the SSH handshake.
+func (c *Client) connect(ctx context.Context, clientCfg *ssh.ClientConfig) (*ssh.Client, error) {
+	addr := c.tunnel.LocalAddr()
+
+	dialCtx, cancel := context.WithTimeout(ctx, c.config.ConnectTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing tunnel: %w", err)
+	}
+
+	// The handshake runs over the DNS tunnel and can be slow
+	if deadline, ok := dialCtx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.hostKeyName(addr), clientCfg)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// waitDisconnect blocks until the connection fails, the tunnel switches
+// or ctx is cancelled, and returns the reason.
+func (c *Client) waitDisconnect(ctx context.Context, client *ssh.Client, switched <-chan struct{}) string {
+	closed := make(chan error, 1)
+	go func() { closed <- client.Wait() }()
+
+	var keepalive <-chan time.Time
+	if c.config.KeepAlive > 0 {
+		ticker := time.NewTicker(c.config.KeepAlive)
+		defer ticker.Stop()
+		keepalive = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "shutdown"
+		case err := <-closed:
+			return fmt.Sprintf("closed: %v", err)
+		case <-switched:
+			return "tunnel switched resolver"
+		case <-keepalive:
+			if err := c.sendKeepAlive(client); err != nil {
+				return fmt.Sprintf("keepalive failed: %v", err)
+			}
+		}
+	}
+}
+
+// sendKeepAlive sends an OpenSSH keepalive request with a timeout.
+func (c *Client) sendKeepAlive(client *ssh.Client) error {
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(c.config.ConnectTimeout):
+		return fmt.Errorf("no reply within %v", c.config.ConnectTimeout)
+	}
+}
+
+// setClient swaps the active SSH client and wakes up waiting dialers.
+func (c *Client) setClient(client *ssh.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.client = client
+	if client != nil {
+		close(c.ready)
+	} else {
+		c.ready = make(chan struct{})
+	}
+}
+
+// DialContext opens a connection to address through the SSH server
+// (like a channel opened by ssh -D). It waits for the SSH connection to
+// come up if it is currently reconnecting.
+func (c *Client) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("network %s not supported over SSH", network)
+	}
+
+	for {
+		c.mu.RLock()
+		client, ready := c.client, c.ready
+		c.mu.RUnlock()
+
+		if client != nil {
+			return client.DialContext(ctx, network, address)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("ssh not connected: %w", ctx.Err())
+		case <-ready:
+		}
+	}
+}
+
+// Connected reports whether the SSH connection is currently up.
+func (c *Client) Connected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client != nil
+}
+
+// hostKeyName returns the name used to look up the server's host key.
+func (c *Client) hostKeyName(addr string) string {
+	if c.config.HostKeyAlias != "" {
+		return c.config.HostKeyAlias
+	}
+	return addr
+}
+
+// clientConfig builds the SSH client configuration from key and host key settings.
+func (c *Client) clientConfig() (*ssh.ClientConfig, error) {
+	keyData, err := os.ReadFile(c.config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading ssh key: %w", err)
+	}
+
+	var signer ssh.Signer
+	if c.config.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(c.config.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(keyData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing ssh key %s: %w", c.config.KeyFile, err)
+	}
+
+	hostKeyCallback, err := c.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         c.config.ConnectTimeout,
+	}, nil
+}
+
+// hostKeyCallback pins the server host key by fingerprint and/or a
+// known_hosts file. Both must match when both are configured.
+func (c *Client) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	var fileCallback ssh.HostKeyCallback
+	if c.config.KnownHostsFile != "" {
+		cb, err := knownhosts.New(c.config.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading known_hosts: %w", err)
+		}
+		fileCallback = cb
+	}
+
+	fingerprint := strings.TrimSpace(c.config.HostKeyFingerprint)
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if fingerprint != "" && ssh.FingerprintSHA256(key) != fingerprint {
+			return fmt.Errorf("host key fingerprint %s does not match pinned %s",
+				ssh.FingerprintSHA256(key), fingerprint)
+		}
+		if fileCallback != nil {
+			return fileCallback(hostname, remote, key)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,183 @@
+package tunnel
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// pathStats tracks traffic carried by one bonded session
+type pathStats struct {
+	streams   int           // currently open connections
+	total     int           // connections handled
+	failures  int           // connections that could not be dialed
+	bytes     int64         // bytes moved by finished connections
+	busy      time.Duration // summed lifetime of finished connections
+	lastError time.Time
+}
+
+// throughput returns the average bytes per second of finished connections
+func (p *pathStats) throughput() float64 {
+	if p.busy <= 0 {
+		return 0
+	}
+	return float64(p.bytes) / p.busy.Seconds()
+}
+
+// bondStats holds per-session stats for bonded mode
+type bondStats struct {
+	mu    sync.Mutex
+	paths map[Session]*pathStats
+}
+
+// get returns the stats for s, creating them if needed. Caller must hold mu.
+func (b *bondStats) get(s Session) *pathStats {
+	if b.paths == nil {
+		b.paths = make(map[Session]*pathStats)
+	}
+	p, ok := b.paths[s]
+	if !ok {
+		p = &pathStats{}
+		b.paths[s] = p
+	}
+	return p
+}
+
+// forget drops the stats of a session that ended
+func (b *bondStats) forget(s Session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.paths, s)
+}
+
+// pathWeight scores a session for new connections. Low resolver latency
+// and high measured throughput raise the weight; open streams and
+// recent dial failures lower it so load spreads across paths.
+func pathWeight(latency time.Duration, p *pathStats) float64 {
+	ms := float64(latency.Milliseconds())
+	if ms <= 0 {
+		ms = 500 // unmeasured: assume a typical slow resolver
+	}
+	w := 1000 / (ms + 50)
+
+	// Throughput in KB/s; unmeasured paths get a neutral bonus so they
+	// receive traffic and build up stats
+	kbps := p.throughput() / 1024
+	if p.bytes == 0 {
+		kbps = 1
+	}
+	w *= 1 + kbps
+
+	w /= float64(1 + p.streams)
+	if !p.lastError.IsZero() && time.Since(p.lastError) < 30*time.Second {
+		w /= 4
+	}
+	return w
+}
+
+// bondRoute spreads new connections across the active and standby
+// sessions by weighted random choice
+func (m *Manager) bondRoute() (string, func(int64, time.Duration, error)) {
+	m.mu.RLock()
+	candidates := make([]Session, 0, len(m.standby)+1)
+	if m.session != nil && m.session.Alive() {
+		candidates = append(candidates, m.session)
+	}
+	for _, s := range m.standby {
+		if s.Alive() {
+			candidates = append(candidates, s)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	m.bond.mu.Lock()
+	weights := make([]float64, len(candidates))
+	var sum float64
+	for i, s := range candidates {
+		latency := time.Duration(0)
+		if r, ok := m.pool.Find(s.Resolver().Address); ok {
+			latency = r.Latency
+		}
+		weights[i] = pathWeight(latency, m.bond.get(s))
+		sum += weights[i]
+	}
+
+	chosen := candidates[len(candidates)-1]
+	pick := rand.Float64() * sum
+	for i, w := range weights {
+		if pick < w {
+			chosen = candidates[i]
+			break
+		}
+		pick -= w
+	}
+
+	p := m.bond.get(chosen)
+	p.streams++
+	p.total++
+	m.bond.mu.Unlock()
+
+	untrack := m.trackConn(chosen)
+	done := func(n int64, elapsed time.Duration, err error) {
+		untrack(n, elapsed, err)
+
+		m.bond.mu.Lock()
+		defer m.bond.mu.Unlock()
+		p.streams--
+		if err != nil {
+			p.failures++
+			p.lastError = time.Now()
+			return
+		}
+		p.bytes += n
+		p.busy += elapsed
+	}
+	return chosen.LocalAddr(), done
+}
+
+// PathInfo describes one session carrying bonded traffic.
+type PathInfo struct {
+	Resolver   string  `json:"resolver"`
+	LocalAddr  string  `json:"local_addr"`
+	Active     bool    `json:"active"`
+	Streams    int     `json:"streams"`
+	Total      int     `json:"total"`
+	Failures   int     `json:"failures"`
+	Bytes      int64   `json:"bytes"`
+	Throughput float64 `json:"throughput_bps"`
+}
+
+// Paths returns the running sessions and the traffic they have carried
+func (m *Manager) Paths() []PathInfo {
+	m.mu.RLock()
+	sessions := make([]Session, 0, len(m.standby)+1)
+	if m.session != nil {
+		sessions = append(sessions, m.session)
+	}
+	sessions = append(sessions, m.standby...)
+	active := m.session
+	m.mu.RUnlock()
+
+	m.bond.mu.Lock()
+	defer m.bond.mu.Unlock()
+
+	result := make([]PathInfo, 0, len(sessions))
+	for _, s := range sessions {
+		p := m.bond.get(s)
+		result = append(result, PathInfo{
+			Resolver:   s.Resolver().Address,
+			LocalAddr:  s.LocalAddr(),
+			Active:     s == active,
+			Streams:    p.streams,
+			Total:      p.total,
+			Failures:   p.failures,
+			Bytes:      p.bytes,
+			Throughput: p.throughput(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,380 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/dnstt"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/fingerprint"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// handshakeTimeout bounds the Noise handshake of an embedded tunnel
+// session, and how long a connection waits for a replacement session
+const handshakeTimeout = 30 * time.Second
+
+// embeddedTransport runs the dnstt client in-process
+type embeddedTransport struct {
+	config *config.TunnelConfig
+}
+
+// Name returns the transport mode name
+func (t *embeddedTransport) Name() string {
+	return config.TunnelModeEmbedded
+}
+
+// Start listens on localAddr and begins a tunnel session through r
+func (t *embeddedTransport) Start(r *resolver.Resolver, localAddr string) (Session, error) {
+	pubKey, err := hex.DecodeString(t.config.PubKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding pubkey: %w", err)
+	}
+	fingerprints, err := fingerprint.Parse(t.config.UTLSFingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	address := r.Address
+	switch resolverType(r) {
+	case "doh":
+		address = dohURL(r.Address)
+	case "dot":
+		address = resolver.HostPort(r.Address, "853")
+	case "udp":
+		address = resolver.HostPort(r.Address, "53")
+	default:
+		return nil, fmt.Errorf("unsupported resolver type %q for %s", r.Type, r.Address)
+	}
+
+	ln, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("opening local listener: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &embeddedSession{
+		resolver:  &resolver.Resolver{Address: r.Address, Type: resolverType(r), ServerName: r.ServerName},
+		localAddr: localAddr,
+		listener:  ln,
+		ctx:       ctx,
+		cancel:    cancel,
+		up:        make(chan struct{}),
+		ready:     make(chan struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		done:      make(chan struct{}),
+		events:    make(chan Event, 64),
+	}
+	s.config = dnstt.Config{
+		Domain:        t.config.Domain,
+		PubKey:        pubKey,
+		Resolver:      address,
+		Type:          resolverType(r),
+		ServerName:    r.ServerName,
+		Fingerprint:   fingerprints.Pick(),
+		IdleTimeout:   t.config.IdleTimeout,
+		OnDecodeError: s.decodeError,
+		OnQueryError:  s.queryError,
+	}
+
+	log.Printf("[tunnel] Starting embedded session via %s (%s) on %s", r.Address, s.config.Type, localAddr)
+	s.emit(Event{Type: EventSessionStarted, Resolver: r.Address})
+
+	s.handlers.Add(1)
+	go s.accept()
+	go s.run()
+
+	return s, nil
+}
+
+// embeddedSession is an in-process dnstt client. It keeps one tunnel
+// session (KCP, Noise and smux) up at a time, replacing it when it ends,
+// and forwards connections on its listener as smux streams.
+type embeddedSession struct {
+	config    dnstt.Config
+	resolver  *resolver.Resolver
+	localAddr string
+	listener  net.Listener
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	tunnel *dnstt.Session        // nil between tunnel sessions
+	up     chan struct{}         // closed when the next tunnel session is up
+	conns  map[net.Conn]struct{} // local connections being forwarded
+	ended  bool                  // no more connections are accepted
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	handlers  sync.WaitGroup
+	done      chan struct{}
+
+	// events is closed under eventsMu; resolver transport callbacks may
+	// still report errors after the session ended
+	eventsMu     sync.RWMutex
+	events       chan Event
+	eventsClosed bool
+}
+
+// run keeps a tunnel session up until the session is stopped or a
+// replacement can't be established
+func (s *embeddedSession) run() {
+	var err error
+	for {
+		var t *dnstt.Session
+		if t, err = s.connect(); err != nil {
+			break
+		}
+
+		s.mu.Lock()
+		s.tunnel = t
+		close(s.up)
+		s.up = make(chan struct{})
+		s.mu.Unlock()
+		s.readyOnce.Do(func() { close(s.ready) })
+
+		select {
+		case <-t.CloseChan():
+		case <-s.ctx.Done():
+		}
+
+		s.mu.Lock()
+		s.tunnel = nil
+		s.mu.Unlock()
+		t.Close()
+
+		msg := fmt.Sprintf("end session %08x", t.Conv())
+		log.Printf("[tunnel] Embedded %s", msg)
+		s.emit(Event{Type: EventTunnelSessionEnded, Resolver: s.resolver.Address, Message: msg})
+
+		if s.ctx.Err() != nil {
+			break
+		}
+	}
+	s.finish(err)
+}
+
+// connect opens a tunnel session and completes its handshake
+func (s *embeddedSession) connect() (*dnstt.Session, error) {
+	t, err := dnstt.NewSession(s.config)
+	if err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("begin session %08x", t.Conv())
+	log.Printf("[tunnel] Embedded %s", msg)
+	s.emit(Event{Type: EventTunnelSessionBegan, Resolver: s.resolver.Address, Message: msg})
+
+	ctx, cancel := context.WithTimeout(s.ctx, handshakeTimeout)
+	defer cancel()
+	if err := t.Handshake(ctx); err != nil {
+		t.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.emit(Event{Type: EventTimeout, Resolver: s.resolver.Address, Message: err.Error()})
+		}
+		msg := fmt.Sprintf("end session %08x", t.Conv())
+		s.emit(Event{Type: EventTunnelSessionEnded, Resolver: s.resolver.Address, Message: msg})
+		return nil, fmt.Errorf("session %08x: %w", t.Conv(), err)
+	}
+
+	msg = fmt.Sprintf("session %08x handshake done", t.Conv())
+	log.Printf("[tunnel] Embedded %s via %s", msg, s.resolver.Address)
+	s.emit(Event{Type: EventHandshakeDone, Resolver: s.resolver.Address, Message: msg})
+	return t, nil
+}
+
+// finish stops accepting, closes forwarded connections and ends the
+// session once every handler has returned
+func (s *embeddedSession) finish(err error) {
+	s.cancel()
+	s.listener.Close()
+
+	s.mu.Lock()
+	s.ended = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.handlers.Wait()
+
+	msg := "stopped"
+	if err != nil {
+		msg = err.Error()
+		log.Printf("[tunnel] Embedded session via %s ended: %v", s.resolver.Address, err)
+	} else {
+		log.Printf("[tunnel] Embedded session via %s stopped", s.resolver.Address)
+	}
+	s.emit(Event{Type: EventSessionEnded, Resolver: s.resolver.Address, Message: msg})
+
+	close(s.done)
+	s.eventsMu.Lock()
+	s.eventsClosed = true
+	close(s.events)
+	s.eventsMu.Unlock()
+}
+
+// emit delivers an event unless the events channel is closed
+func (s *embeddedSession) emit(ev Event) {
+	s.eventsMu.RLock()
+	defer s.eventsMu.RUnlock()
+	if !s.eventsClosed {
+		sendEvent(s.events, ev)
+	}
+}
+
+// accept forwards each local connection on its own goroutine
+func (s *embeddedSession) accept() {
+	defer s.handlers.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.ended {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.handlers.Add(1)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// handle forwards one local connection over a new smux stream
+func (s *embeddedSession) handle(local net.Conn) {
+	defer s.handlers.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, local)
+		s.mu.Unlock()
+		local.Close()
+	}()
+
+	t, err := s.currentTunnel()
+	if err != nil {
+		log.Printf("[tunnel] Embedded session via %s: %v", s.resolver.Address, err)
+		return
+	}
+	stream, err := t.OpenStream()
+	if err != nil {
+		s.emit(Event{
+			Type:     EventQueryError,
+			Resolver: s.resolver.Address,
+			Message:  fmt.Sprintf("session %08x opening stream: %v", t.Conv(), err),
+		})
+		return
+	}
+	id := fmt.Sprintf("%08x:%d", t.Conv(), stream.ID())
+	s.emit(Event{Type: EventStreamOpened, Resolver: s.resolver.Address, Message: "begin stream " + id})
+
+	// As in dnstt-client: local EOF closes the stream, stream EOF
+	// half-closes the local connection
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(stream, local)
+		stream.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(local, stream)
+		if tc, ok := local.(*net.TCPConn); ok {
+			_ = tc.CloseWrite()
+		}
+	}()
+	wg.Wait()
+	stream.Close()
+
+	s.emit(Event{Type: EventStreamClosed, Resolver: s.resolver.Address, Message: "end stream " + id})
+}
+
+// currentTunnel returns the live tunnel session, waiting for run to
+// replace one that ended
+func (s *embeddedSession) currentTunnel() (*dnstt.Session, error) {
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+	for {
+		s.mu.Lock()
+		t, up := s.tunnel, s.up
+		s.mu.Unlock()
+		if t != nil && !t.IsClosed() {
+			return t, nil
+		}
+		select {
+		case <-up:
+		case <-s.ctx.Done():
+			return nil, errors.New("session ended")
+		case <-timeout.C:
+			return nil, errors.New("no tunnel session within the handshake timeout")
+		}
+	}
+}
+
+// decodeError reports a resolver response that could not be decoded
+func (s *embeddedSession) decodeError(err error) {
+	s.emit(Event{Type: EventDecodeError, Resolver: s.resolver.Address, Message: err.Error()})
+}
+
+// queryError reports a failed query, as a timeout when it is one
+func (s *embeddedSession) queryError(err error) {
+	evType := EventQueryError
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() || isTimeoutText(err.Error()) {
+		evType = EventTimeout
+	}
+	s.emit(Event{Type: evType, Resolver: s.resolver.Address, Message: err.Error()})
+}
+
+// Resolver returns the resolver this session tunnels through
+func (s *embeddedSession) Resolver() *resolver.Resolver {
+	r := *s.resolver
+	return &r
+}
+
+// LocalAddr returns the local listen address
+func (s *embeddedSession) LocalAddr() string {
+	return s.localAddr
+}
+
+// Alive reports whether the session is still running
+func (s *embeddedSession) Alive() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Ready is closed once the first tunnel session completed its handshake
+func (s *embeddedSession) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed when the session has ended
+func (s *embeddedSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Events delivers session events
+func (s *embeddedSession) Events() <-chan Event {
+	return s.events
+}
+
+// Stop ends the session and waits for it to finish
+func (s *embeddedSession) Stop() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
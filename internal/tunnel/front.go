@@ -0,0 +1,106 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// frontProxy listens on the public local address and forwards each
+// accepted connection to the session chosen at accept time.
+// Switching sessions only affects new connections.
+type frontProxy struct {
+	listener net.Listener
+	target   routeFunc
+
+	wg sync.WaitGroup
+}
+
+// routeFunc picks the session address for a new connection ("" if none).
+// The optional done callback is invoked when the connection ends with the
+// number of bytes moved, how long it lasted and any dial error.
+type routeFunc func() (addr string, done func(bytes int64, elapsed time.Duration, err error))
+
+// newFrontProxy starts listening on addr. target is called for every new
+// connection to choose the session it is forwarded to.
+func newFrontProxy(addr string, target routeFunc) (*frontProxy, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("front listener on %s: %w", addr, err)
+	}
+
+	f := &frontProxy{listener: ln, target: target}
+	f.wg.Add(1)
+	go f.serve()
+
+	log.Printf("[tunnel] Front listener on %s", addr)
+	return f, nil
+}
+
+// serve accepts connections until the listener is closed
+func (f *frontProxy) serve() {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+// handle forwards one client connection to the active session
+func (f *frontProxy) handle(conn net.Conn) {
+	defer conn.Close()
+
+	target, done := f.target()
+	if target == "" {
+		return
+	}
+
+	start := time.Now()
+	upstream, err := net.DialTimeout("tcp", target, 5*time.Second)
+	if err != nil {
+		log.Printf("[tunnel] Front: dial %s failed: %v", target, err)
+		if done != nil {
+			done(0, time.Since(start), err)
+		}
+		return
+	}
+	defer upstream.Close()
+
+	n := pipe(conn, upstream)
+	if done != nil {
+		done(n, time.Since(start), nil)
+	}
+}
+
+// Close stops accepting new connections
+func (f *frontProxy) Close() error {
+	err := f.listener.Close()
+	f.wg.Wait()
+	return err
+}
+
+// pipe copies data in both directions until both sides close and
+// returns the total number of bytes moved
+func pipe(a, b net.Conn) int64 {
+	done := make(chan int64, 2)
+	cp := func(dst, src net.Conn) {
+		n, _ := io.Copy(dst, src)
+		if tc, ok := dst.(*net.TCPConn); ok {
+			_ = tc.CloseWrite()
+		}
+		done <- n
+	}
+	go cp(a, b)
+	go cp(b, a)
+	return <-done + <-done
+}
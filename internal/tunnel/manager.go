@@ -7,8 +7,6 @@ import (
 	"log"
 	"net"
 	"os"
-	"os/exec"
-	"runtime"
 	"sync"
 	"time"
 
@@ -16,17 +14,36 @@ import (
 	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
 )
 
-// Manager manages the dnstt-client subprocess
+// Manager manages the dnstt client session
 type Manager struct {
-	config     *config.TunnelConfig
-	pool       *resolver.Pool
-	cmd        *exec.Cmd
-	cancel     context.CancelFunc
-	mu         sync.RWMutex
-	resolverIP string
+	config    *config.TunnelConfig
+	pool      *resolver.Pool
+	transport Transport
+	session   Session
+	mu        sync.RWMutex
+
+	// active mirrors session under its own lock, for readers that must
+	// not wait while Connect holds mu through a handshake
+	activeMu sync.RWMutex
+	active   Session
+
+	// Hot-standby sessions (only when config.Standby > 0), and those
+	// still starting by resolver address
+	standby []Session
+	pending map[string]*pendingStandby
+	front   *frontProxy
+	bond    bondStats
+
+	// Front connections per session, and sessions replaced by failover
+	// that are stopped once idle
+	drainMu  sync.Mutex
+	conns    map[Session]int
+	draining map[Session]*time.Timer
 
 	// Event channels
 	disconnectCh chan struct{}
+	eventCh      chan Event
+	switchSubs   []chan struct{}
 }
 
 // New creates a new tunnel Manager
@@ -34,7 +51,9 @@ func New(cfg *config.TunnelConfig, pool *resolver.Pool) *Manager {
 	return &Manager{
 		config:       cfg,
 		pool:         pool,
+		transport:    newTransport(cfg),
 		disconnectCh: make(chan struct{}, 1),
+		eventCh:      make(chan Event, 64),
 	}
 }
 
@@ -43,116 +62,120 @@ func (m *Manager) Connect(r *resolver.Resolver) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.cmd != nil && m.isProcessRunning() {
+	if m.session != nil || len(m.standby) > 0 {
 		// Stop existing tunnel first
 		m.stopInternal()
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	m.cancel = cancel
-
-	// Build command arguments
-	args := m.buildArgs(r.Address)
-
-	log.Printf("[tunnel] Starting: %s %v", m.config.DnsttPath, args)
+	// With standby sessions the front proxy owns LocalAddr and every
+	// session listens on an internal port
+	listenAddr := m.config.LocalAddr
+	if m.standbyEnabled() {
+		if err := m.ensureFront(); err != nil {
+			return err
+		}
+		addr, err := m.freeSessionAddr()
+		if err != nil {
+			return err
+		}
+		listenAddr = addr
+	}
 
-	m.cmd = exec.CommandContext(ctx, m.config.DnsttPath, args...)
-	m.cmd.Stdout = os.Stdout
-	m.cmd.Stderr = os.Stderr
+	session, err := m.transport.Start(r, listenAddr)
+	if err != nil {
+		return err
+	}
 
-	// Set process group for proper cleanup
-	setProcAttr(m.cmd)
+	// Forward session events and report unexpected exits
+	go m.watchSession(session)
 
-	if err := m.cmd.Start(); err != nil {
-		m.cancel = nil
-		m.cmd = nil
-		return fmt.Errorf("failed to start dnstt-client: %w", err)
+	// Only a ready session becomes current; until then the front proxy,
+	// fillStandby and the health monitor see no session
+	if err := waitReady(session); err != nil {
+		_ = session.Stop()
+		return err
 	}
+	m.setSession(session)
 
-	m.resolverIP = r.Address
-	log.Printf("[tunnel] Process started with PID: %d", m.cmd.Process.Pid)
+	if m.standbyEnabled() {
+		go m.fillStandby()
+	}
 
-	// Start goroutine to wait for process completion
-	go func() {
-		err := m.cmd.Wait()
-		if err != nil {
-			log.Printf("[tunnel] Process exited with error: %v", err)
-		} else {
-			log.Printf("[tunnel] Process exited normally")
-		}
-		// Notify disconnect
-		select {
-		case m.disconnectCh <- struct{}{}:
-		default:
-		}
-	}()
+	m.notifySwitch()
+	return nil
+}
 
-	// Wait for port to become available
-	localPort := 7000
-	if m.config.LocalAddr != "" {
-		fmt.Sscanf(m.config.LocalAddr, "127.0.0.1:%d", &localPort)
+// waitReady waits for a new session's tunnel to come up. Sessions that
+// report readiness are waited on until the handshake completes or the
+// session ends; others by polling their local port.
+func waitReady(session Session) error {
+	rs, ok := session.(readySession)
+	if !ok {
+		return waitForPort(session)
 	}
+	log.Printf("[tunnel] Waiting for handshake via %s...", session.Resolver().Address)
+	start := time.Now()
+	select {
+	case <-rs.Ready():
+		log.Printf("[tunnel] Tunnel via %s is up (after %dms)", session.Resolver().Address, time.Since(start).Milliseconds())
+		return nil
+	case <-session.Done():
+		return fmt.Errorf("tunnel session via %s ended before its handshake", session.Resolver().Address)
+	}
+}
 
-	addr := fmt.Sprintf("127.0.0.1:%d", localPort)
-	log.Printf("[tunnel] Waiting for port %d to open...", localPort)
+// waitForPort waits up to 10 seconds for the session's local port to open
+func waitForPort(session Session) error {
+	addr := session.LocalAddr()
+	log.Printf("[tunnel] Waiting for %s to open...", addr)
 
-	portOpen := false
 	for i := 0; i < 20; i++ { // 20 * 500ms = 10 seconds max
 		time.Sleep(500 * time.Millisecond)
 
-		if !m.isProcessRunning() {
+		if !session.Alive() {
 			return fmt.Errorf("dnstt-client exited unexpectedly")
 		}
 
 		conn, err := net.DialTimeout("tcp", addr, 1*time.Second)
 		if err == nil {
 			conn.Close()
-			portOpen = true
-			log.Printf("[tunnel] Port %d is now open (after %dms)", localPort, (i+1)*500)
-			break
+			log.Printf("[tunnel] %s is now open (after %dms)", addr, (i+1)*500)
+			return nil
 		}
 	}
 
-	if !portOpen {
-		log.Printf("[tunnel] WARNING: Port %d never opened, but process is running", localPort)
-	}
-
+	log.Printf("[tunnel] WARNING: %s never opened, but process is running", addr)
 	return nil
 }
 
-// buildArgs constructs the command line arguments for dnstt-client
-func (m *Manager) buildArgs(resolverAddr string) []string {
-	args := []string{}
-
-	// Add resolver (UDP mode)
-	if !hasPort(resolverAddr) {
-		resolverAddr = resolverAddr + ":53"
+// watchSession forwards events from a session until it ends
+func (m *Manager) watchSession(s Session) {
+	for ev := range s.Events() {
+		sendEvent(m.eventCh, ev)
 	}
-	args = append(args, "-udp", resolverAddr)
-
-	// Add public key
-	args = append(args, "-pubkey", m.config.PubKey)
+	m.bond.forget(s)
+	m.forgetConns(s)
 
-	// Add domain
-	args = append(args, m.config.Domain)
+	m.mu.Lock()
+	active := m.session == s
+	wasStandby := m.removeStandby(s)
+	m.mu.Unlock()
 
-	// Add local listener
-	args = append(args, m.config.LocalAddr)
+	if wasStandby {
+		m.handleStandbyExit(s)
+		return
+	}
 
-	return args
-}
+	// Don't report sessions we stopped on purpose (reconnect, key reload)
+	if !active {
+		return
+	}
 
-// hasPort checks if address includes a port
-func hasPort(addr string) bool {
-	for i := len(addr) - 1; i >= 0; i-- {
-		if addr[i] == ':' {
-			return true
-		}
-		if addr[i] == '.' {
-			return false
-		}
+	// Notify disconnect
+	select {
+	case m.disconnectCh <- struct{}{}:
+	default:
 	}
-	return false
 }
 
 // Disconnect stops the tunnel
@@ -162,104 +185,175 @@ func (m *Manager) Disconnect() error {
 	return m.stopInternal()
 }
 
-// stopInternal stops the process without locking
+// stopInternal stops the active, standby and draining sessions without
+// locking
 func (m *Manager) stopInternal() error {
-	if m.cancel != nil {
-		m.cancel()
-		m.cancel = nil
-	}
+	m.stopDraining()
 
-	if m.cmd == nil || m.cmd.Process == nil {
-		return nil
+	standby := m.standby
+	m.standby = nil
+	for _, s := range standby {
+		_ = s.Stop()
 	}
-
-	if err := terminateProcess(m.cmd); err != nil {
-		return fmt.Errorf("failed to terminate process: %w", err)
+	pending := m.pending
+	m.pending = nil
+	for _, p := range pending {
+		if p.session != nil {
+			_ = p.session.Stop()
+		}
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		done <- m.cmd.Wait()
-	}()
-
-	select {
-	case <-done:
-	case <-time.After(5 * time.Second):
-		_ = m.cmd.Process.Kill()
+	if m.session == nil {
+		return nil
 	}
 
-	m.cmd = nil
-	m.resolverIP = ""
-	return nil
+	session := m.session
+	m.setSession(nil)
+	return session.Stop()
 }
 
-// IsConnected checks if the tunnel is running
-func (m *Manager) IsConnected() bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.isProcessRunning()
+// setSession makes s the active session. Caller must hold m.mu.
+func (m *Manager) setSession(s Session) {
+	m.session = s
+	m.activeMu.Lock()
+	m.active = s
+	m.activeMu.Unlock()
 }
 
-// isProcessRunning checks process status without locking
-func (m *Manager) isProcessRunning() bool {
-	if m.cmd == nil || m.cmd.Process == nil {
-		return false
-	}
-	if m.cmd.ProcessState != nil {
-		return false
-	}
-	return checkProcessAlive(m.cmd.Process.Pid)
+// IsConnected checks if the tunnel is running
+func (m *Manager) IsConnected() bool {
+	m.activeMu.RLock()
+	defer m.activeMu.RUnlock()
+	return m.active != nil && m.active.Alive()
 }
 
 // CurrentResolver returns the current resolver
 func (m *Manager) CurrentResolver() *resolver.Resolver {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if m.resolverIP == "" {
+	m.activeMu.RLock()
+	defer m.activeMu.RUnlock()
+	if m.active == nil {
 		return nil
 	}
-	return &resolver.Resolver{Address: m.resolverIP, Type: "udp"}
+	return m.active.Resolver()
 }
 
 // LocalAddr returns the local SOCKS proxy address
 func (m *Manager) LocalAddr() string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
 	return m.config.LocalAddr
 }
 
-// OnDisconnect returns a channel that receives when tunnel disconnects
-func (m *Manager) OnDisconnect() <-chan struct{} {
-	return m.disconnectCh
+// Mode returns the name of the transport running the tunnel
+func (m *Manager) Mode() string {
+	return m.transport.Name()
 }
 
-// Shutdown gracefully shuts down the tunnel
-func (m *Manager) Shutdown() error {
-	return m.Disconnect()
+// WatchPubKey polls the configured pubkey file and restarts the tunnel
+// with the new key when it changes. Blocks until ctx is cancelled.
+func (m *Manager) WatchPubKey(ctx context.Context, interval time.Duration) {
+	path := m.config.PubKeyFile
+	if path == "" || interval <= 0 {
+		return
+	}
+
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Printf("[tunnel] Cannot stat pubkey file: %v", err)
+				continue
+			}
+			if info.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+
+			if err := m.reloadPubKey(); err != nil {
+				log.Printf("[tunnel] Pubkey reload failed, keeping current key: %v", err)
+			}
+		}
+	}
 }
 
-// terminateProcess attempts graceful termination
-func terminateProcess(cmd *exec.Cmd) error {
-	if cmd.Process == nil {
+// reloadPubKey reads the pubkey file and reconnects if the key changed
+func (m *Manager) reloadPubKey() error {
+	key, err := config.ReadPubKeyFile(m.config.PubKeyFile)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if key == m.config.PubKey {
+		m.mu.Unlock()
 		return nil
 	}
-	if runtime.GOOS == "windows" {
-		return cmd.Process.Kill()
+	m.config.PubKey = key
+	var current *resolver.Resolver
+	if m.session != nil {
+		current = m.session.Resolver()
 	}
-	return cmd.Process.Signal(os.Interrupt)
+	m.mu.Unlock()
+
+	log.Printf("[tunnel] Server public key changed, reloaded from %s", m.config.PubKeyFile)
+
+	if current == nil {
+		return nil
+	}
+	return m.Connect(current)
 }
 
-// checkProcessAlive checks if a process is running
-func checkProcessAlive(pid int) bool {
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		return false
+// OnDisconnect returns a channel that receives when tunnel disconnects
+func (m *Manager) OnDisconnect() <-chan struct{} {
+	return m.disconnectCh
+}
+
+// OnSwitch returns a new channel that receives whenever the active
+// session changes (connect, reconnect or failover). Components holding
+// long-lived connections through the tunnel use it to re-establish them.
+func (m *Manager) OnSwitch() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	m.switchSubs = append(m.switchSubs, ch)
+	return ch
+}
+
+// notifySwitch signals all OnSwitch subscribers. Caller must hold m.mu.
+func (m *Manager) notifySwitch() {
+	for _, ch := range m.switchSubs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
 	}
+}
+
+// Events returns a channel that receives events from the running session
+func (m *Manager) Events() <-chan Event {
+	return m.eventCh
+}
 
-	if runtime.GOOS == "windows" {
-		return checkWindowsProcess(pid)
+// Shutdown gracefully shuts down the tunnel
+func (m *Manager) Shutdown() error {
+	err := m.Disconnect()
+
+	m.mu.Lock()
+	front := m.front
+	m.front = nil
+	m.mu.Unlock()
+	if front != nil {
+		_ = front.Close()
 	}
 
-	err = process.Signal(nil)
-	return err == nil
+	return err
 }
@@ -0,0 +1,112 @@
+package tunnel
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/logline"
+)
+
+// dnstt-client log formats. Lines carry the standard log timestamp; the
+// session and stream lines come from dnstt-client's run and handle, the
+// error prefixes from its DNS, DoH and DoT packet loops.
+var (
+	logTimestamp = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)? `)
+	sessionBegin = regexp.MustCompile(`^begin session [0-9a-f]{8}$`)
+	sessionEnd   = regexp.MustCompile(`^end session [0-9a-f]{8}$`)
+	streamBegin  = regexp.MustCompile(`^begin stream [0-9a-f]{8}:\d+$`)
+	streamEnd    = regexp.MustCompile(`^end stream [0-9a-f]{8}:\d+$`)
+)
+
+// queryErrorPrefixes start the lines dnstt-client logs when sending or
+// receiving DNS messages fails, or when a stream can't be opened.
+var queryErrorPrefixes = []string{
+	"recvLoop: ",
+	"sendLoop: ",
+	"ReadFrom temporary error: ",
+	"WriteTo temporary error: ",
+	"handle: ",
+}
+
+// outputClassifier turns dnstt-client log lines into session events. It
+// is shared by a session's stdout and stderr writers.
+type outputClassifier struct {
+	resolver string
+	events   chan<- Event
+
+	mu sync.Mutex
+	// handshaken is set once a stream opened in the current KCP session;
+	// dnstt only accepts streams after the Noise handshake completed
+	handshaken bool
+}
+
+// writer returns a line writer for one output stream.
+func (c *outputClassifier) writer(stream string) *logline.Writer {
+	return logline.New("dnstt "+stream, c.handleLine)
+}
+
+// handleLine emits the events a log line stands for
+func (c *outputClassifier) handleLine(line string) {
+	evType, ok := classifyLine(line)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	handshake := false
+	switch evType {
+	case EventTunnelSessionBegan, EventTunnelSessionEnded:
+		c.handshaken = false
+	case EventStreamOpened:
+		handshake = !c.handshaken
+		c.handshaken = true
+	}
+	c.mu.Unlock()
+
+	if handshake {
+		sendEvent(c.events, Event{Type: EventHandshakeDone, Resolver: c.resolver, Message: line})
+	}
+	sendEvent(c.events, Event{Type: evType, Resolver: c.resolver, Message: line})
+}
+
+// classifyLine maps a dnstt-client log line to an event type. Query
+// errors are timeouts when the underlying error is one. Decode errors are
+// responses that don't parse as DNS and base32 payloads a resolver
+// mangled (Go's "illegal base32 data").
+func classifyLine(line string) (EventType, bool) {
+	msg := logTimestamp.ReplaceAllString(strings.TrimSpace(line), "")
+
+	switch {
+	case sessionBegin.MatchString(msg):
+		return EventTunnelSessionBegan, true
+	case sessionEnd.MatchString(msg):
+		return EventTunnelSessionEnded, true
+	case streamBegin.MatchString(msg):
+		return EventStreamOpened, true
+	case streamEnd.MatchString(msg):
+		return EventStreamClosed, true
+	case strings.HasPrefix(msg, "MessageFromWireFormat: "),
+		strings.Contains(msg, "illegal base32 data at input byte"):
+		return EventDecodeError, true
+	}
+
+	for _, prefix := range queryErrorPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			if isTimeoutText(msg) {
+				return EventTimeout, true
+			}
+			return EventQueryError, true
+		}
+	}
+	return 0, false
+}
+
+// isTimeoutText reports whether an error message describes a timeout
+// (net's "i/o timeout", context deadlines, smux's "timeout").
+func isTimeoutText(msg string) bool {
+	return strings.HasSuffix(msg, "i/o timeout") ||
+		strings.Contains(msg, "deadline exceeded") ||
+		strings.Contains(msg, "Client.Timeout exceeded") ||
+		strings.HasSuffix(msg, ": timeout")
+}
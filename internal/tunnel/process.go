@@ -0,0 +1,245 @@
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/logline"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// processTransport runs sessions by spawning the dnstt-client executable
+type processTransport struct {
+	config *config.TunnelConfig
+}
+
+// Name returns the transport mode name
+func (t *processTransport) Name() string {
+	return config.TunnelModeSubprocess
+}
+
+// Start spawns dnstt-client for the given resolver
+func (t *processTransport) Start(r *resolver.Resolver, localAddr string) (Session, error) {
+	args, err := t.buildArgs(r, localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[tunnel] Starting: %s %v", t.config.DnsttPath, args)
+
+	events := make(chan Event, 64)
+	classifier := &outputClassifier{resolver: r.Address, events: events}
+	stdout := classifier.writer("stdout")
+	stderr := classifier.writer("stderr")
+
+	cmd := exec.Command(t.config.DnsttPath, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// Set process group for proper cleanup
+	setProcAttr(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start dnstt-client: %w", err)
+	}
+
+	s := &processSession{
+		cmd:       cmd,
+		resolver:  &resolver.Resolver{Address: r.Address, Type: resolverType(r), ServerName: r.ServerName},
+		localAddr: localAddr,
+		done:      make(chan struct{}),
+		events:    events,
+		output:    []*logline.Writer{stdout, stderr},
+	}
+	log.Printf("[tunnel] Process started with PID: %d", cmd.Process.Pid)
+	sendEvent(s.events, Event{Type: EventSessionStarted, Resolver: r.Address})
+
+	go s.wait()
+
+	return s, nil
+}
+
+// buildArgs constructs the command line arguments for dnstt-client
+func (t *processTransport) buildArgs(r *resolver.Resolver, localAddr string) ([]string, error) {
+	args := []string{}
+
+	// dnstt-client takes the TLS name from the resolver address and has no
+	// option to verify an IP's certificate against another name
+	if r.ServerName != "" {
+		return nil, fmt.Errorf("resolver %s needs TLS name %s, which only tunnel.mode embedded can use", r.Address, r.ServerName)
+	}
+
+	// Add resolver transport
+	switch resolverType(r) {
+	case "doh":
+		args = append(args, "-doh", dohURL(r.Address))
+	case "dot":
+		args = append(args, "-dot", resolver.HostPort(r.Address, "853"))
+	case "udp":
+		args = append(args, "-udp", resolver.HostPort(r.Address, "53"))
+	default:
+		return nil, fmt.Errorf("unsupported resolver type %q for %s", r.Type, r.Address)
+	}
+
+	// Add uTLS fingerprint (only meaningful for TLS-based transports)
+	if rt := resolverType(r); (rt == "doh" || rt == "dot") && t.config.UTLSFingerprint != "" {
+		args = append(args, "-utls", t.config.UTLSFingerprint)
+	}
+
+	// Add public key
+	args = append(args, "-pubkey", t.config.PubKey)
+
+	// Add domain
+	args = append(args, t.config.Domain)
+
+	// Add local listener
+	args = append(args, localAddr)
+
+	return args, nil
+}
+
+// processSession is a running dnstt-client process
+type processSession struct {
+	cmd       *exec.Cmd
+	resolver  *resolver.Resolver
+	localAddr string
+
+	done     chan struct{}
+	events   chan Event
+	output   []*logline.Writer
+	stopOnce sync.Once
+}
+
+// wait reaps the process and signals completion
+func (s *processSession) wait() {
+	err := s.cmd.Wait()
+	for _, w := range s.output {
+		w.Flush()
+	}
+	if err != nil {
+		log.Printf("[tunnel] Process exited with error: %v", err)
+	} else {
+		log.Printf("[tunnel] Process exited normally")
+	}
+
+	msg := "exited normally"
+	if err != nil {
+		msg = err.Error()
+	}
+	sendEvent(s.events, Event{Type: EventSessionEnded, Resolver: s.resolver.Address, Message: msg})
+
+	close(s.done)
+	close(s.events)
+}
+
+// Resolver returns the resolver this session tunnels through
+func (s *processSession) Resolver() *resolver.Resolver {
+	r := *s.resolver
+	return &r
+}
+
+// LocalAddr returns the local listen address
+func (s *processSession) LocalAddr() string {
+	return s.localAddr
+}
+
+// Alive checks process status
+func (s *processSession) Alive() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	if s.cmd.Process == nil {
+		return false
+	}
+	return checkProcessAlive(s.cmd.Process.Pid)
+}
+
+// Done is closed when the process has exited
+func (s *processSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Events delivers session events
+func (s *processSession) Events() <-chan Event {
+	return s.events
+}
+
+// Stop terminates the process, killing it if it doesn't exit within 5s
+func (s *processSession) Stop() error {
+	var err error
+	s.stopOnce.Do(func() {
+		if !s.Alive() {
+			<-s.done
+			return
+		}
+		if terr := terminateProcess(s.cmd); terr != nil {
+			err = fmt.Errorf("failed to terminate process: %w", terr)
+			return
+		}
+
+		select {
+		case <-s.done:
+		case <-time.After(5 * time.Second):
+			_ = s.cmd.Process.Kill()
+			<-s.done
+		}
+	})
+	return err
+}
+
+// resolverType returns the resolver's transport type, defaulting to UDP
+func resolverType(r *resolver.Resolver) string {
+	if r.Type == "" {
+		return "udp"
+	}
+	return r.Type
+}
+
+// dohURL converts a DoH resolver address into a full URL.
+// Bare hosts are expanded to https://host/dns-query, bracketing IPv6.
+func dohURL(addr string) string {
+	if strings.HasPrefix(addr, "https://") || strings.HasPrefix(addr, "http://") {
+		return addr
+	}
+	if resolver.IsIPv6(addr) && !strings.HasPrefix(addr, "[") {
+		addr = "[" + addr + "]"
+	}
+	return "https://" + addr + "/dns-query"
+}
+
+// terminateProcess attempts graceful termination
+func terminateProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return cmd.Process.Kill()
+	}
+	return cmd.Process.Signal(os.Interrupt)
+}
+
+// checkProcessAlive checks if a process is running
+func checkProcessAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	if runtime.GOOS == "windows" {
+		return checkWindowsProcess(pid)
+	}
+
+	// Signal 0 performs error checking only (os.Process rejects a nil Signal)
+	err = process.Signal(syscall.Signal(0))
+	return err == nil
+}
@@ -0,0 +1,362 @@
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// standbyRetryDelay is how long to wait before replacing a standby
+// session that exited on its own
+const standbyRetryDelay = 5 * time.Second
+
+// drainTimeout is how long a session replaced by Failover keeps serving
+// the connections it already carries before it is stopped
+const drainTimeout = 2 * time.Minute
+
+// standbyEnabled reports whether warm standby sessions are configured
+func (m *Manager) standbyEnabled() bool {
+	return m.config.Standby > 0
+}
+
+// ensureFront starts the front listener on LocalAddr if not running yet
+func (m *Manager) ensureFront() error {
+	if m.front != nil {
+		return nil
+	}
+	route := m.activeRoute
+	if m.config.Bonding {
+		route = m.bondRoute
+	}
+	front, err := newFrontProxy(m.config.LocalAddr, route)
+	if err != nil {
+		return err
+	}
+	m.front = front
+	return nil
+}
+
+// activeRoute sends every new connection to the active session
+func (m *Manager) activeRoute() (string, func(int64, time.Duration, error)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.session == nil {
+		return "", nil
+	}
+	return m.session.LocalAddr(), m.trackConn(m.session)
+}
+
+// trackConn counts a front connection routed to s and returns the
+// callback that uncounts it. A draining session is stopped when its last
+// connection ends.
+func (m *Manager) trackConn(s Session) func(int64, time.Duration, error) {
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	if m.conns == nil {
+		m.conns = make(map[Session]int)
+	}
+	m.conns[s]++
+
+	return func(int64, time.Duration, error) {
+		m.drainMu.Lock()
+		m.conns[s]--
+		idle := m.conns[s] <= 0
+		if idle {
+			delete(m.conns, s)
+		}
+		_, draining := m.draining[s]
+		m.drainMu.Unlock()
+
+		if idle && draining {
+			m.finishDrain(s, "last connection closed")
+		}
+	}
+}
+
+// drain stops s once the connections it carries have closed, or after
+// drainTimeout. New connections no longer reach it.
+func (m *Manager) drain(s Session) {
+	m.drainMu.Lock()
+	if m.conns[s] == 0 {
+		m.drainMu.Unlock()
+		log.Printf("[tunnel] Stopping idle session via %s", s.Resolver().Address)
+		_ = s.Stop()
+		return
+	}
+	if m.draining == nil {
+		m.draining = make(map[Session]*time.Timer)
+	}
+	log.Printf("[tunnel] Draining session via %s (%d connections open)", s.Resolver().Address, m.conns[s])
+	m.draining[s] = time.AfterFunc(drainTimeout, func() {
+		m.finishDrain(s, "drain timeout")
+	})
+	m.drainMu.Unlock()
+}
+
+// finishDrain stops a draining session, once
+func (m *Manager) finishDrain(s Session, reason string) {
+	m.drainMu.Lock()
+	timer, ok := m.draining[s]
+	delete(m.draining, s)
+	m.drainMu.Unlock()
+	if !ok {
+		return
+	}
+	timer.Stop()
+
+	log.Printf("[tunnel] Stopping drained session via %s (%s)", s.Resolver().Address, reason)
+	_ = s.Stop()
+}
+
+// forgetConns drops the connection count and drain state of a session
+// that ended
+func (m *Manager) forgetConns(s Session) {
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	delete(m.conns, s)
+	if timer, ok := m.draining[s]; ok {
+		timer.Stop()
+		delete(m.draining, s)
+	}
+}
+
+// stopDraining stops every draining session without waiting for their
+// connections
+func (m *Manager) stopDraining() {
+	m.drainMu.Lock()
+	sessions := make([]Session, 0, len(m.draining))
+	for s := range m.draining {
+		sessions = append(sessions, s)
+	}
+	m.drainMu.Unlock()
+
+	for _, s := range sessions {
+		m.finishDrain(s, "tunnel stopped")
+	}
+}
+
+// freeSessionAddr picks an internal listen address not used by any
+// session and not taken by another program. Caller must hold m.mu.
+func (m *Manager) freeSessionAddr() (string, error) {
+	used := make(map[string]bool)
+	if m.session != nil {
+		used[m.session.LocalAddr()] = true
+	}
+	for _, s := range m.standby {
+		used[s.LocalAddr()] = true
+	}
+	for _, p := range m.pending {
+		used[p.addr] = true
+	}
+
+	// Leave room for sessions that are still draining or shutting down
+	m.drainMu.Lock()
+	span := 2*(m.config.Standby+1) + len(m.draining)
+	m.drainMu.Unlock()
+	for i := 0; i < span; i++ {
+		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(m.config.StandbyBasePort+i))
+		if used[addr] {
+			continue
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			continue
+		}
+		ln.Close()
+		return addr, nil
+	}
+	return "", fmt.Errorf("no free session port in %d-%d", m.config.StandbyBasePort, m.config.StandbyBasePort+span-1)
+}
+
+// inUse returns the resolver addresses of all running sessions. Caller
+// must hold m.mu.
+func (m *Manager) inUse() map[string]bool {
+	used := make(map[string]bool)
+	if m.session != nil {
+		used[m.session.Resolver().Address] = true
+	}
+	for _, s := range m.standby {
+		used[s.Resolver().Address] = true
+	}
+	for addr := range m.pending {
+		used[addr] = true
+	}
+	return used
+}
+
+// pendingStandby is a standby session being started or waiting for its
+// handshake
+type pendingStandby struct {
+	addr    string  // listen address
+	session Session // nil until started
+}
+
+// fillStandby starts standby sessions on healthy resolvers not already
+// in use until config.Standby sessions are running. mu is not held while
+// a session starts, and it joins the standby list, which failover and
+// bonding draw from, only once it is ready.
+func (m *Manager) fillStandby() {
+	for {
+		m.mu.Lock()
+		if m.session == nil || len(m.standby)+len(m.pending) >= m.config.Standby {
+			m.mu.Unlock()
+			return
+		}
+
+		var next *resolver.Resolver
+		used := m.inUse()
+		for _, r := range m.pool.GetHealthy() {
+			if !used[r.Address] {
+				next = r
+				break
+			}
+		}
+		if next == nil {
+			m.mu.Unlock()
+			return
+		}
+
+		addr, err := m.freeSessionAddr()
+		if err != nil {
+			m.mu.Unlock()
+			log.Printf("[tunnel] Cannot start standby session: %v", err)
+			return
+		}
+
+		p := &pendingStandby{addr: addr}
+		if m.pending == nil {
+			m.pending = make(map[string]*pendingStandby)
+		}
+		m.pending[next.Address] = p
+		m.mu.Unlock()
+
+		if !m.startStandby(next, p) {
+			return
+		}
+	}
+}
+
+// startStandby starts the pending standby session p through r and adds
+// it to the standby list once ready. It returns false if the tunnel was
+// stopped in the meantime.
+func (m *Manager) startStandby(r *resolver.Resolver, p *pendingStandby) bool {
+	s, err := m.transport.Start(r, p.addr)
+
+	m.mu.Lock()
+	current := m.pending[r.Address] == p
+	if current {
+		if err != nil {
+			delete(m.pending, r.Address)
+		} else {
+			p.session = s
+		}
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		log.Printf("[tunnel] Standby session via %s failed: %v", r.Address, err)
+		m.pool.MarkFailed(r.Address)
+		return current
+	}
+	if !current {
+		_ = s.Stop()
+		return false
+	}
+
+	go m.watchSession(s)
+	err = waitReady(s)
+
+	m.mu.Lock()
+	current = m.pending[r.Address] == p
+	if current {
+		delete(m.pending, r.Address)
+		if err == nil {
+			m.standby = append(m.standby, s)
+		}
+	}
+	m.mu.Unlock()
+
+	switch {
+	case !current:
+		// stopInternal stopped it
+		return false
+	case err != nil:
+		log.Printf("[tunnel] Standby session via %s failed: %v", r.Address, err)
+		_ = s.Stop()
+		m.pool.MarkFailed(r.Address)
+	default:
+		log.Printf("[tunnel] Standby session on %s via %s", p.addr, r.Address)
+	}
+	return true
+}
+
+// removeStandby removes s from the standby list. Caller must hold m.mu.
+func (m *Manager) removeStandby(s Session) bool {
+	for i, sb := range m.standby {
+		if sb == s {
+			m.standby = append(m.standby[:i], m.standby[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// handleStandbyExit records the failure of a standby session and
+// schedules a replacement
+func (m *Manager) handleStandbyExit(s Session) {
+	addr := s.Resolver().Address
+	log.Printf("[tunnel] Standby session via %s exited", addr)
+	m.pool.MarkFailed(addr)
+	time.AfterFunc(standbyRetryDelay, m.fillStandby)
+}
+
+// Failover promotes a warm standby session to active. New connections to
+// LocalAddr go to the promoted session immediately; the old session is
+// drained, keeping its existing connections until they close or
+// drainTimeout passes. It returns false if no standby is available, in
+// which case the caller should use Connect.
+func (m *Manager) Failover() bool {
+	m.mu.Lock()
+	var next Session
+	for len(m.standby) > 0 && next == nil {
+		s := m.standby[0]
+		m.standby = m.standby[1:]
+		if s.Alive() {
+			next = s
+		} else {
+			go s.Stop()
+		}
+	}
+	if next == nil {
+		m.mu.Unlock()
+		return false
+	}
+	old := m.session
+	m.setSession(next)
+	m.notifySwitch()
+	m.mu.Unlock()
+
+	log.Printf("[tunnel] Switched to standby session via %s", next.Resolver().Address)
+	if old != nil {
+		m.drain(old)
+	}
+
+	go m.fillStandby()
+	return true
+}
+
+// StandbyResolvers returns the resolvers of the running standby sessions
+func (m *Manager) StandbyResolvers() []*resolver.Resolver {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]*resolver.Resolver, 0, len(m.standby))
+	for _, s := range m.standby {
+		result = append(result, s.Resolver())
+	}
+	return result
+}
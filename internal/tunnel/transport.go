@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"time"
+
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/config"
+	"github.com/chjkh8113/dns-tunnel-vpn/internal/resolver"
+)
+
+// EventType identifies the kind of session event.
+type EventType int
+
+const (
+	// EventSessionStarted is emitted when a session has been launched.
+	EventSessionStarted EventType = iota
+	// EventSessionEnded is emitted when a session has stopped or exited.
+	EventSessionEnded
+	// EventHandshakeDone is emitted when the Noise handshake with the server completed.
+	EventHandshakeDone
+	// EventStreamOpened is emitted when a stream through the tunnel was opened.
+	EventStreamOpened
+	// EventStreamClosed is emitted when a stream through the tunnel was closed.
+	EventStreamClosed
+	// EventDecodeError is emitted when a DNS response could not be decoded.
+	EventDecodeError
+	// EventTimeout is emitted when the session or a stream timed out.
+	EventTimeout
+	// EventQueryError is emitted for other errors sending or receiving DNS queries.
+	EventQueryError
+	// EventTunnelSessionBegan is emitted when a KCP session to the server
+	// began inside a running session; the Noise handshake follows.
+	EventTunnelSessionBegan
+	// EventTunnelSessionEnded is emitted when the KCP/smux session inside a
+	// running session ended; the session itself may keep running.
+	EventTunnelSessionEnded
+)
+
+// String returns a short name for the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventSessionStarted:
+		return "session_started"
+	case EventSessionEnded:
+		return "session_ended"
+	case EventHandshakeDone:
+		return "handshake_done"
+	case EventStreamOpened:
+		return "stream_opened"
+	case EventStreamClosed:
+		return "stream_closed"
+	case EventDecodeError:
+		return "decode_error"
+	case EventTimeout:
+		return "timeout"
+	case EventQueryError:
+		return "query_error"
+	case EventTunnelSessionBegan:
+		return "tunnel_session_began"
+	case EventTunnelSessionEnded:
+		return "tunnel_session_ended"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a notification from a running tunnel session.
+type Event struct {
+	// Type is the kind of event
+	Type EventType
+
+	// Resolver is the address of the resolver the session runs through
+	Resolver string
+
+	// Message is the raw detail (log line, error text)
+	Message string
+
+	// Time is when the event was observed
+	Time time.Time
+}
+
+// Session is a single running dnstt client bound to one resolver and
+// one local listen address.
+type Session interface {
+	// Resolver returns the resolver this session tunnels through.
+	Resolver() *resolver.Resolver
+
+	// LocalAddr returns the local address the session accepts connections on.
+	LocalAddr() string
+
+	// Alive reports whether the session is still running.
+	Alive() bool
+
+	// Done is closed when the session has ended.
+	Done() <-chan struct{}
+
+	// Events delivers session events. The channel is closed after Done.
+	Events() <-chan Event
+
+	// Stop terminates the session and waits for it to end.
+	Stop() error
+}
+
+// readySession is implemented by sessions that report when their tunnel
+// is up, so Connect need not poll the local port.
+type readySession interface {
+	// Ready is closed once the first handshake with the server completed.
+	Ready() <-chan struct{}
+}
+
+// Transport starts dnstt client sessions.
+type Transport interface {
+	// Name returns the transport mode name.
+	Name() string
+
+	// Start launches a new session through r, listening on localAddr.
+	Start(r *resolver.Resolver, localAddr string) (Session, error)
+}
+
+// newTransport returns the transport for the configured tunnel mode.
+func newTransport(cfg *config.TunnelConfig) Transport {
+	if cfg.Mode == config.TunnelModeEmbedded {
+		return &embeddedTransport{config: cfg}
+	}
+	return &processTransport{config: cfg}
+}
+
+// sendEvent delivers an event without blocking if the receiver is slow.
+func sendEvent(ch chan<- Event, ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	select {
+	case ch <- ev:
+	default:
+	}
+}
@@ -0,0 +1,124 @@
+package uot
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Client listens for datagrams on a local UDP port and carries them over
+// a TCP connection to the tunnel. Replies are sent back to the most
+// recent local sender, which fits a single WireGuard peer.
+type Client struct {
+	listen string
+	target func() string
+
+	mu   sync.Mutex
+	peer net.Addr
+	conn net.Conn
+	pc   net.PacketConn
+}
+
+// NewClient creates a Client. target returns the TCP address to carry
+// datagrams to (the tunnel's local address); it is called on each
+// reconnect.
+func NewClient(listen string, target func() string) *Client {
+	return &Client{listen: listen, target: target}
+}
+
+// Run serves until ctx is cancelled.
+func (c *Client) Run(ctx context.Context) error {
+	pc, err := net.ListenPacket("udp", c.listen)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.pc = pc
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+		c.dropConn(nil)
+	}()
+
+	log.Printf("[uot] Listening on udp %s", pc.LocalAddr())
+
+	buf := make([]byte, MaxDatagram)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		c.mu.Lock()
+		c.peer = from
+		c.mu.Unlock()
+
+		conn, err := c.stream(ctx)
+		if err != nil {
+			log.Printf("[uot] Tunnel stream unavailable: %v", err)
+			continue
+		}
+		if err := WriteFrame(conn, buf[:n]); err != nil {
+			log.Printf("[uot] Write to tunnel failed: %v", err)
+			c.dropConn(conn)
+		}
+	}
+}
+
+// stream returns the TCP connection to the tunnel, dialing it if needed.
+func (c *Client) stream(ctx context.Context) (net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, "tcp", c.target())
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.readLoop(conn)
+	return conn, nil
+}
+
+// readLoop forwards frames from the tunnel to the local peer.
+func (c *Client) readLoop(conn net.Conn) {
+	buf := make([]byte, MaxDatagram)
+	for {
+		p, err := ReadFrame(conn, buf)
+		if err != nil {
+			c.dropConn(conn)
+			return
+		}
+
+		c.mu.Lock()
+		peer, pc := c.peer, c.pc
+		c.mu.Unlock()
+		if peer != nil && pc != nil {
+			pc.WriteTo(p, peer)
+		}
+	}
+}
+
+// dropConn closes conn if it is still current (or the current one if nil)
+// so the next datagram redials.
+func (c *Client) dropConn(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && (conn == nil || c.conn == conn) {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
@@ -0,0 +1,40 @@
+// Package uot carries UDP datagrams over a TCP stream (UDP-over-TCP), so
+// UDP protocols such as WireGuard can run through dnstt, which only
+// forwards raw TCP. Each datagram is sent as a 2-byte big-endian length
+// followed by the payload.
+package uot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxDatagram is the largest datagram that fits in a frame.
+const MaxDatagram = 65535
+
+// WriteFrame writes one length-prefixed datagram.
+func WriteFrame(w io.Writer, p []byte) error {
+	if len(p) > MaxDatagram {
+		return fmt.Errorf("datagram too large: %d bytes", len(p))
+	}
+	buf := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(buf, uint16(len(p)))
+	copy(buf[2:], p)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads one length-prefixed datagram into buf, which must hold
+// MaxDatagram bytes, and returns the payload.
+func ReadFrame(r io.Reader, buf []byte) ([]byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,75 @@
+package uot
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	datagrams := [][]byte{
+		{},
+		[]byte("handshake"),
+		bytes.Repeat([]byte{0xab}, 1420),
+		bytes.Repeat([]byte{0xcd}, MaxDatagram),
+	}
+	var stream bytes.Buffer
+	for _, d := range datagrams {
+		if err := WriteFrame(&stream, d); err != nil {
+			t.Fatalf("writing %d bytes: %v", len(d), err)
+		}
+	}
+
+	buf := make([]byte, MaxDatagram)
+	for _, want := range datagrams {
+		got, err := ReadFrame(&stream, buf)
+		if err != nil {
+			t.Fatalf("reading %d bytes: %v", len(want), err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("got %d bytes, want %d", len(got), len(want))
+		}
+	}
+	if _, err := ReadFrame(&stream, buf); err != io.EOF {
+		t.Errorf("error %v at end of stream, want EOF", err)
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteFrame(&b, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 2, 'h', 'i'}; !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("frame %v, want %v", b.Bytes(), want)
+	}
+
+	b.Reset()
+	if err := WriteFrame(&b, make([]byte, MaxDatagram+1)); err == nil {
+		t.Error("wrote an oversized datagram")
+	}
+	if b.Len() != 0 {
+		t.Errorf("wrote %d bytes for an oversized datagram", b.Len())
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"empty", nil, io.EOF},
+		{"partial header", []byte{0}, io.ErrUnexpectedEOF},
+		{"missing payload", []byte{0, 4}, io.EOF},
+		{"partial payload", []byte{0, 4, 'a', 'b'}, io.ErrUnexpectedEOF},
+	}
+	buf := make([]byte, MaxDatagram)
+	for _, tt := range tests {
+		_, err := ReadFrame(bytes.NewReader(tt.input), buf)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package uot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+)
+
+// WriteAddrFrame writes a datagram to or from addr ("host:port") as one
+// frame: a 1-byte address length, the address and the payload.
+func WriteAddrFrame(w io.Writer, addr string, p []byte) error {
+	if len(addr) > 255 {
+		return fmt.Errorf("address too long: %d bytes", len(addr))
+	}
+	buf := make([]byte, 0, 1+len(addr)+len(p))
+	buf = append(buf, byte(len(addr)))
+	buf = append(buf, addr...)
+	return WriteFrame(w, append(buf, p...))
+}
+
+// ReadAddrFrame reads a frame written by WriteAddrFrame into buf, which
+// must hold MaxDatagram bytes.
+func ReadAddrFrame(r io.Reader, buf []byte) (string, []byte, error) {
+	p, err := ReadFrame(r, buf)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(p) < 1 || len(p) < 1+int(p[0]) {
+		return "", nil, fmt.Errorf("short relay frame")
+	}
+	n := int(p[0])
+	return string(p[1 : 1+n]), p[1+n:], nil
+}
+
+// Relay accepts TCP connections and sends their address frames as
+// datagrams to the address in each frame, framing replies with the
+// address they came from. It is the far end of the SOCKS5 server's UDP
+// ASSOCIATE, reached through the server-side SOCKS5 proxy or SSH.
+type Relay struct {
+	listen string
+}
+
+// NewRelay creates a Relay listening on TCP listen.
+func NewRelay(listen string) *Relay {
+	return &Relay{listen: listen}
+}
+
+// Run serves until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", r.listen)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	log.Printf("[uot] UDP relay listening on tcp %s", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go r.handle(conn)
+	}
+}
+
+// handle relays one association: one UDP socket for all its destinations.
+func (r *Relay) handle(conn net.Conn) {
+	defer conn.Close()
+
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		log.Printf("[uot] UDP relay socket failed: %v", err)
+		return
+	}
+	defer pc.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, MaxDatagram)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if err := WriteAddrFrame(conn, from.String(), buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Resolved destinations, so names are looked up once per association
+	dests := make(map[string]*net.UDPAddr)
+	buf := make([]byte, MaxDatagram)
+	for {
+		addr, p, err := ReadAddrFrame(conn, buf)
+		if err != nil {
+			break
+		}
+		dest, ok := dests[addr]
+		if !ok {
+			dest, err = net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				log.Printf("[uot] UDP relay: %v", err)
+			}
+			dests[addr] = dest
+		}
+		if dest == nil {
+			continue
+		}
+		pc.WriteTo(p, dest)
+	}
+
+	pc.Close()
+	<-done
+}
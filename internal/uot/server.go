@@ -0,0 +1,90 @@
+package uot
+
+import (
+	"context"
+	"log"
+	"net"
+)
+
+// Server accepts TCP connections (from dnstt-server) and relays their
+// frames as datagrams to a UDP service such as WireGuard. Each TCP
+// connection gets its own UDP socket, so the service sees one peer
+// address per tunnel client.
+type Server struct {
+	listen  string
+	forward string
+}
+
+// NewServer creates a Server listening on TCP listen and forwarding to UDP forward.
+func NewServer(listen, forward string) *Server {
+	return &Server{listen: listen, forward: forward}
+}
+
+// Run serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	log.Printf("[uot] Listening on tcp %s, forwarding to udp %s", ln.Addr(), s.forward)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(ctx, conn)
+	}
+}
+
+// handle relays one TCP stream to the UDP service and back.
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	udp, err := net.Dial("udp", s.forward)
+	if err != nil {
+		log.Printf("[uot] Dial %s failed: %v", s.forward, err)
+		return
+	}
+	defer udp.Close()
+
+	log.Printf("[uot] Stream from %s opened", conn.RemoteAddr())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, MaxDatagram)
+		for {
+			n, err := udp.Read(buf)
+			if err != nil {
+				return
+			}
+			if err := WriteFrame(conn, buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, MaxDatagram)
+	for {
+		p, err := ReadFrame(conn, buf)
+		if err != nil {
+			break
+		}
+		if _, err := udp.Write(p); err != nil {
+			break
+		}
+	}
+
+	udp.Close()
+	<-done
+	log.Printf("[uot] Stream from %s closed", conn.RemoteAddr())
+}
@@ -20,26 +20,33 @@ echo "[1/7] Installing dependencies..."
 apt update
 apt install -y wireguard wget
 
-echo "[2/7] Installing wstunnel..."
-cd /tmp
-wget -q https://github.com/erebe/wstunnel/releases/download/v10.1.7/wstunnel_10.1.7_linux_amd64.tar.gz
-tar xzf wstunnel_10.1.7_linux_amd64.tar.gz
-mv wstunnel /usr/local/bin/
-chmod +x /usr/local/bin/wstunnel
-
-echo "[3/7] Building dnstt-server..."
+echo "[2/7] Building dnstt-server and dns-tunnel..."
 apt install -y golang-go git
 cd /tmp
 git clone https://www.bamsoftware.com/git/dnstt.git
 cd dnstt/dnstt-server
 go build
 mv dnstt-server /usr/local/bin/
+GOBIN=/usr/local/bin go install github.com/chjkh8113/dns-tunnel-vpn/cmd/dns-tunnel@latest
+
+echo "[3/7] Writing dns-tunnel server config..."
+mkdir -p /etc/dns-tunnel
+cat > /etc/dns-tunnel/server.yaml << EOF
+server:
+  dnstt_server_path: /usr/local/bin/dnstt-server
+  domain: ${TUNNEL_DOMAIN}
+  listen: ":53"
+  privkey_file: /etc/dns-tunnel/dnstt-server.key
+  pubkey_file: /etc/dns-tunnel/dnstt-server.pub
+  upstream: 127.0.0.1:5555
+  udp_forward: 127.0.0.1:51820
+  api:
+    enabled: true
+    port: 8081
+EOF
 
 echo "[4/7] Generating keys..."
-cd /root
-
-# dnstt keys
-/usr/local/bin/dnstt-server -gen-key -privkey-file dnstt-server.key -pubkey-file dnstt-server.pub
+# The dnstt keypair is generated by dns-tunnel server on first start
 
 # WireGuard keys
 mkdir -p /etc/wireguard
@@ -70,32 +77,17 @@ echo 'net.ipv4.ip_forward=1' >> /etc/sysctl.conf
 sysctl -p
 
 echo "[6/7] Configuring iptables..."
-iptables -I INPUT -p udp --dport 5300 -j ACCEPT
-iptables -t nat -I PREROUTING -i eth0 -p udp --dport 53 -j REDIRECT --to-ports 5300
+iptables -I INPUT -p udp --dport 53 -j ACCEPT
 
 echo "[7/7] Creating systemd services..."
 
-cat > /etc/systemd/system/wstunnel.service << 'EOF'
-[Unit]
-Description=wstunnel server
-After=network.target
-
-[Service]
-ExecStart=/usr/local/bin/wstunnel server ws://0.0.0.0:5555 --restrict-to 127.0.0.1:51820
-Restart=always
-RestartSec=5
-
-[Install]
-WantedBy=multi-user.target
-EOF
-
-cat > /etc/systemd/system/dnstt.service << EOF
+cat > /etc/systemd/system/dns-tunnel-server.service << 'EOF'
 [Unit]
-Description=dnstt server
-After=network.target wstunnel.service
+Description=dns-tunnel server (dnstt-server supervisor)
+After=network.target wg-quick@wg0.service
 
 [Service]
-ExecStart=/usr/local/bin/dnstt-server -udp :5300 -privkey-file /root/dnstt-server.key ${TUNNEL_DOMAIN} 127.0.0.1:5555
+ExecStart=/usr/local/bin/dns-tunnel server -config /etc/dns-tunnel/server.yaml
 Restart=always
 RestartSec=5
 
@@ -104,8 +96,14 @@ WantedBy=multi-user.target
 EOF
 
 systemctl daemon-reload
-systemctl enable wg-quick@wg0 wstunnel dnstt
-systemctl start wg-quick@wg0 wstunnel dnstt
+systemctl enable wg-quick@wg0 dns-tunnel-server
+systemctl start wg-quick@wg0 dns-tunnel-server
+
+# Wait for the keypair to be generated on first start
+for i in $(seq 1 10); do
+    [ -f /etc/dns-tunnel/dnstt-server.pub ] && break
+    sleep 1
+done
 
 echo ""
 echo "=== Setup Complete ==="
@@ -113,7 +111,7 @@ echo ""
 echo "IMPORTANT - Save these values for client configuration:"
 echo ""
 echo "DNSTT Public Key:"
-cat /root/dnstt-server.pub
+cat /etc/dns-tunnel/dnstt-server.pub
 echo ""
 echo "WireGuard Server Public Key:"
 cat /etc/wireguard/server_public.key
@@ -123,6 +121,10 @@ cat /etc/wireguard/client_private.key
 echo ""
 echo "Tunnel Domain: ${TUNNEL_DOMAIN}"
 echo ""
+echo "To hand out a signed client profile (YAML, URI and QR code):"
+echo "  dns-tunnel export-profile -config /etc/dns-tunnel/server.yaml -resolvers 1.1.1.1 -o client.yaml"
+echo "Clients need the printed signer fingerprint too (dns-tunnel -config client.yaml -signer SHA256:...)"
+echo ""
 echo "Don't forget to configure DNS records!"
 echo "  A    tns.yourdomain.com  ->  YOUR_SERVER_IP"
 echo "  NS   t.yourdomain.com    ->  tns.yourdomain.com"